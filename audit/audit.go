@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/types"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+// Actions recorded in the audit trail
+const (
+	ActionLogin                 = "auth.login"
+	ActionLoginFailed           = "auth.login_failed"
+	ActionPasswordChanged       = "auth.password_changed"
+	ActionRoleChanged           = "user.role_changed"
+	ActionDataExported          = "privacy.export"
+	ActionDeletionRequested     = "privacy.deletion_requested"
+	ActionDeletionCanceled      = "privacy.deletion_canceled"
+	ActionAccountDeleted        = "user.deleted"
+	ActionSignupSettingsChanged = "settings.signup_changed"
+	ActionInvitationCreated     = "invitation.create"
+	ActionInvitationRevoked     = "invitation.revoke"
+	ActionInvitationRedeemed    = "invitation.redeem"
+	ActionOrganizationCreated   = "organization.create"
+	ActionOrganizationSwitched  = "organization.switch"
+	ActionMemberAdded           = "organization.member_add"
+	ActionMemberUpdated         = "organization.member_update"
+	ActionMemberRemoved         = "organization.member_remove"
+	ActionServiceAccountCreated = "service_account.create"
+	ActionServiceAccountUpdated = "service_account.update"
+	ActionServiceAccountRotated = "service_account.rotate_secret"
+	ActionServiceAccountDeleted = "service_account.delete"
+	ActionServiceTokenIssued    = "service_account.token"
+	ActionImpersonationStart    = "impersonation.start"
+	ActionImpersonationEnd      = "impersonation.end"
+	ActionImpersonationDenied   = "impersonation.denied"
+	ActionBookCreated           = "book.create"
+	ActionBookUpdated           = "book.update"
+	ActionBookDeleted           = "book.delete"
+	ActionBookRestored          = "book.restore"
+	ActionBookPurged            = "book.purge"
+	ActionBooksImported         = "book.import"
+	ActionBooksExported         = "book.export"
+	ActionCollaboratorAdded     = "book.collaborator_add"
+	ActionCollaboratorRemoved   = "book.collaborator_remove"
+	ActionBookAuthorsSet        = "book.authors_set"
+	ActionBookCoverUpdated      = "book.cover_update"
+	ActionBookCoverRemoved      = "book.cover_remove"
+	ActionAuthorCreated         = "author.create"
+	ActionAuthorUpdated         = "author.update"
+	ActionAuthorDeleted         = "author.delete"
+	ActionAuthorMerged          = "author.merge"
+	ActionBookTagged            = "book.tag_add"
+	ActionBookUntagged          = "book.tag_remove"
+	ActionCategoryCreated       = "category.create"
+	ActionCategoryUpdated       = "category.update"
+	ActionCategoryDeleted       = "category.delete"
+)
+
+// Event describes a single entry of the audit trail. Before and After are
+// diffed field by field; either may be nil for creations and deletions.
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   interface{}
+	Before     interface{}
+	After      interface{}
+
+	// Actor overrides the authenticated principal, e.g. for logins where the
+	// request is not authenticated yet. For service accounts the actor email
+	// holds the client ID.
+	ActorType  string
+	ActorID    *uint
+	ActorEmail string
+}
+
+// Record stores an audit event for the current request. The actor, client IP
+// and request ID are taken from the gin context when available; c may be nil
+// for background jobs. Failures are logged and never returned, auditing must
+// not break the request that triggered it.
+func Record(c *gin.Context, event Event) {
+	entry := models.AuditEvent{
+		ActorType:  types.PrincipalUser,
+		ActorID:    event.ActorID,
+		ActorEmail: event.ActorEmail,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+	}
+	if event.ActorType != "" {
+		entry.ActorType = event.ActorType
+	}
+	if event.TargetID != nil {
+		entry.TargetID = fmt.Sprint(event.TargetID)
+	}
+
+	if c == nil {
+		if event.ActorType == "" {
+			entry.ActorType = "system"
+		}
+	} else {
+		if value, ok := c.Get("principal"); ok && entry.ActorID == nil {
+			principal := value.(types.Principal)
+			entry.ActorType = principal.Type
+			entry.ActorID = &principal.ID
+			entry.ActorEmail = principal.Name
+		}
+		if value, ok := c.Get("impersonator"); ok {
+			impersonator := value.(types.User)
+			entry.ImpersonatorID = &impersonator.ID
+		}
+		entry.IP = c.ClientIP()
+		entry.RequestID = requestid.Get(c)
+	}
+
+	if event.Before != nil || event.After != nil {
+		changes, err := json.Marshal(Diff(event.Before, event.After))
+		if err != nil {
+			log.Printf("audit: failed to encode changes for %s: %v", event.Action, err)
+		} else {
+			entry.Changes = changes
+		}
+	}
+
+	if err := initializers.DB.Create(&entry).Error; err != nil {
+		log.Printf("audit: failed to record %s: %v", event.Action, err)
+	}
+}
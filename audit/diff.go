@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Change holds the previous and new value of a single field
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Diff compares the JSON representation of two values and returns the fields
+// that differ. A nil before or after yields every field of the other side.
+func Diff(before, after interface{}) map[string]Change {
+	from := toMap(before)
+	to := toMap(after)
+
+	changes := make(map[string]Change)
+	for field, oldValue := range from {
+		newValue, ok := to[field]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[field] = Change{From: oldValue, To: newValue}
+		}
+	}
+	for field, newValue := range to {
+		if _, ok := from[field]; !ok {
+			changes[field] = Change{To: newValue}
+		}
+	}
+	return changes
+}
+
+// toMap flattens a struct (or map) into its top-level JSON fields
+func toMap(value interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if value == nil {
+		return fields
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
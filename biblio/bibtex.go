@@ -0,0 +1,141 @@
+package biblio
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var keyCharacters = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// bibtexEscapes are the characters BibTeX treats specially
+var bibtexEscapes = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+)
+
+// bibtexWriter writes @book entries
+type bibtexWriter struct {
+	w io.Writer
+}
+
+// bibtexKey is the citation key of a record: the first author's last name,
+// the year and the book ID, e.g. tolkien1954-12
+func bibtexKey(r Record) string {
+	name := "book"
+	if authors := r.Names(RoleAuthor); len(authors) > 0 {
+		words := strings.Fields(authors[0])
+		name = words[len(words)-1]
+	}
+	// Drop accents so keys stay ASCII
+	var ascii strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		if !unicode.Is(unicode.Mn, r) {
+			ascii.WriteRune(r)
+		}
+	}
+	name = strings.ToLower(keyCharacters.ReplaceAllString(ascii.String(), ""))
+	if name == "" {
+		name = "book"
+	}
+	return fmt.Sprintf("%s%s-%d", name, r.Year(), r.ID)
+}
+
+func (bw *bibtexWriter) Write(r Record) error {
+	var entry strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&entry, "  %-9s = {%s},\n", name, bibtexEscapes.Replace(value))
+		}
+	}
+
+	fmt.Fprintf(&entry, "@book{%s,\n", bibtexKey(r))
+	title := r.Title
+	if r.Subtitle != "" {
+		title += ": " + r.Subtitle
+	}
+	field("title", title)
+	field("author", strings.Join(r.Names(RoleAuthor), " and "))
+	field("editor", strings.Join(r.Names(RoleEditor), " and "))
+	field("publisher", r.Publisher)
+	field("year", r.Year())
+	field("edition", r.Edition)
+	field("isbn", r.ISBN)
+	field("language", r.Language)
+	if r.PageCount > 0 {
+		field("pagetotal", strconv.Itoa(r.PageCount))
+	}
+	field("abstract", r.Description)
+	field("keywords", r.Category)
+	entry.WriteString("}\n\n")
+
+	_, err := io.WriteString(bw.w, entry.String())
+	return err
+}
+
+func (bw *bibtexWriter) Close() error {
+	return nil
+}
+
+// risWriter writes RIS records, one tagged line per value
+type risWriter struct {
+	w io.Writer
+}
+
+func (rw *risWriter) Write(r Record) error {
+	var entry strings.Builder
+	line := func(tag, value string) {
+		// A value must stay on its line
+		value = strings.Join(strings.Fields(value), " ")
+		if value != "" {
+			fmt.Fprintf(&entry, "%s  - %s\r\n", tag, value)
+		}
+	}
+
+	line("TY", "BOOK")
+	line("ID", strconv.Itoa(r.ID))
+	line("TI", r.Title)
+	line("T2", r.Subtitle)
+	for _, contributor := range r.Contributors {
+		switch contributor.Role {
+		case RoleAuthor:
+			line("AU", sortName(contributor))
+		case RoleEditor:
+			line("ED", sortName(contributor))
+		case RoleTranslator:
+			line("A4", sortName(contributor))
+		}
+	}
+	line("PB", r.Publisher)
+	line("PY", r.Year())
+	line("DA", r.PublicationDate)
+	line("ET", r.Edition)
+	line("SN", r.ISBN)
+	line("LA", r.Language)
+	if r.PageCount > 0 {
+		line("SP", strconv.Itoa(r.PageCount))
+	}
+	line("AB", r.Description)
+	line("KW", r.Category)
+	entry.WriteString("ER  - \r\n\r\n")
+
+	_, err := io.WriteString(rw.w, entry.String())
+	return err
+}
+
+func (rw *risWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package biblio
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// dcRecord is a simple Dublin Core record in the oai_dc schema
+type dcRecord struct {
+	XMLName     xml.Name `xml:"oai_dc:dc"`
+	Title       string   `xml:"dc:title"`
+	Creators    []string `xml:"dc:creator"`
+	Contributor []string `xml:"dc:contributor"`
+	Publisher   string   `xml:"dc:publisher,omitempty"`
+	Date        string   `xml:"dc:date,omitempty"`
+	Language    string   `xml:"dc:language,omitempty"`
+	Identifiers []string `xml:"dc:identifier"`
+	Description string   `xml:"dc:description,omitempty"`
+	Subject     string   `xml:"dc:subject,omitempty"`
+	Type        string   `xml:"dc:type"`
+	Format      string   `xml:"dc:format,omitempty"`
+}
+
+// dcWriter writes Dublin Core records inside a collection element that
+// declares the namespaces
+type dcWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+}
+
+func newDCWriter(w io.Writer) (*dcWriter, error) {
+	if _, err := io.WriteString(w, xml.Header+`<collection`+
+		` xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/"`+
+		` xmlns:dc="http://purl.org/dc/elements/1.1/">`+"\n"); err != nil {
+		return nil, err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return &dcWriter{w: w, encoder: encoder}, nil
+}
+
+func (dw *dcWriter) Write(r Record) error {
+	record := dcRecord{
+		Title:       r.Title,
+		Creators:    r.Names(RoleAuthor),
+		Publisher:   r.Publisher,
+		Date:        r.PublicationDate,
+		Language:    r.Language,
+		Description: r.Description,
+		Subject:     r.Category,
+		Type:        "Text",
+	}
+	if r.Subtitle != "" {
+		record.Title += ": " + r.Subtitle
+	}
+	for _, contributor := range r.Contributors {
+		if contributor.Role != RoleAuthor {
+			record.Contributor = append(record.Contributor, contributor.Name)
+		}
+	}
+	if r.ISBN != "" {
+		record.Identifiers = append(record.Identifiers, "urn:isbn:"+r.ISBN)
+	}
+	if r.PageCount > 0 {
+		record.Format = pages(r.PageCount)
+	}
+
+	if err := dw.encoder.Encode(record); err != nil {
+		return err
+	}
+	_, err := io.WriteString(dw.w, "\n")
+	return err
+}
+
+func (dw *dcWriter) Close() error {
+	_, err := io.WriteString(dw.w, "</collection>\n")
+	return err
+}
@@ -0,0 +1,630 @@
+package biblio
+
+import (
+	"authSystem/isbn"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ISO 2709 delimiters
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+const (
+	maxMARCRecordLength = 99999
+	maxMARCFieldLength  = 9999
+
+	// maxMARCValueLength is the longest single subfield value that fits a
+	// field next to its indicators, delimiter, code and terminator
+	maxMARCValueLength = maxMARCFieldLength - 5
+
+	// maxMARCDescriptionFields leaves most of a record for the description,
+	// which is cut beyond it
+	maxMARCDescriptionFields = 6
+)
+
+// marcDelimiters removes the ISO 2709 delimiters from user text, where they
+// would end a subfield, field or record early
+var marcDelimiters = strings.NewReplacer(
+	string(rune(subfieldDelimiter)), "",
+	string(rune(fieldTerminator)), "",
+	string(rune(recordTerminator)), "",
+)
+
+var (
+	yearPattern   = regexp.MustCompile(`\b(\d{4})\b`)
+	numberPattern = regexp.MustCompile(`\d+`)
+
+	// initialPattern matches a name ending in an initial, whose period stays
+	initialPattern = regexp.MustCompile(`(^|\s)\p{L}\.$`)
+)
+
+// RecordError is an error in a single record; reading can continue with the
+// next record
+type RecordError struct {
+	Position int
+	Err      error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Position, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// subfield is a coded piece of a data field
+type subfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// field is a MARC control field (tag below 010, Value set) or data field
+// (indicators and subfields)
+type field struct {
+	Tag       string
+	Ind1      string
+	Ind2      string
+	Value     string
+	Subfields []subfield
+}
+
+func (f field) control() bool {
+	return f.Tag < "010"
+}
+
+// first returns the first subfield with a code, trimmed of the ISBD
+// punctuation that ends it
+func (f field) first(code string) string {
+	return trimPunctuation(f.raw(code))
+}
+
+// raw returns the first subfield with a code as it is written
+func (f field) raw(code string) string {
+	for _, sub := range f.Subfields {
+		if sub.Code == code {
+			return sub.Value
+		}
+	}
+	return ""
+}
+
+func trimPunctuation(value string) string {
+	value = strings.TrimSpace(value)
+	for {
+		trimmed := strings.TrimSpace(strings.TrimRight(value, " :;/,="))
+		// A trailing period ends the field unless it ends an initial
+		if strings.HasSuffix(trimmed, ".") && !initialPattern.MatchString(trimmed) {
+			trimmed = strings.TrimSuffix(trimmed, ".")
+		}
+		if trimmed == value {
+			return value
+		}
+		value = trimmed
+	}
+}
+
+// dataField builds a data field from pairs of subfield codes and values,
+// leaving out empty values
+func dataField(tag, ind1, ind2 string, subfields ...string) field {
+	f := field{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for i := 0; i+1 < len(subfields); i += 2 {
+		if value := marcDelimiters.Replace(subfields[i+1]); value != "" {
+			f.Subfields = append(f.Subfields, subfield{Code: subfields[i], Value: value})
+		}
+	}
+	return f
+}
+
+// splitMARCValue cuts text into pieces of at most size bytes, between words
+// where it can and otherwise between characters
+func splitMARCValue(text string, size int) []string {
+	var pieces []string
+	for len(text) > size {
+		cut := len(truncateUTF8(text, size))
+		if space := strings.LastIndexAny(text[:cut], " \t\n"); space > cut/2 {
+			cut = space
+		}
+		pieces = append(pieces, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		pieces = append(pieces, text)
+	}
+	return pieces
+}
+
+// truncateUTF8 cuts text to at most size bytes without splitting a character
+func truncateUTF8(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	for size > 0 && !utf8.RuneStart(text[size]) {
+		size--
+	}
+	return text[:size]
+}
+
+// marcLeader is the leader of a new record for a printed book: new status,
+// language material, monograph, Unicode, ISBD punctuation
+func marcLeader() string {
+	return "00000nam a2200000 i 4500"
+}
+
+// marcFields describes a record as MARC 21 fields in tag order
+func marcFields(r Record) []field {
+	updated := r.UpdatedAt
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	// 008: fixed-length data elements for books
+	fixed := []byte(strings.Repeat(" ", 40))
+	copy(fixed[0:], updated.UTC().Format("060102"))
+	if year := r.Year(); year != "" {
+		copy(fixed[6:], "s"+year)
+	} else {
+		copy(fixed[6:], "n    ")
+	}
+	copy(fixed[15:], "xx ")
+	if code := marcLanguage(r.Language); code != "" {
+		copy(fixed[35:], code)
+	} else {
+		copy(fixed[35:], "und")
+	}
+	fixed[39] = 'd'
+
+	fields := []field{
+		{Tag: "001", Value: strconv.Itoa(r.ID)},
+		{Tag: "005", Value: updated.UTC().Format("20060102150405") + ".0"},
+		{Tag: "008", Value: string(fixed)},
+	}
+
+	if r.ISBN != "" {
+		fields = append(fields, dataField("020", " ", " ", "a", r.ISBN))
+		if isbn10, ok := isbn.To10(r.ISBN); ok {
+			fields = append(fields, dataField("020", " ", " ", "a", isbn10))
+		}
+	}
+	if code := marcLanguage(r.Language); code != "" {
+		fields = append(fields, dataField("041", "0", " ", "a", code))
+	}
+
+	// The first author is the main entry, everyone else an added entry
+	var main *Contributor
+	var added []Contributor
+	for i, contributor := range r.Contributors {
+		if main == nil && contributor.Role == RoleAuthor {
+			main = &r.Contributors[i]
+			continue
+		}
+		added = append(added, contributor)
+	}
+	if main != nil {
+		fields = append(fields, dataField("100", "1", " ", "a", sortName(*main)+",", "e", main.Role+"."))
+	}
+
+	titleIndicator := "0"
+	if main != nil {
+		titleIndicator = "1"
+	}
+	title := field{Tag: "245", Ind1: titleIndicator, Ind2: "0", Subfields: []subfield{{Code: "a", Value: marcDelimiters.Replace(r.Title)}}}
+	if subtitle := marcDelimiters.Replace(r.Subtitle); subtitle != "" {
+		title.Subfields[0].Value += " :"
+		title.Subfields = append(title.Subfields, subfield{Code: "b", Value: subtitle})
+	}
+	if authors := r.Names(RoleAuthor); len(authors) > 0 {
+		title.Subfields[len(title.Subfields)-1].Value += " /"
+		title.Subfields = append(title.Subfields, subfield{Code: "c", Value: marcDelimiters.Replace(strings.Join(authors, ", ")) + "."})
+	} else {
+		title.Subfields[len(title.Subfields)-1].Value += "."
+	}
+	fields = append(fields, title)
+
+	if r.Edition != "" {
+		fields = append(fields, dataField("250", " ", " ", "a", r.Edition))
+	}
+	if r.Publisher != "" || r.PublicationDate != "" {
+		fields = append(fields, dataField("264", " ", "1", "b", r.Publisher, "c", r.Year()))
+	}
+	if r.PageCount > 0 {
+		fields = append(fields, dataField("300", " ", " ", "a", pages(r.PageCount)))
+	}
+	// A description too long for one field is continued in repeated 520s
+	summaries := splitMARCValue(marcDelimiters.Replace(r.Description), maxMARCValueLength)
+	if len(summaries) > maxMARCDescriptionFields {
+		summaries = summaries[:maxMARCDescriptionFields]
+	}
+	for _, piece := range summaries {
+		fields = append(fields, dataField("520", " ", " ", "a", piece))
+	}
+	if r.Category != "" {
+		fields = append(fields, dataField("650", " ", "4", "a", r.Category))
+	}
+	for _, contributor := range added {
+		fields = append(fields, dataField("700", "1", " ", "a", sortName(contributor)+",", "e", contributor.Role+"."))
+	}
+	return fields
+}
+
+func sortName(contributor Contributor) string {
+	if contributor.SortName != "" {
+		return contributor.SortName
+	}
+	return contributor.Name
+}
+
+// recordFromMARC reads the book fields of a MARC record. Names in 100 and
+// 700 fields are taken as written, usually inverted; local subject headings
+// (650 with second indicator 4) are read as the category.
+func recordFromMARC(leader string, fields []field) (Record, error) {
+	if len(leader) == 24 && leader[9] != 'a' {
+		return Record{}, errors.New("MARC-8 encoded records are not supported, convert them to Unicode")
+	}
+
+	var r Record
+	var fixed string
+	var summaries []string
+	for _, f := range fields {
+		switch f.Tag {
+		case "001":
+			if id, err := strconv.Atoi(strings.TrimSpace(f.Value)); err == nil {
+				r.ID = id
+			}
+		case "008":
+			fixed = f.Value
+		case "020":
+			// Qualifiers like "(paperback)" follow the number
+			if number := strings.Fields(f.first("a")); r.ISBN == "" && len(number) > 0 {
+				if normalized, err := isbn.Normalize(number[0]); err == nil {
+					r.ISBN = normalized
+				}
+			}
+		case "041":
+			if r.Language == "" {
+				r.Language = languageTag(f.first("a"))
+			}
+		case "100", "700":
+			name := f.first("a")
+			if name == "" {
+				continue
+			}
+			role := RoleAuthor
+			relator := strings.ToLower(f.first("e") + f.first("4"))
+			switch {
+			case strings.HasPrefix(relator, "ed"):
+				role = RoleEditor
+			case strings.HasPrefix(relator, "tr"):
+				role = RoleTranslator
+			}
+			r.Contributors = append(r.Contributors, Contributor{Name: name, SortName: name, Role: role})
+		case "245":
+			r.Title = f.first("a")
+			r.Subtitle = f.first("b")
+		case "250":
+			// Editions end in abbreviations like "ed.", so the period stays
+			r.Edition = strings.TrimSpace(strings.TrimRight(f.raw("a"), " :;/,="))
+		case "260", "264":
+			if f.Tag == "264" && f.Ind2 != "1" {
+				continue
+			}
+			if r.Publisher == "" {
+				r.Publisher = f.first("b")
+			}
+			if year := yearPattern.FindString(f.first("c")); year != "" && r.PublicationDate == "" {
+				r.PublicationDate = year
+			}
+		case "300":
+			if count, err := strconv.Atoi(numberPattern.FindString(f.first("a"))); err == nil {
+				r.PageCount = count
+			}
+		case "520":
+			summaries = append(summaries, strings.TrimSpace(f.raw("a")))
+		case "650":
+			if f.Ind2 == "4" && r.Category == "" {
+				r.Category = f.first("a")
+			}
+		}
+	}
+
+	r.Description = trimPunctuation(strings.Join(summaries, " "))
+
+	if len(fixed) == 40 {
+		if r.PublicationDate == "" && yearPattern.MatchString(fixed[7:11]) {
+			r.PublicationDate = fixed[7:11]
+		}
+		if r.Language == "" {
+			r.Language = languageTag(fixed[35:38])
+		}
+	}
+	if r.Title == "" {
+		return r, errors.New("record has no title (245 $a)")
+	}
+	return r, nil
+}
+
+// marcWriter writes binary MARC 21 records (ISO 2709)
+type marcWriter struct {
+	w io.Writer
+}
+
+func (mw *marcWriter) Write(r Record) error {
+	data, err := encodeMARC(marcFields(r))
+	if err != nil {
+		return err
+	}
+	_, err = mw.w.Write(data)
+	return err
+}
+
+func (mw *marcWriter) Close() error {
+	return nil
+}
+
+// encodeMARC lays out fields as an ISO 2709 record: leader, directory of
+// tag, length and offset per field, then the fields themselves
+func encodeMARC(fields []field) ([]byte, error) {
+	var directory, data bytes.Buffer
+	for _, f := range fields {
+		start := data.Len()
+		if f.control() {
+			data.WriteString(f.Value)
+		} else {
+			data.WriteString(f.Ind1 + f.Ind2)
+			for _, sub := range f.Subfields {
+				data.WriteByte(subfieldDelimiter)
+				data.WriteString(sub.Code + sub.Value)
+			}
+		}
+		data.WriteByte(fieldTerminator)
+		length := data.Len() - start
+		if length > maxMARCFieldLength {
+			return nil, fmt.Errorf("field %s is longer than %d bytes", f.Tag, maxMARCFieldLength)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", f.Tag, length, start)
+	}
+	directory.WriteByte(fieldTerminator)
+	data.WriteByte(recordTerminator)
+
+	base := 24 + directory.Len()
+	total := base + data.Len()
+	if total > maxMARCRecordLength {
+		return nil, fmt.Errorf("record is longer than %d bytes", maxMARCRecordLength)
+	}
+
+	leader := []byte(marcLeader())
+	copy(leader[0:], fmt.Sprintf("%05d", total))
+	copy(leader[12:], fmt.Sprintf("%05d", base))
+
+	record := make([]byte, 0, total)
+	record = append(record, leader...)
+	record = append(record, directory.Bytes()...)
+	return append(record, data.Bytes()...), nil
+}
+
+// MARCReader reads binary MARC 21 records one at a time
+type MARCReader struct {
+	r        io.Reader
+	position int
+}
+
+func NewMARCReader(r io.Reader) *MARCReader {
+	return &MARCReader{r: r}
+}
+
+// Next returns the next record, io.EOF after the last one, a *RecordError
+// for a record that can't be imported and any other error when the stream
+// can't be read further
+func (mr *MARCReader) Next() (Record, error) {
+	leader := make([]byte, 24)
+	if _, err := io.ReadFull(mr.r, leader); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Record{}, errors.New("truncated MARC record")
+		}
+		return Record{}, err
+	}
+	mr.position++
+
+	length, ok := marcNumber(leader[0:5])
+	if !ok || length < 25 {
+		return Record{}, fmt.Errorf("record %d: invalid record length %q", mr.position, leader[0:5])
+	}
+	body := make([]byte, length-24)
+	if _, err := io.ReadFull(mr.r, body); err != nil {
+		return Record{}, fmt.Errorf("record %d: truncated MARC record", mr.position)
+	}
+
+	fields, err := decodeMARC(leader, body)
+	if err != nil {
+		return Record{}, &RecordError{Position: mr.position, Err: err}
+	}
+	record, err := recordFromMARC(string(leader), fields)
+	if err != nil {
+		return Record{}, &RecordError{Position: mr.position, Err: err}
+	}
+	return record, nil
+}
+
+// Position is the number of the last record read, starting at 1
+func (mr *MARCReader) Position() int {
+	return mr.position
+}
+
+// marcNumber reads a fixed-width number of the leader or directory, which
+// has to be all ASCII digits; strconv.Atoi would also take signs
+func marcNumber(digits []byte) (int, bool) {
+	n := 0
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return 0, false
+		}
+		n = n*10 + int(digit-'0')
+	}
+	return n, len(digits) > 0
+}
+
+func decodeMARC(leader, body []byte) ([]field, error) {
+	base, ok := marcNumber(leader[12:17])
+	if !ok || base < 25 || base-24 > len(body) {
+		return nil, fmt.Errorf("invalid base address %q", leader[12:17])
+	}
+	if !utf8.Valid(body) {
+		return nil, errors.New("record is not valid UTF-8")
+	}
+
+	directory := body[:base-24-1]
+	data := body[base-24:]
+	if len(directory)%12 != 0 {
+		return nil, errors.New("invalid directory")
+	}
+
+	var fields []field
+	for i := 0; i < len(directory); i += 12 {
+		entry := directory[i : i+12]
+		length, ok1 := marcNumber(entry[3:7])
+		start, ok2 := marcNumber(entry[7:12])
+		if !ok1 || !ok2 || start+length > len(data) || length < 1 {
+			return nil, fmt.Errorf("invalid directory entry %q", entry)
+		}
+
+		f := field{Tag: string(entry[0:3])}
+		content := string(bytes.TrimRight(data[start:start+length], string([]byte{fieldTerminator})))
+		if f.control() {
+			f.Value = content
+		} else {
+			parts := strings.Split(content, string([]byte{subfieldDelimiter}))
+			if len(parts[0]) >= 2 {
+				f.Ind1, f.Ind2 = parts[0][0:1], parts[0][1:2]
+			}
+			for _, part := range parts[1:] {
+				if part != "" {
+					f.Subfields = append(f.Subfields, subfield{Code: part[:1], Value: part[1:]})
+				}
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// MARCXML elements, for reading and writing
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string     `xml:"tag,attr"`
+	Ind1      string     `xml:"ind1,attr"`
+	Ind2      string     `xml:"ind2,attr"`
+	Subfields []subfield `xml:"subfield"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+const marcNamespace = "http://www.loc.gov/MARC21/slim"
+
+// marcXMLWriter writes a MARCXML collection
+type marcXMLWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+}
+
+func newMARCXMLWriter(w io.Writer) (*marcXMLWriter, error) {
+	if _, err := io.WriteString(w, xml.Header+`<collection xmlns="`+marcNamespace+`">`+"\n"); err != nil {
+		return nil, err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return &marcXMLWriter{w: w, encoder: encoder}, nil
+}
+
+func (mw *marcXMLWriter) Write(r Record) error {
+	record := xmlRecord{Leader: marcLeader()}
+	for _, f := range marcFields(r) {
+		if f.control() {
+			record.ControlFields = append(record.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+		} else {
+			record.DataFields = append(record.DataFields, xmlDataField{Tag: f.Tag, Ind1: f.Ind1, Ind2: f.Ind2, Subfields: f.Subfields})
+		}
+	}
+	if err := mw.encoder.Encode(record); err != nil {
+		return err
+	}
+	_, err := io.WriteString(mw.w, "\n")
+	return err
+}
+
+func (mw *marcXMLWriter) Close() error {
+	_, err := io.WriteString(mw.w, "</collection>\n")
+	return err
+}
+
+// MARCXMLReader reads the records of a MARCXML document, a collection or a
+// single record, one at a time
+type MARCXMLReader struct {
+	decoder  *xml.Decoder
+	position int
+}
+
+func NewMARCXMLReader(r io.Reader) *MARCXMLReader {
+	return &MARCXMLReader{decoder: xml.NewDecoder(r)}
+}
+
+// Next returns the next record, io.EOF after the last one, a *RecordError
+// for a record that can't be imported and any other error when the document
+// can't be read further
+func (mr *MARCXMLReader) Next() (Record, error) {
+	for {
+		token, err := mr.decoder.Token()
+		if err != nil {
+			return Record{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		mr.position++
+
+		var record xmlRecord
+		if err := mr.decoder.DecodeElement(&record, &start); err != nil {
+			return Record{}, fmt.Errorf("record %d: %w", mr.position, err)
+		}
+
+		var fields []field
+		for _, f := range record.ControlFields {
+			fields = append(fields, field{Tag: f.Tag, Value: f.Value})
+		}
+		for _, f := range record.DataFields {
+			fields = append(fields, field{Tag: f.Tag, Ind1: f.Ind1, Ind2: f.Ind2, Subfields: f.Subfields})
+		}
+
+		result, err := recordFromMARC(record.Leader, fields)
+		if err != nil {
+			return Record{}, &RecordError{Position: mr.position, Err: err}
+		}
+		return result, nil
+	}
+}
+
+// Position is the number of the last record read, starting at 1
+func (mr *MARCXMLReader) Position() int {
+	return mr.position
+}
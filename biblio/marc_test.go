@@ -0,0 +1,259 @@
+package biblio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func testRecord() Record {
+	return Record{
+		ID:              42,
+		Title:           "The Hobbit",
+		Subtitle:        "or There and Back Again",
+		Contributors:    []Contributor{{Name: "J. R. R. Tolkien", SortName: "Tolkien, J. R. R.", Role: RoleAuthor}},
+		Publisher:       "George Allen & Unwin",
+		PublicationDate: "1937-09-21",
+		Language:        "en",
+		ISBN:            "9780261102217",
+		PageCount:       310,
+		UpdatedAt:       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func encodeTestRecord(t *testing.T) []byte {
+	t.Helper()
+	data, err := encodeMARC(marcFields(testRecord()))
+	if err != nil {
+		t.Fatalf("encodeMARC() error = %v", err)
+	}
+	return data
+}
+
+func TestMARCRoundTrip(t *testing.T) {
+	record, err := NewMARCReader(bytes.NewReader(encodeTestRecord(t))).Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+
+	want := testRecord()
+	if record.ID != want.ID || record.Title != want.Title || record.Subtitle != want.Subtitle ||
+		record.Publisher != want.Publisher || record.ISBN != want.ISBN || record.PageCount != want.PageCount ||
+		record.Language != want.Language || record.PublicationDate != "1937" {
+		t.Errorf("Next() = %+v, want %+v", record, want)
+	}
+	if names := record.Names(RoleAuthor); len(names) != 1 || names[0] != "Tolkien, J. R. R." {
+		t.Errorf("authors = %v, want [Tolkien, J. R. R.]", names)
+	}
+}
+
+func TestMARCReaderRejectsMalformedRecords(t *testing.T) {
+	// Offsets into a record: the record length and base address of the
+	// leader, the length and start of the first directory entry
+	const (
+		recordLength = 0
+		baseAddress  = 12
+		entryLength  = 24 + 3
+		entryStart   = 24 + 7
+	)
+
+	tests := []struct {
+		name string
+		// change corrupts a valid record
+		change func(data []byte) []byte
+		// recordError is whether reading can go on with the next record
+		recordError bool
+	}{
+		{
+			name:   "truncated leader",
+			change: func(data []byte) []byte { return data[:10] },
+		},
+		{
+			name:   "truncated body",
+			change: func(data []byte) []byte { return data[:len(data)-5] },
+		},
+		{
+			name:   "negative record length",
+			change: func(data []byte) []byte { copy(data[recordLength:], "-0100"); return data },
+		},
+		{
+			name:   "record length with a plus sign",
+			change: func(data []byte) []byte { copy(data[recordLength:], "+0100"); return data },
+		},
+		{
+			name:   "record length shorter than the leader",
+			change: func(data []byte) []byte { copy(data[recordLength:], "00024"); return data },
+		},
+		{
+			name:        "negative base address",
+			change:      func(data []byte) []byte { copy(data[baseAddress:], "-0001"); return data },
+			recordError: true,
+		},
+		{
+			name:        "base address with spaces",
+			change:      func(data []byte) []byte { copy(data[baseAddress:], "  100"); return data },
+			recordError: true,
+		},
+		{
+			name:        "base address inside the leader",
+			change:      func(data []byte) []byte { copy(data[baseAddress:], "00010"); return data },
+			recordError: true,
+		},
+		{
+			name:        "base address past the record",
+			change:      func(data []byte) []byte { copy(data[baseAddress:], "99999"); return data },
+			recordError: true,
+		},
+		{
+			name:        "base address inside a directory entry",
+			change:      func(data []byte) []byte { copy(data[baseAddress:], "00030"); return data },
+			recordError: true,
+		},
+		{
+			name:        "negative field start",
+			change:      func(data []byte) []byte { copy(data[entryStart:], "-0001"); return data },
+			recordError: true,
+		},
+		{
+			name:        "field start with a plus sign",
+			change:      func(data []byte) []byte { copy(data[entryStart:], "+0001"); return data },
+			recordError: true,
+		},
+		{
+			name:        "negative field length",
+			change:      func(data []byte) []byte { copy(data[entryLength:], "-001"); return data },
+			recordError: true,
+		},
+		{
+			name:        "empty field",
+			change:      func(data []byte) []byte { copy(data[entryLength:], "0000"); return data },
+			recordError: true,
+		},
+		{
+			name:        "field start past the data",
+			change:      func(data []byte) []byte { copy(data[entryStart:], "99999"); return data },
+			recordError: true,
+		},
+		{
+			name:        "field length past the data",
+			change:      func(data []byte) []byte { copy(data[entryLength:], "9999"); return data },
+			recordError: true,
+		},
+		{
+			name:        "invalid UTF-8",
+			change:      func(data []byte) []byte { data[len(data)-3] = 0xFF; return data },
+			recordError: true,
+		},
+		{
+			name:        "MARC-8 encoding",
+			change:      func(data []byte) []byte { data[9] = ' '; return data },
+			recordError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.change(encodeTestRecord(t))
+			_, err := NewMARCReader(bytes.NewReader(data)).Next()
+			if err == nil {
+				t.Fatal("Next() error = nil, want an error")
+			}
+			var recordErr *RecordError
+			if errors.As(err, &recordErr) != tt.recordError {
+				t.Errorf("Next() error = %v, record error = %v, want %v", err, !tt.recordError, tt.recordError)
+			}
+		})
+	}
+}
+
+func TestMARCReaderContinuesAfterRecordError(t *testing.T) {
+	bad := encodeTestRecord(t)
+	copy(bad[24+7:], "-0001")
+	stream := append(bad, encodeTestRecord(t)...)
+
+	reader := NewMARCReader(bytes.NewReader(stream))
+	var recordErr *RecordError
+	if _, err := reader.Next(); !errors.As(err, &recordErr) || recordErr.Position != 1 {
+		t.Fatalf("Next() error = %v, want a RecordError for record 1", err)
+	}
+	record, err := reader.Next()
+	if err != nil || record.Title != "The Hobbit" {
+		t.Fatalf("Next() = %q, %v, want the second record", record.Title, err)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next() error = %v, want io.EOF", err)
+	}
+}
+
+func TestMARCWriterSplitsLongDescriptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		fields      int
+		roundTrips  bool
+	}{
+		{name: "words", description: strings.TrimSpace(strings.Repeat("a long summary ", 2000)), fields: 4, roundTrips: true},
+		{name: "no spaces", description: strings.Repeat("é", 12000), fields: 3},
+		{name: "beyond the record limit", description: strings.Repeat("word ", 30000), fields: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := testRecord()
+			record.Description = tt.description
+
+			fields := marcFields(record)
+			var summaries []string
+			for _, f := range fields {
+				if f.Tag == "520" {
+					summaries = append(summaries, f.raw("a"))
+				}
+			}
+			if len(summaries) != tt.fields {
+				t.Errorf("520 fields = %d, want %d", len(summaries), tt.fields)
+			}
+			for _, summary := range summaries {
+				if len(summary) > maxMARCValueLength || !utf8.ValidString(summary) {
+					t.Errorf("520 $a of %d bytes, valid UTF-8 %v", len(summary), utf8.ValidString(summary))
+				}
+			}
+
+			data, err := encodeMARC(fields)
+			if err != nil {
+				t.Fatalf("encodeMARC() error = %v", err)
+			}
+			read, err := NewMARCReader(bytes.NewReader(data)).Next()
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if tt.roundTrips && read.Description != tt.description {
+				t.Errorf("description of %d bytes read back as %d bytes", len(tt.description), len(read.Description))
+			}
+		})
+	}
+}
+
+func TestMARCWriterStripsDelimiters(t *testing.T) {
+	record := testRecord()
+	record.Title = "The\x1dHobbit"
+	record.Subtitle = "or There\x1e and Back Again"
+	record.Publisher = "George Allen\x1f & Unwin"
+	record.Description = "\x1f\x1e\x1d"
+
+	data, err := encodeMARC(marcFields(record))
+	if err != nil {
+		t.Fatalf("encodeMARC() error = %v", err)
+	}
+	read, err := NewMARCReader(bytes.NewReader(data)).Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if read.Title != "TheHobbit" || read.Subtitle != "or There and Back Again" ||
+		read.Publisher != "George Allen & Unwin" || read.Description != "" || read.ISBN != record.ISBN {
+		t.Errorf("Next() = %+v", read)
+	}
+}
@@ -0,0 +1,167 @@
+// Package biblio converts books to and from the record formats libraries
+// exchange: MARC 21 (binary ISO 2709 and MARCXML), Dublin Core, BibTeX and
+// RIS.
+package biblio
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// Roles of contributors, matching the roles of book credits
+const (
+	RoleAuthor     = "author"
+	RoleEditor     = "editor"
+	RoleTranslator = "translator"
+)
+
+// Formats records can be written in
+const (
+	FormatMARCXML = "marcxml"
+	FormatMARC    = "marc"
+	FormatDC      = "dc"
+	FormatBibTeX  = "bibtex"
+	FormatRIS     = "ris"
+)
+
+// Media types of the formats, used for content negotiation
+var MediaTypes = map[string]string{
+	FormatMARCXML: "application/marcxml+xml",
+	FormatMARC:    "application/marc",
+	FormatDC:      "application/dc+xml",
+	FormatBibTeX:  "application/x-bibtex",
+	FormatRIS:     "application/x-research-info-systems",
+}
+
+// Extensions of the formats for file names
+var Extensions = map[string]string{
+	FormatMARCXML: ".xml",
+	FormatMARC:    ".mrc",
+	FormatDC:      ".xml",
+	FormatBibTeX:  ".bib",
+	FormatRIS:     ".ris",
+}
+
+// Contributor is a person credited on a record; SortName is the inverted
+// form, e.g. "Tolkien, J. R. R."
+type Contributor struct {
+	Name     string
+	SortName string
+	Role     string
+}
+
+// Record is the bibliographic description of a book that every format is
+// written from and MARC records are read into
+type Record struct {
+	ID              int
+	Title           string
+	Subtitle        string
+	Contributors    []Contributor
+	Publisher       string
+	PublicationDate string
+	Language        string
+	ISBN            string
+	Edition         string
+	PageCount       int
+	Description     string
+	Category        string
+	UpdatedAt       time.Time
+}
+
+// Names returns the names of the contributors in a role
+func (r Record) Names(role string) []string {
+	var names []string
+	for _, contributor := range r.Contributors {
+		if contributor.Role == role {
+			names = append(names, contributor.Name)
+		}
+	}
+	return names
+}
+
+// Year returns the year of publication, if known
+func (r Record) Year() string {
+	if len(r.PublicationDate) >= 4 {
+		return r.PublicationDate[:4]
+	}
+	return ""
+}
+
+// pages describes the extent of a book
+func pages(count int) string {
+	return strconv.Itoa(count) + " pages"
+}
+
+// Writer writes a set of records in a format; Close completes the output
+type Writer interface {
+	Write(record Record) error
+	Close() error
+}
+
+// NewWriter returns a writer of records in format to w
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatMARCXML:
+		return newMARCXMLWriter(w)
+	case FormatMARC:
+		return &marcWriter{w: w}, nil
+	case FormatDC:
+		return newDCWriter(w)
+	case FormatBibTeX:
+		return &bibtexWriter{w: w}, nil
+	case FormatRIS:
+		return &risWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("format must be marcxml, marc, dc, bibtex or ris")
+}
+
+// bibliographicCodes are the ISO 639-2 bibliographic codes MARC uses where
+// they differ from the terminology codes
+var bibliographicCodes = map[string]string{
+	"bod": "tib", "ces": "cze", "cym": "wel", "deu": "ger", "ell": "gre",
+	"eus": "baq", "fas": "per", "fra": "fre", "hye": "arm", "isl": "ice",
+	"kat": "geo", "mkd": "mac", "mri": "mao", "msa": "may", "mya": "bur",
+	"nld": "dut", "ron": "rum", "slk": "slo", "sqi": "alb", "zho": "chi",
+}
+
+// marcLanguage returns the MARC language code of a BCP 47 tag, "" if unknown
+func marcLanguage(tag string) string {
+	if tag == "" {
+		return ""
+	}
+	base, err := language.ParseBase(strings.SplitN(tag, "-", 2)[0])
+	if err != nil {
+		return ""
+	}
+	code := base.ISO3()
+	if bibliographic, ok := bibliographicCodes[code]; ok {
+		return bibliographic
+	}
+	return code
+}
+
+// languageTag returns the BCP 47 tag of a MARC language code, "" if unknown
+// or not a single language
+func languageTag(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	switch code {
+	case "", "und", "mul", "zxx", "|||":
+		return ""
+	}
+	for terminology, bibliographic := range bibliographicCodes {
+		if code == bibliographic {
+			code = terminology
+			break
+		}
+	}
+	base, err := language.ParseBase(code)
+	if err != nil {
+		return ""
+	}
+	return base.String()
+}
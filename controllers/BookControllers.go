@@ -1,9 +1,19 @@
 package controllers
 
 import (
+	"authSystem/audit"
+	"authSystem/credits"
 	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/patch"
+	"authSystem/policy"
 	"authSystem/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 
@@ -11,6 +21,43 @@ import (
 	"gorm.io/gorm"
 )
 
+// errAborted aborts a transaction after the request has already been
+// answered, e.g. by authorizeBook
+var errAborted = errors.New("request aborted")
+
+// errBookChanged reports that a book was updated concurrently
+var errBookChanged = errors.New("book has been modified")
+
+// visibleBooks scopes a book query to the active organization plus, for
+// users, the books shared with them from other organizations. Whether the
+// caller may act on a particular book is still up to the policies.
+func visibleBooks(c *gin.Context, db *gorm.DB) *gorm.DB {
+	orgID, _ := activeOrganizationID(c)
+	if user, ok := requestUser(c); ok {
+		return db.Where("organization_id = ? OR id IN (?)", orgID,
+			initializers.DB.Model(&models.BookCollaborator{}).Select("book_id").Where("user_id = ?", user.ID))
+	}
+	return db.Where("organization_id = ?", orgID)
+}
+
+// requestUser returns the human user behind the request, if any
+func requestUser(c *gin.Context) (types.User, bool) {
+	value, ok := c.Get("user")
+	if !ok {
+		return types.User{}, false
+	}
+	return value.(types.User), true
+}
+
+// requestUserID returns the ID recorded as creator or last editor of a book;
+// service accounts leave it empty
+func requestUserID(c *gin.Context) *uint {
+	if user, ok := requestUser(c); ok {
+		return &user.ID
+	}
+	return nil
+}
+
 type BookController struct{}
 
 func NewBookController() *BookController {
@@ -19,34 +66,27 @@ func NewBookController() *BookController {
 
 // GetAllBooks returns a paginated list of books with filtering options
 func (bc *BookController) GetAllBooks(c *gin.Context) {
-	// Parse pagination parameters with defaults and validation
-	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
-	if err != nil || page < 1 {
-		page = 1
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
 	}
 
-	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	if err != nil || limit < 1 || limit > 50 { // Enforce reasonable limit
-		limit = 10
+	// Parse pagination and sorting parameters
+	paging, err := newPaginator(c, bookSortKeys, "id", 10, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
 	}
-	offset := (page - 1) * limit
-
-	// Parse filter parameters
-	title := strings.TrimSpace(c.Query("title"))
-	author := strings.TrimSpace(c.Query("author"))
-	category := strings.TrimSpace(c.Query("category"))
 
 	// Build query
-	query := initializers.DB.Model(&types.Book{})
-
-	if title != "" {
-		query = query.Where("LOWER(title) LIKE ?", "%"+strings.ToLower(title)+"%")
-	}
-	if author != "" {
-		query = query.Where("LOWER(author) LIKE ?", "%"+strings.ToLower(author)+"%")
-	}
-	if category != "" {
-		query = query.Where("LOWER(category) LIKE ?", "%"+strings.ToLower(category)+"%")
+	query, _, err := filterBooks(c, initializers.DB.Model(&types.Book{}).Where("organization_id = ?", orgID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search query",
+			"details": err.Error(),
+		})
+		return
 	}
 
 	// Get total count for pagination
@@ -61,7 +101,7 @@ func (bc *BookController) GetAllBooks(c *gin.Context) {
 
 	// Execute query with pagination
 	var books []types.Book
-	if err := query.Offset(offset).Limit(limit).Find(&books).Error; err != nil {
+	if err := paging.Apply(query).Find(&books).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to fetch books",
 			"details": err.Error(),
@@ -71,17 +111,17 @@ func (bc *BookController) GetAllBooks(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": books,
-		"meta": gin.H{
-			"page":       page,
-			"limit":      limit,
-			"total":      total,
-			"totalPages": (int(total) + limit - 1) / limit,
-		},
+		"meta": paging.Finish(c, &books, total),
 	})
 }
 
 // GetBookByID returns a single book by ID
 func (bc *BookController) GetBookByID(c *gin.Context) {
+	if _, ok := activeOrganizationID(c); !ok {
+		abortNoOrganization(c)
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -100,7 +140,7 @@ func (bc *BookController) GetBookByID(c *gin.Context) {
 	}
 
 	var book types.Book
-	if err := initializers.DB.First(&book, bookID).Error; err != nil {
+	if err := visibleBooks(c, initializers.DB).First(&book, bookID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 				"error": "Book not found",
@@ -114,64 +154,205 @@ func (bc *BookController) GetBookByID(c *gin.Context) {
 		return
 	}
 
+	if !authorizeBook(c, policy.ActionBookRead, book) {
+		return
+	}
+
+	// Bibliographic formats can be asked for with Accept
+	format := negotiateBookFormat(c)
+	etag := bookETag(book)
+	if format != "" {
+		etag = fmt.Sprintf(`"%d-%s"`, book.Version, format)
+	}
+	c.Header("Vary", "Accept")
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if format != "" {
+		writeBookRecordResponse(c, book, format, false)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"data": book,
 	})
 }
 
-// CreateBook creates a new book record
-func (bc *BookController) CreateBook(c *gin.Context) {
-	var req types.AddBookRequest
+// bookETag identifies the current version of a book
+func bookETag(book types.Book) string {
+	return fmt.Sprintf(`"%d"`, book.Version)
+}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request body",
-			"details": err.Error(),
-		})
-		return
+// etagMatches reports whether an If-Match or If-None-Match header lists etag
+// or is "*". If-None-Match compares weakly, ignoring W/ prefixes.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
 	}
+	return false
+}
+
+// requireIfMatch is set with BOOK_REQUIRE_IF_MATCH to reject changes to books
+// that don't name the version they are based on
+func requireIfMatch() bool {
+	required, _ := strconv.ParseBool(os.Getenv("BOOK_REQUIRE_IF_MATCH"))
+	return required
+}
+
+// checkIfMatch enforces the If-Match precondition of a change to book and
+// aborts with 412 when the book has changed since the client read it
+func checkIfMatch(c *gin.Context, book types.Book) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if requireIfMatch() {
+			c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{
+				"error": "If-Match header is required",
+			})
+			return false
+		}
+		return true
+	}
+
+	if !etagMatches(header, bookETag(book), false) {
+		abortBookChanged(c, book)
+		return false
+	}
+	return true
+}
+
+// abortBookChanged rejects a change based on an outdated version of book
+func abortBookChanged(c *gin.Context, book types.Book) {
+	c.Header("ETag", bookETag(book))
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{
+		"error":   "Book has been modified",
+		"details": fmt.Sprintf("The current version is %d", book.Version),
+	})
+}
 
+// validateBook runs the checks every created or edited book must pass and
+// aborts the request when one fails: title and author are required, the
+// metadata must be well-formed and is normalized in place, the category must
+// be one of the organization's categories, and books are
+// unique within the organization by ISBN, or by title when they have none.
+// excludeID is the book being edited, 0 when creating.
+func validateBook(c *gin.Context, book *types.Book, excludeID int) bool {
 	// Validate required fields
-	if strings.TrimSpace(req.Title) == "" {
+	if strings.TrimSpace(book.Title) == "" {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error": "Title is required",
 		})
-		return
+		return false
 	}
 
-	if strings.TrimSpace(req.Author) == "" {
+	if strings.TrimSpace(book.Author) == "" {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error": "Author is required",
 		})
-		return
+		return false
 	}
 
-	// Normalize title for case-insensitive duplicate check
-	normalizedTitle := strings.ToLower(strings.TrimSpace(req.Title))
+	if err := normalizeBookMetadata(book); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid book metadata",
+			"details": err.Error(),
+		})
+		return false
+	}
 
-	// Check for existing book with same title
+	if !resolveBookCategory(c, book) {
+		return false
+	}
+
+	// Check for an existing book with the same ISBN, or the same title when
+	// there is no ISBN, in the organization. Trashed books don't count,
+	// restoring one runs this check again.
 	var existingBook types.Book
-	if err := initializers.DB.Where("LOWER(TRIM(title)) = ?", normalizedTitle).First(&existingBook).Error; err == nil {
+	query := initializers.DB.Where("organization_id = ? AND id != ?", book.OrganizationID, excludeID)
+	conflict := "A book with this title already exists"
+	if book.ISBN != "" {
+		query = query.Where("isbn = ?", book.ISBN)
+		conflict = "A book with this ISBN already exists"
+	} else {
+		// Normalize title for case-insensitive duplicate check
+		query = query.Where("LOWER(TRIM(title)) = ?", strings.ToLower(strings.TrimSpace(book.Title)))
+	}
+	if err := query.First(&existingBook).Error; err == nil {
 		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
-			"error": "A book with this title already exists",
+			"error": conflict,
 		})
-		return
+		return false
 	} else if err != gorm.ErrRecordNotFound {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to check for existing books",
 			"details": err.Error(),
 		})
+		return false
+	}
+
+	return true
+}
+
+// CreateBook creates a new book record. With autofill=true the fields the
+// request leaves empty are filled in from external catalogs by the book's
+// ISBN.
+func (bc *BookController) CreateBook(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	var req types.AddBookRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
 		return
 	}
 
-	// Create the book
 	book := types.Book{
-		Title:    req.Title,
-		Author:   req.Author,
-		Category: req.Category,
+		OrganizationID: orgID,
+		CreatedByID:    requestUserID(c),
+		UpdatedByID:    requestUserID(c),
+		Version:        1,
 	}
+	req.ApplyTo(&book)
 
-	if err := initializers.DB.Create(&book).Error; err != nil {
+	var autofill *autofillReport
+	if c.Query("autofill") == "true" && book.ISBN != "" {
+		report := autofillBook(c, &book)
+		autofill = &report
+	}
+
+	if !authorizeBook(c, policy.ActionBookCreate, book) {
+		return
+	}
+
+	if !validateBook(c, &book, 0) {
+		return
+	}
+
+	// Create the book along with its author credits and first revision
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&book).Error; err != nil {
+			return err
+		}
+		if err := credits.Sync(tx, uint(book.ID), book.OrganizationID, book.Author); err != nil {
+			return err
+		}
+		return recordBookRevision(c, tx, models.RevisionCreate, nil, book, nil)
+	})
+	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to create book",
 			"details": err.Error(),
@@ -179,77 +360,157 @@ func (bc *BookController) CreateBook(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"data": book,
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBookCreated,
+		TargetType: "book",
+		TargetID:   book.ID,
+		After:      book,
 	})
+
+	c.Header("ETag", bookETag(book))
+	response := gin.H{"data": book}
+	if autofill != nil {
+		response["meta"] = gin.H{"autofill": autofill}
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
-// UpdateBook updates an existing book record
+// UpdateBook partially updates a book. The body is a JSON Merge Patch
+// (application/merge-patch+json, also assumed for application/json) or a
+// JSON Patch (application/json-patch+json) against the book's editable
+// fields; fields the patch doesn't touch keep their values.
 func (bc *BookController) UpdateBook(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
+	if _, ok := activeOrganizationID(c); !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	book, ok := loadVisibleBook(c, policy.ActionBookUpdate)
+	if !ok || !checkIfMatch(c, book) {
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": "Book ID is required",
+			"error":   "Invalid request body",
+			"details": err.Error(),
 		})
 		return
 	}
 
-	bookID, err := strconv.Atoi(id)
+	// Patch the editable fields as a JSON document
+	var document interface{}
+	raw, _ := json.Marshal(types.BookRequestFrom(book))
+	json.Unmarshal(raw, &document)
+
+	var patched interface{}
+	switch contentType := c.ContentType(); contentType {
+	case patch.ContentTypeMergePatch, "application/json", "":
+		patched, err = patch.ApplyMerge(document, body)
+	case patch.ContentTypeJSONPatch:
+		patched, err = patch.ApplyJSONPatch(document, body)
+	default:
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":   "Unsupported patch format",
+			"details": "Use " + patch.ContentTypeMergePatch + " or " + patch.ContentTypeJSONPatch,
+		})
+		return
+	}
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid book ID format",
-			"details": "ID must be a numeric value",
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Failed to apply patch",
+			"details": err.Error(),
 		})
 		return
 	}
 
 	var req types.AddBookRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request body",
+	raw, _ = json.Marshal(patched)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Patched book is invalid",
 			"details": err.Error(),
 		})
 		return
 	}
 
-	// Check if book exists
-	var book types.Book
-	if err := initializers.DB.First(&book, bookID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-				"error": "Book not found",
-			})
-		} else {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to retrieve book",
-				"details": err.Error(),
-			})
-		}
+	saveBookUpdate(c, book, req, models.RevisionUpdate, nil)
+}
+
+// ReplaceBook replaces all editable fields of a book; omitted fields are
+// cleared
+func (bc *BookController) ReplaceBook(c *gin.Context) {
+	if _, ok := activeOrganizationID(c); !ok {
+		abortNoOrganization(c)
 		return
 	}
 
-	// Normalize title for duplicate check (excluding current book)
-	normalizedTitle := strings.ToLower(strings.TrimSpace(req.Title))
-	var existingBook types.Book
-	if err := initializers.DB.Where("LOWER(TRIM(title)) = ? AND id != ?", normalizedTitle, bookID).First(&existingBook).Error; err == nil {
-		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
-			"error": "A book with this title already exists",
-		})
+	book, ok := loadVisibleBook(c, policy.ActionBookUpdate)
+	if !ok || !checkIfMatch(c, book) {
 		return
-	} else if err != gorm.ErrRecordNotFound {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to check for existing books",
+	}
+
+	var req types.AddBookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
 			"details": err.Error(),
 		})
 		return
 	}
 
-	// Update book fields
-	book.Title = req.Title
-	book.Author = req.Author
-	book.Category = req.Category
+	saveBookUpdate(c, book, req, models.RevisionUpdate, nil)
+}
+
+// saveBookUpdate validates and stores the new values of an existing book and
+// records the change as a revision; restoredFrom is the revision a rollback
+// goes back to
+func saveBookUpdate(c *gin.Context, book types.Book, req types.AddBookRequest, action string, restoredFrom *uint) {
+	before := book
+	req.ApplyTo(&book)
+	book.UpdatedByID = requestUserID(c)
+	book.Version = before.Version + 1
+
+	// The edited book must be within the caller's reach as well, e.g. an
+	// editor can't move a book out of their categories
+	if !authorizeBook(c, policy.ActionBookUpdate, book) {
+		return
+	}
+
+	if !validateBook(c, &book, book.ID) {
+		return
+	}
 
-	if err := initializers.DB.Save(&book).Error; err != nil {
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Only update the version that was read, a concurrent edit wins otherwise
+		result := tx.Model(&book).
+			Where("version = ?", before.Version).
+			Select("*").
+			Omit("id", "organization_id", "created_by_id", "created_at").
+			Updates(&book)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errBookChanged
+		}
+		if book.Author != before.Author {
+			if err := credits.Sync(tx, uint(book.ID), book.OrganizationID, book.Author); err != nil {
+				return err
+			}
+		}
+		return recordBookRevision(c, tx, action, &before, book, restoredFrom)
+	})
+	if err == errBookChanged {
+		var current types.Book
+		initializers.DB.First(&current, book.ID)
+		abortBookChanged(c, current)
+		return
+	}
+	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to update book",
 			"details": err.Error(),
@@ -257,13 +518,27 @@ func (bc *BookController) UpdateBook(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBookUpdated,
+		TargetType: "book",
+		TargetID:   book.ID,
+		Before:     before,
+		After:      book,
+	})
+
+	c.Header("ETag", bookETag(book))
 	c.JSON(http.StatusOK, gin.H{
 		"data": book,
 	})
 }
 
-// DeleteBook deletes a book record
+// DeleteBook moves a book to the trash
 func (bc *BookController) DeleteBook(c *gin.Context) {
+	if _, ok := activeOrganizationID(c); !ok {
+		abortNoOrganization(c)
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -282,19 +557,33 @@ func (bc *BookController) DeleteBook(c *gin.Context) {
 	}
 
 	// Use transaction for data consistency
+	var book types.Book
 	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
-		var book types.Book
-		if err := tx.First(&book, bookID).Error; err != nil {
+		if err := visibleBooks(c, tx).First(&book, bookID).Error; err != nil {
 			return err
 		}
 
-		if err := tx.Delete(&book).Error; err != nil {
-			return err
+		if !authorizeBook(c, policy.ActionBookDelete, book) || !checkIfMatch(c, book) {
+			return errAborted
+		}
+
+		// Soft delete: the book and its collaborators stay around until the
+		// book is restored or purged from the trash
+		result := tx.Where("version = ?", book.Version).Delete(&book)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			abortBookChanged(c, book)
+			return errAborted
 		}
 
-		return nil
+		return recordBookRevision(c, tx, models.RevisionDelete, &book, book, nil)
 	})
 
+	if err == errAborted {
+		return
+	}
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
@@ -309,6 +598,13 @@ func (bc *BookController) DeleteBook(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBookDeleted,
+		TargetType: "book",
+		TargetID:   book.ID,
+		Before:     book,
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Book deleted successfully",
 	})
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"authSystem/initializers"
+	"authSystem/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuditController struct{}
+
+func NewAuditController() *AuditController {
+	return &AuditController{}
+}
+
+// filteredAuditEvents builds the audit event query from the request filters
+func filteredAuditEvents(c *gin.Context) (*gorm.DB, error) {
+	query := initializers.DB.Model(&models.AuditEvent{})
+
+	if actorID := strings.TrimSpace(c.Query("actor_id")); actorID != "" {
+		id, err := strconv.Atoi(actorID)
+		if err != nil {
+			return nil, fmt.Errorf("actor_id must be a numeric value")
+		}
+		query = query.Where("actor_id = ?", id)
+	}
+	if actorType := strings.TrimSpace(c.Query("actor_type")); actorType != "" {
+		query = query.Where("actor_type = ?", actorType)
+	}
+	if actor := strings.TrimSpace(c.Query("actor")); actor != "" {
+		query = query.Where("LOWER(actor_email) = ?", strings.ToLower(actor))
+	}
+	// action accepts a comma separated list; a trailing ".*" matches a whole family, e.g. "book.*"
+	if action := strings.TrimSpace(c.Query("action")); action != "" {
+		conditions := initializers.DB
+		for i, a := range strings.Split(action, ",") {
+			a = strings.TrimSpace(a)
+			clause, arg := "action = ?", a
+			if strings.HasSuffix(a, ".*") {
+				clause, arg = "action LIKE ?", strings.TrimSuffix(a, "*")+"%"
+			}
+			if i == 0 {
+				conditions = conditions.Where(clause, arg)
+			} else {
+				conditions = conditions.Or(clause, arg)
+			}
+		}
+		query = query.Where(conditions)
+	}
+	if targetType := strings.TrimSpace(c.Query("target_type")); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := strings.TrimSpace(c.Query("target_id")); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if from := strings.TrimSpace(c.Query("from")); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, fmt.Errorf("from must be an RFC 3339 timestamp")
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := strings.TrimSpace(c.Query("to")); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, fmt.Errorf("to must be an RFC 3339 timestamp")
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	return query, nil
+}
+
+// GetAuditEvents returns a paginated list of audit events, newest first
+func (ac *AuditController) GetAuditEvents(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	query, err := filteredAuditEvents(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid filter",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count audit events",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var events []models.AuditEvent
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&events).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch audit events",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": events,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// ExportAuditEvents streams every matching audit event as newline delimited JSON
+func (ac *AuditController) ExportAuditEvents(c *gin.Context) {
+	query, err := filteredAuditEvents(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid filter",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	rows, err := query.Order("created_at ASC, id ASC").Rows()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch audit events",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("audit-%s.ndjson", time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := initializers.DB.ScanRows(rows, &event); err != nil {
+			c.Error(err)
+			return
+		}
+		if err := encoder.Encode(event); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		c.Error(err)
+	}
+}
@@ -1,25 +1,34 @@
 package controllers
 
 import (
+	"authSystem/audit"
 	"authSystem/initializers"
 	"authSystem/models"
+	"authSystem/types"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// errInvitationUsed is returned when an invitation is redeemed concurrently
+var errInvitationUsed = errors.New("invitation already redeemed")
+
 func SignUp(c *gin.Context) {
 	// Get the email / password from the request
 	var body struct {
-		Email    string
-		Password string
+		Email       string
+		Password    string
+		InviteToken string `json:"invite_token"`
 	}
 
 	// read the body from the request -> if it fails then return a 400 error
@@ -31,6 +40,45 @@ func SignUp(c *gin.Context) {
 		return
 	}
 
+	// Check that signups are allowed for this email
+	config, err := loadSignupConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load signup settings",
+		})
+		return
+	}
+	if config.Mode == SignupClosed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"Message": "Signups are closed",
+		})
+		return
+	}
+
+	var invitation *models.Invitation
+	if body.InviteToken != "" {
+		invitation, err = findPendingInvitation(initializers.DB, body.InviteToken)
+		if err != nil || (invitation.Email != "" && !strings.EqualFold(invitation.Email, body.Email)) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"Message": "Invalid or expired invitation",
+			})
+			return
+		}
+	}
+
+	switch {
+	case config.Mode == SignupInviteOnly && invitation == nil:
+		c.JSON(http.StatusForbidden, gin.H{
+			"Message": "An invitation is required to sign up",
+		})
+		return
+	case config.Mode == SignupDomainAllowlist && invitation == nil && !config.allowsDomain(body.Email):
+		c.JSON(http.StatusForbidden, gin.H{
+			"Message": "Signups are restricted to approved email domains",
+		})
+		return
+	}
+
 	// Check if the user already exists
 	var existingUser models.User
 	if err := initializers.DB.Where("email = ?", body.Email).First(&existingUser).Error; err == nil {
@@ -55,15 +103,63 @@ func SignUp(c *gin.Context) {
 		Password: string(hashedPassword),
 		Role:     "user",
 	}
+	if invitation != nil {
+		user.Role = invitation.Role
+	}
 
-	// Save the user to the database
-	if err := initializers.DB.Create(&user).Error; err != nil {
+	// Save the user and redeem the invitation atomically so a token can't be used twice
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if invitation == nil {
+			return createPersonalOrganization(tx, user)
+		}
+		if invitation.OrganizationID != nil {
+			if err := tx.Create(&models.Membership{
+				UserID:         user.ID,
+				OrganizationID: *invitation.OrganizationID,
+				Role:           invitation.OrganizationRole,
+			}).Error; err != nil {
+				return err
+			}
+		} else if err := createPersonalOrganization(tx, user); err != nil {
+			return err
+		}
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND redeemed_at IS NULL AND revoked_at IS NULL", invitation.ID).
+			Updates(map[string]interface{}{"redeemed_at": time.Now(), "redeemed_by_id": user.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitationUsed
+		}
+		return nil
+	})
+	if err == errInvitationUsed {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Message": "Invalid or expired invitation",
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create the user",
 		})
 		return
 	}
 
+	if invitation != nil {
+		audit.Record(c, audit.Event{
+			Action:     audit.ActionInvitationRedeemed,
+			ActorID:    &user.ID,
+			ActorEmail: user.Email,
+			TargetType: "invitation",
+			TargetID:   invitation.ID,
+		})
+	}
+
 	// Return the user
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User created successfully",
@@ -92,6 +188,11 @@ func Login(c *gin.Context) {
 	// Check if the user already exists
 	var existingUser models.User
 	if err := initializers.DB.Where("email = ?", body.Email).First(&existingUser).Error; err != nil {
+		audit.Record(c, audit.Event{
+			Action:     audit.ActionLoginFailed,
+			ActorEmail: body.Email,
+			TargetType: "user",
+		})
 		c.JSON(http.StatusBadRequest, gin.H{
 			"Message": "User does not exist",
 		})
@@ -100,6 +201,12 @@ func Login(c *gin.Context) {
 
 	// compare the password with the hashed password
 	if err := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(body.Password)); err != nil {
+		audit.Record(c, audit.Event{
+			Action:     audit.ActionLoginFailed,
+			ActorEmail: body.Email,
+			TargetType: "user",
+			TargetID:   existingUser.ID,
+		})
 		c.JSON(http.StatusBadRequest, gin.H{
 			"Message": "Invalid password",
 		})
@@ -107,12 +214,14 @@ func Login(c *gin.Context) {
 	}
 	fmt.Println(existingUser.Role)
 	// Generate a JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"sub": existingUser.ID,
 		"exp": time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	}
+	if orgID, ok := defaultOrganizationID(existingUser.ID); ok {
+		claims["org"] = orgID
+	}
+	tokenString, err := generateToken(claims)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to generate the token",
@@ -120,6 +229,14 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionLogin,
+		ActorID:    &existingUser.ID,
+		ActorEmail: existingUser.Email,
+		TargetType: "user",
+		TargetID:   existingUser.ID,
+	})
+
 	// set cookies
 	c.SetCookie("Authorization", tokenString, 3600*24, "", "", false, true)
 	// Return the user and the token
@@ -132,18 +249,116 @@ func Login(c *gin.Context) {
 
 }
 
+// generateToken signs the given claims with the application secret
+func generateToken(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
 func Validate(c *gin.Context) {
 	user, _ := c.Get("user")
 
+	principal, _ := c.Get("principal")
+	response := gin.H{
+		"message":   "User is authenticated",
+		"user":      user,
+		"principal": principal,
+	}
+	if account, ok := c.Get("serviceAccount"); ok {
+		scopes, _ := c.Get("scopes")
+		response["message"] = "Service account is authenticated"
+		response["service_account"] = account
+		response["scopes"] = scopes
+	}
+
+	// Make impersonated sessions clearly visible to the client
+	if impersonator, ok := c.Get("impersonator"); ok {
+		admin := impersonator.(types.User)
+		expiresAt, _ := c.Get("impersonationExpiresAt")
+		response["impersonation"] = gin.H{
+			"active":       true,
+			"impersonator": gin.H{"id": admin.ID, "email": admin.Email},
+			"expires_at":   expiresAt,
+		}
+	}
+
+	if membership, ok := activeMembership(c); ok {
+		response["organization"] = gin.H{
+			"id":   membership.OrganizationID,
+			"role": membership.Role,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ChangePassword updates the password of the authenticated user
+func ChangePassword(c *gin.Context) {
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Message": "Failed to read the request",
+		})
+		return
+	}
+
+	if len(body.NewPassword) < 8 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "New password must be at least 8 characters",
+		})
+		return
+	}
+
+	currentUser, _ := c.Get("user")
+	var user models.User
+	if err := initializers.DB.First(&user, currentUser.(types.User).ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load the user",
+		})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.CurrentPassword)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"Message": "Invalid password",
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to hash the password",
+		})
+		return
+	}
+
+	if err := initializers.DB.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update the password",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionPasswordChanged,
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "User is authenticated",
-		"user":    user,
+		"message": "Password changed successfully",
 	})
 }
 
 func Logout(c *gin.Context) {
 	// remove the cookie
 	c.SetCookie("Authorization", "", -1, "", "", false, true) // Set the cookie to expire immediately
+	c.SetCookie(impersonatorCookie, "", -1, "", "", false, true)
 	// Optionally, you can also clear the session or perform any other logout-related actions here
 	// For example, if you're using sessions, you might want to clear the session data
 	// session := sessions.Default(c)
@@ -0,0 +1,739 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/credits"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/types"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var authorSortKeys = sortKeys{
+	"id":         {Expr: "authors.id", Column: "id"},
+	"name":       {Expr: "authors.name", Column: "name"},
+	"sort_name":  {Expr: "authors.sort_name", Column: "sort_name"},
+	"created_at": {Expr: "authors.created_at", Column: "created_at"},
+}
+
+var validAuthorRoles = map[string]bool{
+	models.AuthorRoleAuthor:     true,
+	models.AuthorRoleEditor:     true,
+	models.AuthorRoleTranslator: true,
+}
+
+// authorRequest holds the editable fields of an author; omitted fields are
+// left unchanged
+type authorRequest struct {
+	Name        *string            `json:"name"`
+	SortName    *string            `json:"sort_name"`
+	Bio         *string            `json:"bio"`
+	Identifiers *map[string]string `json:"identifiers"`
+}
+
+// applyTo validates the request and copies it onto author. The sort name is
+// derived from the name unless it is given or was set by hand before.
+func (req authorRequest) applyTo(db *gorm.DB, author *models.Author) (int, error) {
+	derivedSortName := author.SortName == credits.SortName(author.Name)
+
+	if req.Name != nil {
+		author.Name = strings.Join(strings.Fields(*req.Name), " ")
+	}
+	if author.Name == "" {
+		return http.StatusBadRequest, fmt.Errorf("name is required")
+	}
+	if err := checkAuthorName(author.Name); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	var clashes int64
+	if err := db.Model(&models.Author{}).
+		Where("organization_id = ? AND id <> ? AND LOWER(name) = LOWER(?)", author.OrganizationID, author.ID, author.Name).
+		Count(&clashes).Error; err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if clashes > 0 {
+		return http.StatusConflict, fmt.Errorf("an author named %q already exists, merge the authors instead", author.Name)
+	}
+
+	if req.SortName != nil {
+		author.SortName = strings.TrimSpace(*req.SortName)
+	}
+	if author.SortName == "" || (req.SortName == nil && derivedSortName) {
+		author.SortName = credits.SortName(author.Name)
+	}
+
+	if req.Bio != nil {
+		author.Bio = strings.TrimSpace(*req.Bio)
+	}
+
+	if req.Identifiers != nil {
+		schemes := map[string]bool{}
+		for _, scheme := range models.AuthorIdentifierSchemes {
+			schemes[scheme] = true
+		}
+
+		identifiers := map[string]string{}
+		for scheme, value := range *req.Identifiers {
+			scheme = strings.ToLower(strings.TrimSpace(scheme))
+			if !schemes[scheme] {
+				return http.StatusBadRequest, fmt.Errorf("unknown identifier scheme %q, use one of %s", scheme, strings.Join(models.AuthorIdentifierSchemes, ", "))
+			}
+			if value = strings.TrimSpace(value); value != "" {
+				identifiers[scheme] = value
+			}
+		}
+
+		author.Identifiers = nil
+		if len(identifiers) > 0 {
+			raw, _ := json.Marshal(identifiers)
+			author.Identifiers = raw
+		}
+	}
+	return 0, nil
+}
+
+// checkAuthorName rejects names that don't survive being written into the
+// author text of a book, which has to split back into the same name
+func checkAuthorName(name string) error {
+	if names := credits.Split(name); len(names) != 1 || names[0] != name {
+		return fmt.Errorf("name must be a single name, \",\", \";\", \"&\" and \"and\" separate the authors of a book")
+	}
+	return nil
+}
+
+// loadAuthor loads the author of the active organization named by the :id
+// URL parameter
+func loadAuthor(c *gin.Context) (models.Author, bool) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return models.Author{}, false
+	}
+
+	authorID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid author ID format",
+			"details": "ID must be a numeric value",
+		})
+		return models.Author{}, false
+	}
+
+	var author models.Author
+	if err := initializers.DB.Where("organization_id = ?", orgID).First(&author, authorID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Author not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve author",
+				"details": err.Error(),
+			})
+		}
+		return models.Author{}, false
+	}
+	return author, true
+}
+
+// refreshAuthorText rewrites the author text of the books an author is
+// credited on after the author's name or credits changed. Each changed book
+// gets a new version and revision.
+func refreshAuthorText(c *gin.Context, tx *gorm.DB, authorID uint) error {
+	var bookIDs []uint
+	if err := tx.Model(&models.BookAuthor{}).
+		Where("author_id = ? AND role = ?", authorID, models.AuthorRoleAuthor).
+		Distinct().Pluck("book_id", &bookIDs).Error; err != nil {
+		return err
+	}
+
+	for _, bookID := range bookIDs {
+		var book types.Book
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, bookID).Error; err != nil {
+			return err
+		}
+
+		text, err := credits.Text(tx, bookID)
+		if err != nil {
+			return err
+		}
+		if text == book.Author {
+			continue
+		}
+
+		before := book
+		book.Author = text
+		book.Version = before.Version + 1
+		book.UpdatedByID = requestUserID(c)
+		if err := tx.Unscoped().Model(&book).Updates(map[string]interface{}{
+			"author":        book.Author,
+			"version":       book.Version,
+			"updated_by_id": book.UpdatedByID,
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordBookRevision(c, tx, models.RevisionUpdate, &before, book, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type AuthorController struct{}
+
+func NewAuthorController() *AuthorController {
+	return &AuthorController{}
+}
+
+// GetAuthors lists the authors of the active organization, searched by name
+// with q
+func (ac *AuthorController) GetAuthors(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	paging, err := newPaginator(c, authorSortKeys, "sort_name", 10, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
+	}
+
+	query := initializers.DB.Model(&models.Author{}).Where("organization_id = ?", orgID)
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(q)) + "%"
+		query = query.Where("LOWER(authors.name) LIKE ? OR LOWER(authors.sort_name) LIKE ?", pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count authors",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var authors []models.Author
+	if err := paging.Apply(query).Find(&authors).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch authors",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": authors,
+		"meta": paging.Finish(c, &authors, total),
+	})
+}
+
+// GetAuthor returns a single author
+func (ac *AuthorController) GetAuthor(c *gin.Context) {
+	author, ok := loadAuthor(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": author,
+	})
+}
+
+// authorBook is a book with the roles an author is credited with on it
+type authorBook struct {
+	types.Book
+	Roles []string `json:"roles" gorm:"-"`
+}
+
+// GetAuthorBooks lists the books visible to the caller that credit an author,
+// with the same filters and sorting as the book listing
+func (ac *AuthorController) GetAuthorBooks(c *gin.Context) {
+	author, ok := loadAuthor(c)
+	if !ok {
+		return
+	}
+
+	paging, err := newPaginator(c, bookSortKeys, "publication_date", 10, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
+	}
+
+	query, _, err := filterBooks(c, visibleBooks(c, initializers.DB.Model(&types.Book{})))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search query",
+			"details": err.Error(),
+		})
+		return
+	}
+	query = query.Where("books.id IN (?)", initializers.DB.Model(&models.BookAuthor{}).Select("book_id").Where("author_id = ?", author.ID))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var books []authorBook
+	if err := paging.Apply(query).Find(&books).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	bookIDs := make([]int, 0, len(books))
+	for _, book := range books {
+		bookIDs = append(bookIDs, book.ID)
+	}
+	var authorCredits []models.BookAuthor
+	if err := initializers.DB.Where("author_id = ? AND book_id IN ?", author.ID, bookIDs).
+		Order("role").Find(&authorCredits).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch credits",
+			"details": err.Error(),
+		})
+		return
+	}
+	roles := map[uint][]string{}
+	for _, credit := range authorCredits {
+		roles[credit.BookID] = append(roles[credit.BookID], credit.Role)
+	}
+	for i := range books {
+		books[i].Roles = roles[uint(books[i].ID)]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   books,
+		"meta":   paging.Finish(c, &books, total),
+		"author": author,
+	})
+}
+
+// CreateAuthor adds an author to the active organization
+func (ac *AuthorController) CreateAuthor(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	var req authorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	author := models.Author{OrganizationID: orgID}
+	if status, err := req.applyTo(initializers.DB, &author); err != nil {
+		c.AbortWithStatusJSON(status, gin.H{
+			"error":   "Invalid author",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !authorize(c, policy.ActionAuthorCreate, authorAttributes(author)) {
+		return
+	}
+
+	if err := initializers.DB.Create(&author).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create author",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionAuthorCreated,
+		TargetType: "author",
+		TargetID:   author.ID,
+		After:      author,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": author,
+	})
+}
+
+// UpdateAuthor changes the given fields of an author. A new name is written
+// into the author text of the author's books.
+func (ac *AuthorController) UpdateAuthor(c *gin.Context) {
+	author, ok := loadAuthor(c)
+	if !ok || !authorize(c, policy.ActionAuthorUpdate, authorAttributes(author)) {
+		return
+	}
+
+	var req authorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	before := author
+	if status, err := req.applyTo(initializers.DB, &author); err != nil {
+		c.AbortWithStatusJSON(status, gin.H{
+			"error":   "Invalid author",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&author).Error; err != nil {
+			return err
+		}
+		if author.Name == before.Name {
+			return nil
+		}
+		return refreshAuthorText(c, tx, author.ID)
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update author",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionAuthorUpdated,
+		TargetType: "author",
+		TargetID:   author.ID,
+		Before:     before,
+		After:      author,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": author,
+	})
+}
+
+// DeleteAuthor deletes an author that isn't credited on any book
+func (ac *AuthorController) DeleteAuthor(c *gin.Context) {
+	author, ok := loadAuthor(c)
+	if !ok || !authorize(c, policy.ActionAuthorDelete, authorAttributes(author)) {
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var credited int64
+		if err := tx.Model(&models.BookAuthor{}).Where("author_id = ?", author.ID).Count(&credited).Error; err != nil {
+			return err
+		}
+		if credited > 0 {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error":   "Author is credited on books",
+				"details": fmt.Sprintf("Remove the author from %d book credit(s) or merge the author into another one", credited),
+			})
+			return errAborted
+		}
+		return tx.Delete(&author).Error
+	})
+	if err == errAborted {
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete author",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionAuthorDeleted,
+		TargetType: "author",
+		TargetID:   author.ID,
+		Before:     author,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Author deleted successfully",
+	})
+}
+
+// MergeAuthor merges a duplicate author into another one: the credits move to
+// the author given as "into", the books' author text follows and the
+// duplicate is deleted
+func (ac *AuthorController) MergeAuthor(c *gin.Context) {
+	source, ok := loadAuthor(c)
+	if !ok || !authorize(c, policy.ActionAuthorDelete, authorAttributes(source)) {
+		return
+	}
+
+	var req struct {
+		Into uint `json:"into" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+	if req.Into == source.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "An author can't be merged into itself",
+		})
+		return
+	}
+
+	var target models.Author
+	if err := initializers.DB.Where("organization_id = ?", source.OrganizationID).First(&target, req.Into).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Author to merge into not found",
+		})
+		return
+	}
+	if !authorize(c, policy.ActionAuthorUpdate, authorAttributes(target)) {
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := credits.MoveCredits(tx, source.ID, target.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&source).Error; err != nil {
+			return err
+		}
+		return refreshAuthorText(c, tx, target.ID)
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to merge authors",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionAuthorMerged,
+		TargetType: "author",
+		TargetID:   target.ID,
+		Before:     source,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": target,
+	})
+}
+
+// bookCredits returns the credits of a book with their authors, in order
+func bookCredits(db *gorm.DB, bookID int) ([]models.BookAuthor, error) {
+	list := []models.BookAuthor{}
+	err := db.Preload("Author").Where("book_id = ?", bookID).
+		Order("position, id").Find(&list).Error
+	return list, err
+}
+
+// GetBookAuthors lists the authors credited on a book
+func (bc *BookController) GetBookAuthors(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+
+	authors, err := bookCredits(initializers.DB, book.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch authors",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": authors,
+	})
+}
+
+// SetBookAuthors replaces the credits of a book. Each credit names an
+// existing author by author_id or any author by name, found or created in
+// the book's organization, with a role. The book's author text is rebuilt
+// from the credits in the author role, of which there must be one.
+func (bc *BookController) SetBookAuthors(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookUpdate)
+	if !ok || !checkIfMatch(c, book) {
+		return
+	}
+
+	var req []struct {
+		AuthorID uint   `json:"author_id"`
+		Name     string `json:"name"`
+		Role     string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": "Expected a list of credits with author_id or name and role",
+		})
+		return
+	}
+
+	hasAuthor := false
+	for i := range req {
+		req[i].Name = strings.Join(strings.Fields(req[i].Name), " ")
+		req[i].Role = strings.ToLower(strings.TrimSpace(req[i].Role))
+		if req[i].Role == "" {
+			req[i].Role = models.AuthorRoleAuthor
+		}
+		if !validAuthorRoles[req[i].Role] {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid role",
+				"details": "Role must be author, editor or translator",
+			})
+			return
+		}
+		if req[i].AuthorID == 0 && req[i].Name == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Each credit needs an author_id or a name",
+			})
+			return
+		}
+		if req[i].AuthorID == 0 {
+			if err := checkAuthorName(req[i].Name); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid author name",
+					"details": err.Error(),
+				})
+				return
+			}
+		}
+		hasAuthor = hasAuthor || req[i].Role == models.AuthorRoleAuthor
+	}
+	if !hasAuthor {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "At least one credit must have the author role",
+		})
+		return
+	}
+
+	before := book
+	var creditsBefore, creditsAfter []models.BookAuthor
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if creditsBefore, err = bookCredits(tx, book.ID); err != nil {
+			return err
+		}
+
+		var replaced []models.BookAuthor
+		seen := map[string]bool{}
+		for _, credit := range req {
+			var author models.Author
+			if credit.AuthorID != 0 {
+				if err := tx.Where("organization_id = ?", book.OrganizationID).First(&author, credit.AuthorID).Error; err != nil {
+					c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+						"error":   "Author not found",
+						"details": fmt.Sprintf("No author %d in the book's organization", credit.AuthorID),
+					})
+					return errAborted
+				}
+			} else if author, err = credits.FindOrCreateAuthor(tx, book.OrganizationID, credit.Name); err != nil {
+				return err
+			}
+
+			key := fmt.Sprintf("%d/%s", author.ID, credit.Role)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			replaced = append(replaced, models.BookAuthor{
+				BookID:   uint(book.ID),
+				AuthorID: author.ID,
+				Role:     credit.Role,
+				Position: len(replaced),
+			})
+		}
+
+		if err := tx.Where("book_id = ?", book.ID).Delete(&models.BookAuthor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&replaced).Error; err != nil {
+			return err
+		}
+
+		text, err := credits.Text(tx, uint(book.ID))
+		if err != nil {
+			return err
+		}
+		if text != book.Author {
+			book.Author = text
+			book.Version = before.Version + 1
+			book.UpdatedByID = requestUserID(c)
+			result := tx.Model(&book).
+				Where("version = ?", before.Version).
+				Updates(map[string]interface{}{
+					"author":        book.Author,
+					"version":       book.Version,
+					"updated_by_id": book.UpdatedByID,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errBookChanged
+			}
+			if err := recordBookRevision(c, tx, models.RevisionUpdate, &before, book, nil); err != nil {
+				return err
+			}
+		}
+
+		creditsAfter, err = bookCredits(tx, book.ID)
+		return err
+	})
+	if err == errAborted {
+		return
+	}
+	if err == errBookChanged {
+		var current types.Book
+		initializers.DB.First(&current, book.ID)
+		abortBookChanged(c, current)
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update authors",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBookAuthorsSet,
+		TargetType: "book",
+		TargetID:   book.ID,
+		Before:     gin.H{"author": before.Author, "credits": creditsBefore},
+		After:      gin.H{"author": book.Author, "credits": creditsAfter},
+	})
+
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, gin.H{
+		"data": creditsAfter,
+	})
+}
@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/biblio"
+	"authSystem/credits"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/types"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordBatchSize is how many books of a set are read, with their credits,
+// before they are written
+const recordBatchSize = 200
+
+// bookRecord describes a book for the bibliographic formats. Contributors
+// come from its credits, or from its author text if it has none.
+func bookRecord(book types.Book, bookCredits []models.BookAuthor) biblio.Record {
+	record := biblio.Record{
+		ID:              book.ID,
+		Title:           book.Title,
+		Subtitle:        book.Subtitle,
+		Publisher:       book.Publisher,
+		PublicationDate: book.PublicationDate,
+		Language:        book.Language,
+		ISBN:            book.ISBN,
+		Edition:         book.Edition,
+		PageCount:       book.PageCount,
+		Description:     book.Description,
+		Category:        book.Category,
+		UpdatedAt:       book.UpdatedAt,
+	}
+	for _, credit := range bookCredits {
+		if credit.Author != nil {
+			record.Contributors = append(record.Contributors, biblio.Contributor{
+				Name:     credit.Author.Name,
+				SortName: credit.Author.SortName,
+				Role:     credit.Role,
+			})
+		}
+	}
+	if len(record.Contributors) == 0 {
+		for _, name := range credits.Split(book.Author) {
+			record.Contributors = append(record.Contributors, biblio.Contributor{
+				Name:     name,
+				SortName: credits.SortName(name),
+				Role:     biblio.RoleAuthor,
+			})
+		}
+	}
+	// Authors first, then editors and translators
+	sort.SliceStable(record.Contributors, func(i, j int) bool {
+		return record.Contributors[i].Role == biblio.RoleAuthor && record.Contributors[j].Role != biblio.RoleAuthor
+	})
+	return record
+}
+
+// creditsByBook loads the credits of several books at once, by book ID
+func creditsByBook(books []types.Book) (map[uint][]models.BookAuthor, error) {
+	byBook := map[uint][]models.BookAuthor{}
+	if len(books) == 0 {
+		return byBook, nil
+	}
+	ids := make([]int, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	var list []models.BookAuthor
+	if err := initializers.DB.Preload("Author").Where("book_id IN ?", ids).
+		Order("position, id").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, credit := range list {
+		byBook[credit.BookID] = append(byBook[credit.BookID], credit)
+	}
+	return byBook, nil
+}
+
+// writeBookRecords writes books with their credits, which are loaded for all
+// of them at once
+func writeBookRecords(writer biblio.Writer, books []types.Book) error {
+	byBook, err := creditsByBook(books)
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		if err := writer.Write(bookRecord(book, byBook[uint(book.ID)])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// biblioFormat reads the :format URL parameter
+func biblioFormat(c *gin.Context) (string, bool) {
+	format := c.Param("format")
+	if _, ok := biblio.MediaTypes[format]; !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid export format",
+			"details": "format must be marcxml, marc, dc, bibtex or ris",
+		})
+		return "", false
+	}
+	return format, true
+}
+
+// negotiateBookFormat picks the representation of a book from the Accept
+// header: one of the bibliographic formats, or "" for JSON. JSON is preferred
+// on ties and used when nothing listed is available.
+func negotiateBookFormat(c *gin.Context) string {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		format := ""
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+		default:
+			found := false
+			for name, candidate := range biblio.MediaTypes {
+				if candidate == mediaType {
+					format, found = name, true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		if quality > bestQuality || (quality == bestQuality && format == "") {
+			best, bestQuality = format, quality
+		}
+	}
+	return best
+}
+
+// writeBookRecordResponse writes the record of a single book in a format
+func writeBookRecordResponse(c *gin.Context, book types.Book, format string, attachment bool) {
+	list, err := bookCredits(initializers.DB, book.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch book authors",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", biblio.MediaTypes[format])
+	if attachment {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="book-%d%s"`, book.ID, biblio.Extensions[format]))
+	}
+	c.Status(http.StatusOK)
+
+	writer, err := biblio.NewWriter(format, c.Writer)
+	if err == nil {
+		if err = writer.Write(bookRecord(book, list)); err == nil {
+			err = writer.Close()
+		}
+	}
+	// The response has started, errors can only be logged
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// ExportBookRecord returns a book as MARCXML, binary MARC 21, Dublin Core,
+// BibTeX or RIS (format)
+func (bc *BookController) ExportBookRecord(c *gin.Context) {
+	format, ok := biblioFormat(c)
+	if !ok {
+		return
+	}
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+	writeBookRecordResponse(c, book, format, true)
+}
+
+// ExportBookRecords streams the visible books matching the filters of
+// SearchBooks in a bibliographic format, in ID order
+func (bc *BookController) ExportBookRecords(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	format, ok := biblioFormat(c)
+	if !ok {
+		return
+	}
+
+	query, _, err := filterBooks(c, visibleBooks(c, initializers.DB.Model(&types.Book{})))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search query",
+			"details": err.Error(),
+		})
+		return
+	}
+	query = filterFacets(c, query, bookFacets, "")
+
+	rows, err := query.WithContext(c.Request.Context()).Order("books.id").Rows()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch books",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBooksExported,
+		TargetType: "organization",
+		TargetID:   orgID,
+		After:      gin.H{"format": format, "query": c.Request.URL.RawQuery},
+	})
+
+	c.Header("Content-Type", biblio.MediaTypes[format])
+	c.Header("Content-Disposition", `attachment; filename="books`+biblio.Extensions[format]+`"`)
+	c.Status(http.StatusOK)
+
+	// The response has started, errors can only be logged
+	writer, err := biblio.NewWriter(format, c.Writer)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	batch := make([]types.Book, 0, recordBatchSize)
+	for rows.Next() {
+		var book types.Book
+		if err := initializers.DB.ScanRows(rows, &book); err != nil {
+			c.Error(err)
+			return
+		}
+		if batch = append(batch, book); len(batch) == recordBatchSize {
+			if err := writeBookRecords(writer, batch); err != nil {
+				c.Error(err)
+				return
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		c.Error(err)
+		return
+	}
+	if len(batch) > 0 {
+		if err := writeBookRecords(writer, batch); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+// recordReader is a reader of MARC records
+type recordReader interface {
+	Next() (biblio.Record, error)
+	Position() int
+}
+
+// marcImportReader turns MARC records into import rows; a row's line is the
+// number of its record. Only authors become part of the author text, so
+// editors and translators are not imported.
+type marcImportReader struct {
+	records recordReader
+}
+
+func (ir *marcImportReader) Next() (importRow, error) {
+	record, err := ir.records.Next()
+	var recordErr *biblio.RecordError
+	if errors.As(err, &recordErr) {
+		return importRow{Line: recordErr.Position, Err: recordErr.Err}, nil
+	}
+	if err != nil {
+		return importRow{}, err
+	}
+
+	var authors []string
+	for _, contributor := range record.Contributors {
+		if contributor.Role == biblio.RoleAuthor {
+			authors = append(authors, directName(contributor.Name))
+		}
+	}
+
+	row := importRow{Line: ir.records.Position(), Fields: map[string]interface{}{}}
+	for field, value := range map[string]string{
+		"title":            record.Title,
+		"subtitle":         record.Subtitle,
+		"author":           credits.Join(authors),
+		"category":         record.Category,
+		"isbn":             record.ISBN,
+		"publisher":        record.Publisher,
+		"publication_date": record.PublicationDate,
+		"language":         record.Language,
+		"edition":          record.Edition,
+		"description":      record.Description,
+	} {
+		// Fields a record lacks are left as they are on update
+		if value != "" {
+			row.Fields[field] = value
+		}
+	}
+	if record.PageCount > 0 {
+		row.Fields["page_count"] = record.PageCount
+	}
+	return row, nil
+}
+
+// directName turns an inverted MARC name around: "García Márquez, Gabriel"
+// becomes "Gabriel García Márquez" and "King, Martin Luther, Jr." "Martin
+// Luther King, Jr."
+func directName(name string) string {
+	parts := strings.SplitN(name, ",", 3)
+	if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+		return strings.TrimSpace(parts[0])
+	}
+	direct := strings.TrimSpace(parts[1]) + " " + strings.TrimSpace(parts[0])
+	if len(parts) == 3 && strings.TrimSpace(parts[2]) != "" {
+		direct += ", " + strings.TrimSpace(parts[2])
+	}
+	return direct
+}
+
+// newMARCImportReader reads MARCXML or binary MARC 21 records
+func newMARCImportReader(r io.Reader, format string) *marcImportReader {
+	if format == biblio.FormatMARC {
+		return &marcImportReader{records: biblio.NewMARCReader(r)}
+	}
+	return &marcImportReader{records: biblio.NewMARCXMLReader(r)}
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"authSystem/initializers"
+	"authSystem/isbn"
+	"authSystem/models"
+	"authSystem/taxonomy"
+	"authSystem/types"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+)
+
+// publicationDateLayouts are the accepted precisions of a publication date
+var publicationDateLayouts = []string{"2006", "2006-01", "2006-01-02"}
+
+// normalizeBookMetadata trims the bibliographic fields of a book and brings
+// them into their canonical form: ISBNs become ISBN-13 digits and languages
+// canonical BCP 47 tags. It fails on malformed values.
+func normalizeBookMetadata(book *types.Book) error {
+	for _, field := range []*string{&book.Title, &book.Subtitle, &book.Author, &book.Category,
+		&book.Publisher, &book.Edition, &book.Description} {
+		*field = strings.TrimSpace(*field)
+	}
+
+	if book.ISBN = strings.TrimSpace(book.ISBN); book.ISBN != "" {
+		normalized, err := isbn.Normalize(book.ISBN)
+		if err != nil {
+			return fmt.Errorf("isbn: %w", err)
+		}
+		book.ISBN = normalized
+	}
+
+	if book.Language = strings.TrimSpace(book.Language); book.Language != "" {
+		tag, err := language.Parse(book.Language)
+		if err != nil {
+			return fmt.Errorf("language: %q is not a BCP 47 language tag", book.Language)
+		}
+		book.Language = tag.String()
+	}
+
+	if book.PublicationDate = strings.TrimSpace(book.PublicationDate); book.PublicationDate != "" {
+		if !validPublicationDate(book.PublicationDate) {
+			return fmt.Errorf("publication_date: %q must be YYYY, YYYY-MM or YYYY-MM-DD", book.PublicationDate)
+		}
+	}
+
+	if book.PageCount < 0 {
+		return fmt.Errorf("page_count: must not be negative")
+	}
+	return nil
+}
+
+func validPublicationDate(date string) bool {
+	for _, layout := range publicationDateLayouts {
+		if len(date) == len(layout) {
+			_, err := time.Parse(layout, date)
+			return err == nil
+		}
+	}
+	return false
+}
+
+// filterBookMetadata applies the exact metadata filters of a book listing:
+// isbn (any notation), author_id (credited in any role), publisher,
+// language (en also matches en-US), published_from and published_to (years)
+// min_pages and max_pages, category_id or category_slug (including the
+// categories below it) and tag (repeatable, books carry every tag)
+func filterBookMetadata(params url.Values, orgID uint, query *gorm.DB) (*gorm.DB, error) {
+	if input := strings.TrimSpace(params.Get("isbn")); input != "" {
+		normalized, err := isbn.Normalize(input)
+		if err != nil {
+			return nil, fmt.Errorf("isbn: %w", err)
+		}
+		query = query.Where("books.isbn = ?", normalized)
+	}
+
+	if input := strings.TrimSpace(params.Get("author_id")); input != "" {
+		authorID, err := strconv.Atoi(input)
+		if err != nil {
+			return nil, fmt.Errorf("author_id must be numeric")
+		}
+		query = query.Where("books.id IN (SELECT book_id FROM book_authors WHERE author_id = ?)", authorID)
+	}
+
+	if publisher := strings.TrimSpace(params.Get("publisher")); publisher != "" {
+		query = query.Where("LOWER(books.publisher) = LOWER(?)", publisher)
+	}
+
+	if input := strings.TrimSpace(params.Get("language")); input != "" {
+		tag, err := language.Parse(input)
+		if err != nil {
+			return nil, fmt.Errorf("language: %q is not a BCP 47 language tag", input)
+		}
+		query = query.Where("books.language = ? OR books.language LIKE ?", tag.String(), tag.String()+"-%")
+	}
+
+	years := []struct {
+		param    string
+		operator string
+	}{
+		{"published_from", ">="},
+		{"published_to", "<="},
+	}
+	for _, year := range years {
+		input := strings.TrimSpace(params.Get(year.param))
+		if input == "" {
+			continue
+		}
+		value, err := strconv.Atoi(input)
+		if err != nil || value < 0 || value > 9999 {
+			return nil, fmt.Errorf("%s must be a year", year.param)
+		}
+		query = query.Where("books.publication_date <> '' AND LEFT(books.publication_date, 4) "+year.operator+" ?", fmt.Sprintf("%04d", value))
+	}
+
+	pages := []struct {
+		param    string
+		operator string
+	}{
+		{"min_pages", ">="},
+		{"max_pages", "<="},
+	}
+	for _, bound := range pages {
+		input := strings.TrimSpace(params.Get(bound.param))
+		if input == "" {
+			continue
+		}
+		value, err := strconv.Atoi(input)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("%s must be a number of pages", bound.param)
+		}
+		query = query.Where("books.page_count > 0 AND books.page_count "+bound.operator+" ?", value)
+	}
+
+	categoryID := strings.TrimSpace(params.Get("category_id"))
+	if slug := strings.TrimSpace(params.Get("category_slug")); slug != "" {
+		var category models.Category
+		if err := initializers.DB.Where("organization_id = ? AND slug = ?", orgID, strings.ToLower(slug)).
+			First(&category).Error; err != nil {
+			return nil, fmt.Errorf("category_slug: unknown category %q", slug)
+		}
+		categoryID = strconv.Itoa(int(category.ID))
+	}
+	if categoryID != "" {
+		id, err := strconv.Atoi(categoryID)
+		if err != nil {
+			return nil, fmt.Errorf("category_id must be numeric")
+		}
+		query = query.Where("books.category_id IN ("+taxonomy.DescendantsQuery+")", id)
+	}
+
+	for _, tag := range params["tag"] {
+		if tag = taxonomy.Slugify(tag); tag != "" {
+			query = query.Where("books.id IN (SELECT book_tags.book_id FROM book_tags JOIN tags ON tags.id = book_tags.tag_id WHERE tags.slug = ?)", tag)
+		}
+	}
+
+	return query, nil
+}
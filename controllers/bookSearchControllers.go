@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"authSystem/initializers"
+	"authSystem/search"
+	"authSystem/types"
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Matches in highlighted snippets are delimited with control characters
+// that can't be mistaken for markup; highlightHTML turns them into <mark>
+// tags once the snippet's text is escaped
+const (
+	highlightStart  = "\x02"
+	highlightStop   = "\x03"
+	headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+)
+
+var highlightMarks = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// highlightHTML turns a ts_headline snippet of user-supplied text into an
+// HTML fragment with the matches in <mark>
+func highlightHTML(snippet string) string {
+	return highlightMarks.Replace(html.EscapeString(snippet))
+}
+
+// suggestTimeout is the latency budget of a suggestion query; suggestions
+// are requested on every keystroke, so a slow answer is worse than none
+const suggestTimeout = 150 * time.Millisecond
+
+// filterBooks applies the filters in the query string of a book listing
+// with filterBookParams
+func filterBooks(c *gin.Context, query *gorm.DB) (*gorm.DB, string, error) {
+	orgID, _ := activeOrganizationID(c)
+	return filterBookParams(c.Request.URL.Query(), orgID, query)
+}
+
+// filterBookParams applies the filters of a book listing in organization
+// orgID: q searches all fields, title, author and category search a single
+// one, and the metadata filters of filterBookMetadata match exactly. It
+// returns the tsquery of q for ranking, empty when q isn't given.
+func filterBookParams(params url.Values, orgID uint, query *gorm.DB) (*gorm.DB, string, error) {
+	filters := []struct {
+		param   string
+		weights string
+	}{
+		{"q", ""},
+		{"title", search.WeightTitle},
+		{"author", search.WeightAuthor},
+		{"category", search.WeightCategory},
+	}
+
+	var rankQuery string
+	for _, filter := range filters {
+		input := strings.TrimSpace(params.Get(filter.param))
+		if input == "" {
+			continue
+		}
+
+		tsquery := search.Parse(input, filter.weights)
+		if tsquery == "" {
+			return nil, "", fmt.Errorf("%s has no searchable words", filter.param)
+		}
+		query = query.Where("search_vector @@ to_tsquery('"+search.Config+"', ?)", tsquery)
+
+		if filter.param == "q" {
+			rankQuery = tsquery
+		}
+	}
+
+	query, err := filterBookMetadata(params, orgID, query)
+	if err != nil {
+		return nil, "", err
+	}
+	return query, rankQuery, nil
+}
+
+// bookSearchResult is a book with its relevance and highlighted fields
+type bookSearchResult struct {
+	types.Book
+	Rank      float64           `json:"rank,omitempty"`
+	Highlight map[string]string `json:"highlight,omitempty" gorm:"-"`
+
+	TitleHighlight    string `json:"-"`
+	AuthorHighlight   string `json:"-"`
+	CategoryHighlight string `json:"-"`
+}
+
+// SearchBooks lists the books visible to the caller, optionally searched with
+// q (words, "phrases", prefix*, -exclusions and OR). Results of a search are
+// ordered by relevance and carry highlighted snippets. Facet counts for the
+// current filters are returned alongside.
+func (bc *BookController) SearchBooks(c *gin.Context) {
+	if _, ok := activeOrganizationID(c); !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	query, rankQuery, err := filterBooks(c, visibleBooks(c, initializers.DB.Model(&types.Book{})))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search query",
+			"details": err.Error(),
+		})
+		return
+	}
+	query = filterFacets(c, query, bookFacets, "")
+
+	// Searches can also be sorted by relevance, which is their default
+	sortKeys, defaultSort := bookSortKeys, "id"
+	if rankQuery != "" {
+		sortKeys = sortKeys.with("rank", sortKey{
+			Expr:   "ts_rank(search_vector, to_tsquery('" + search.Config + "', ?))",
+			Vars:   []interface{}{rankQuery},
+			Column: "rank",
+		})
+		defaultSort = "-rank"
+	}
+	paging, err := newPaginator(c, sortKeys, defaultSort, 10, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if rankQuery != "" {
+		tsquery := "to_tsquery('" + search.Config + "', @q)"
+		headline := func(column string) string {
+			return "ts_headline('" + search.Config + "', coalesce(" + column + ", ''), " + tsquery + ", @headline) AS " + column + "_highlight"
+		}
+		query = query.
+			Select("books.*, ts_rank(search_vector, "+tsquery+") AS rank, "+
+				headline("title")+", "+headline("author")+", "+headline("category"),
+				map[string]interface{}{"q": rankQuery, "headline": headlineOptions})
+	}
+
+	facets, err := countFacets(c, func() *gorm.DB {
+		base, _, _ := filterBooks(c, visibleBooks(c, initializers.DB.Model(&types.Book{})))
+		return base
+	}, bookFacets)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count facets",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var books []bookSearchResult
+	if err := paging.Apply(query).Find(&books).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if rankQuery != "" {
+		for i := range books {
+			books[i].Highlight = map[string]string{
+				"title":    highlightHTML(books[i].TitleHighlight),
+				"author":   highlightHTML(books[i].AuthorHighlight),
+				"category": highlightHTML(books[i].CategoryHighlight),
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   books,
+		"meta":   paging.Finish(c, &books, total),
+		"facets": facets,
+	})
+}
+
+// suggestion is a title or author completion
+type suggestion struct {
+	Value string  `json:"value"`
+	Field string  `json:"field"`
+	Score float64 `json:"score"`
+}
+
+// suggestionQuery ranks the distinct values of column that complete input.
+// Values starting with the input rank first, then values with a word starting
+// with it, then values that are merely similar (typos) by trigram word
+// similarity.
+func suggestionQuery(c *gin.Context, db *gorm.DB, column, field, input string) *gorm.DB {
+	lowered := "LOWER(books." + column + ")"
+	prefix := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(input) + "%"
+
+	return visibleBooks(c, db.Model(&types.Book{})).
+		Select("books."+column+" AS value, ? AS field, "+
+			"MAX(word_similarity(?, "+lowered+") + "+
+			"CASE WHEN "+lowered+" LIKE ? THEN 2 WHEN "+lowered+" LIKE ? THEN 1 ELSE 0 END) AS score",
+			field, input, prefix, "% "+prefix).
+		Where(lowered+" LIKE ? OR "+lowered+" LIKE ? OR ? <% "+lowered, prefix, "% "+prefix, input).
+		Group("books." + column)
+}
+
+// SuggestBooks returns ranked title and author completions for a search box.
+// It is meant to be called per keystroke: typos are tolerated, results can be
+// cached briefly and the query gives up after suggestTimeout.
+func (bc *BookController) SuggestBooks(c *gin.Context) {
+	if _, ok := activeOrganizationID(c); !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	input := strings.ToLower(strings.Join(strings.Fields(c.Query("q")), " "))
+	if len([]rune(input)) < 2 {
+		c.JSON(http.StatusOK, gin.H{
+			"data": []suggestion{},
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "8"))
+	if err != nil || limit < 1 || limit > 20 {
+		limit = 8
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), suggestTimeout)
+	defer cancel()
+	db := initializers.DB.WithContext(ctx)
+
+	suggestions := []suggestion{}
+	err = db.Table("(? UNION ALL ?) AS suggestions",
+		suggestionQuery(c, db, "title", "title", input),
+		suggestionQuery(c, db, "author", "author", input)).
+		Order("score DESC, value").
+		Limit(limit).
+		Scan(&suggestions).Error
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			// Better no suggestions than late ones
+			c.JSON(http.StatusOK, gin.H{
+				"data": []suggestion{},
+				"meta": gin.H{"timed_out": true},
+			})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch suggestions",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=60")
+	c.JSON(http.StatusOK, gin.H{
+		"data": suggestions,
+	})
+}
@@ -0,0 +1,514 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/taxonomy"
+	"authSystem/types"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// categoryRequest holds the editable fields of a category; omitted fields are
+// left unchanged. parent_id null moves a category to the top of the tree.
+type categoryRequest struct {
+	Name     *string         `json:"name"`
+	Slug     *string         `json:"slug"`
+	ParentID json.RawMessage `json:"parent_id"`
+}
+
+// categoryNode is a category in the tree with the number of books filed
+// directly under it and under it or any of its descendants
+type categoryNode struct {
+	models.Category
+	BookCount  int64           `json:"book_count"`
+	TotalCount int64           `json:"total_count"`
+	Children   []*categoryNode `json:"children"`
+}
+
+// applyTo validates the request and copies it onto category. New categories
+// get a slug derived from their name unless one is given.
+func (req categoryRequest) applyTo(db *gorm.DB, category *models.Category) (int, error) {
+	if req.Name != nil {
+		category.Name = strings.Join(strings.Fields(*req.Name), " ")
+	}
+	if category.Name == "" {
+		return http.StatusBadRequest, fmt.Errorf("name is required")
+	}
+	if strings.ContainsAny(category.Name, ">/") {
+		return http.StatusBadRequest, fmt.Errorf("name must not contain > or /, they separate the levels of a category path")
+	}
+
+	if len(req.ParentID) > 0 {
+		category.ParentID = nil
+		if string(req.ParentID) != "null" {
+			var parentID uint
+			if err := json.Unmarshal(req.ParentID, &parentID); err != nil {
+				return http.StatusBadRequest, fmt.Errorf("parent_id must be a category ID or null")
+			}
+			category.ParentID = &parentID
+		}
+	}
+	if category.ParentID != nil {
+		var parent models.Category
+		if err := db.Where("organization_id = ?", category.OrganizationID).First(&parent, *category.ParentID).Error; err != nil {
+			return http.StatusUnprocessableEntity, fmt.Errorf("parent category %d not found", *category.ParentID)
+		}
+		if category.ID != 0 {
+			// A category can't move below itself
+			var subtree []uint
+			if err := db.Raw(taxonomy.DescendantsQuery, category.ID).Scan(&subtree).Error; err != nil {
+				return http.StatusInternalServerError, err
+			}
+			for _, id := range subtree {
+				if id == parent.ID {
+					return http.StatusUnprocessableEntity, fmt.Errorf("a category can't be moved below itself")
+				}
+			}
+		}
+	}
+
+	// Siblings have distinct names so that paths are unambiguous
+	siblings := db.Model(&models.Category{}).
+		Where("organization_id = ? AND id <> ? AND LOWER(name) = LOWER(?)", category.OrganizationID, category.ID, category.Name)
+	if category.ParentID == nil {
+		siblings = siblings.Where("parent_id IS NULL")
+	} else {
+		siblings = siblings.Where("parent_id = ?", *category.ParentID)
+	}
+	var clashes int64
+	if err := siblings.Count(&clashes).Error; err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if clashes > 0 {
+		return http.StatusConflict, fmt.Errorf("a category named %q already exists at this level", category.Name)
+	}
+
+	switch {
+	case req.Slug != nil:
+		if category.Slug = taxonomy.Slugify(*req.Slug); category.Slug == "" {
+			return http.StatusBadRequest, taxonomy.ErrNoSlug
+		}
+		var taken int64
+		if err := db.Model(&models.Category{}).
+			Where("organization_id = ? AND id <> ? AND slug = ?", category.OrganizationID, category.ID, category.Slug).
+			Count(&taken).Error; err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if taken > 0 {
+			return http.StatusConflict, fmt.Errorf("slug %q is taken", category.Slug)
+		}
+	case category.ID == 0:
+		parentSlug := ""
+		if category.ParentID != nil {
+			var parent models.Category
+			db.First(&parent, *category.ParentID)
+			parentSlug = parent.Slug
+		}
+		slug, err := taxonomy.UniqueSlug(db, "categories", category.OrganizationID, category.Name, parentSlug)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		category.Slug = slug
+	}
+	return 0, nil
+}
+
+// loadCategory loads the category of the active organization named by the
+// :id URL parameter, which may also be its slug
+func loadCategory(c *gin.Context) (models.Category, bool) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return models.Category{}, false
+	}
+
+	var category models.Category
+	query := initializers.DB.Where("organization_id = ?", orgID)
+	if categoryID, err := strconv.Atoi(c.Param("id")); err == nil {
+		query = query.Where("id = ?", categoryID)
+	} else {
+		query = query.Where("slug = ?", strings.ToLower(c.Param("id")))
+	}
+	if err := query.First(&category).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Category not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve category",
+				"details": err.Error(),
+			})
+		}
+		return models.Category{}, false
+	}
+	return category, true
+}
+
+// resolveBookCategory links a book to its category, see linkBookCategory,
+// and aborts the request when no category or several match
+func resolveBookCategory(c *gin.Context, book *types.Book) bool {
+	switch err := linkBookCategory(initializers.DB, book); err {
+	case nil:
+		return true
+	case taxonomy.ErrUnknownCategory, taxonomy.ErrAmbiguousCategory:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid category",
+			"details": fmt.Sprintf("%q: %v; categories are listed at /api/categories", book.Category, err),
+		})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to look up category",
+			"details": err.Error(),
+		})
+	}
+	return false
+}
+
+// linkBookCategory links a book to the category of its organization that its
+// category text names and replaces the text with the category's name. A book
+// without category text has no category.
+func linkBookCategory(db *gorm.DB, book *types.Book) error {
+	if book.Category == "" {
+		book.CategoryID = nil
+		return nil
+	}
+
+	// The linked category keeps its book even when its name is shared
+	if book.CategoryID != nil {
+		var current models.Category
+		err := db.Where("organization_id = ?", book.OrganizationID).First(&current, *book.CategoryID).Error
+		if err == nil && strings.EqualFold(current.Name, book.Category) {
+			book.Category = current.Name
+			return nil
+		}
+	}
+
+	category, err := taxonomy.Find(db, book.OrganizationID, book.Category)
+	if err != nil {
+		return err
+	}
+	book.CategoryID = &category.ID
+	book.Category = category.Name
+	return nil
+}
+
+// refreshCategoryText writes a category's new name into the category text of
+// its books. Each changed book gets a new version and revision.
+func refreshCategoryText(c *gin.Context, tx *gorm.DB, category models.Category) error {
+	var books []types.Book
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("category_id = ? AND category <> ?", category.ID, category.Name).
+		Find(&books).Error; err != nil {
+		return err
+	}
+
+	for _, book := range books {
+		before := book
+		book.Category = category.Name
+		book.Version = before.Version + 1
+		book.UpdatedByID = requestUserID(c)
+		if err := tx.Unscoped().Model(&book).Updates(map[string]interface{}{
+			"category":      book.Category,
+			"version":       book.Version,
+			"updated_by_id": book.UpdatedByID,
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordBookRevision(c, tx, models.RevisionUpdate, &before, book, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type CategoryController struct{}
+
+func NewCategoryController() *CategoryController {
+	return &CategoryController{}
+}
+
+// GetCategories returns the category tree of the active organization with
+// the number of books in each category, siblings sorted by name
+func (cc *CategoryController) GetCategories(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	roots, err := categoryTree(orgID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch categories",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": roots,
+	})
+}
+
+// categoryTree returns the categories of an organization as a tree sorted by
+// name, with the number of books in each category and below it
+func categoryTree(orgID uint) ([]*categoryNode, error) {
+	var categories []models.Category
+	if err := initializers.DB.Where("organization_id = ?", orgID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		CategoryID uint
+		Count      int64
+	}
+	if err := initializers.DB.Model(&types.Book{}).
+		Select("category_id, COUNT(*) AS count").
+		Where("organization_id = ? AND category_id IS NOT NULL", orgID).
+		Group("category_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	nodes := map[uint]*categoryNode{}
+	for _, category := range categories {
+		nodes[category.ID] = &categoryNode{Category: category, Children: []*categoryNode{}}
+	}
+	for _, count := range counts {
+		if node, ok := nodes[count.CategoryID]; ok {
+			node.BookCount = count.Count
+		}
+	}
+
+	roots := []*categoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if parent, ok := nodes[derefUint(category.ParentID)]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	var total func(nodes []*categoryNode) int64
+	total = func(nodes []*categoryNode) int64 {
+		sort.Slice(nodes, func(i, j int) bool {
+			return strings.ToLower(nodes[i].Name) < strings.ToLower(nodes[j].Name)
+		})
+		var sum int64
+		for _, node := range nodes {
+			node.TotalCount = node.BookCount + total(node.Children)
+			sum += node.TotalCount
+		}
+		return sum
+	}
+	total(roots)
+	return roots, nil
+}
+
+// GetCategory returns a single category, by ID or slug, with its path from
+// the top of the tree and its children
+func (cc *CategoryController) GetCategory(c *gin.Context) {
+	category, ok := loadCategory(c)
+	if !ok {
+		return
+	}
+
+	path, err := taxonomy.Path(initializers.DB, category)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve category path",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	children := []models.Category{}
+	if err := initializers.DB.Where("parent_id = ?", category.ID).Order("LOWER(name)").Find(&children).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch categories",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"category": category,
+			"path":     strings.Join(path, taxonomy.PathSeparator),
+			"children": children,
+		},
+	})
+}
+
+// CreateCategory adds a category to the tree of the active organization
+func (cc *CategoryController) CreateCategory(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	var req categoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	category := models.Category{OrganizationID: orgID}
+	if !authorize(c, policy.ActionCategoryCreate, categoryAttributes(category)) {
+		return
+	}
+
+	if status, err := req.applyTo(initializers.DB, &category); err != nil {
+		c.AbortWithStatusJSON(status, gin.H{
+			"error":   "Invalid category",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := initializers.DB.Create(&category).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create category",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionCategoryCreated,
+		TargetType: "category",
+		TargetID:   category.ID,
+		After:      category,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": category,
+	})
+}
+
+// UpdateCategory renames a category, changes its slug or moves it to another
+// parent. A new name is written into the category text of its books.
+func (cc *CategoryController) UpdateCategory(c *gin.Context) {
+	category, ok := loadCategory(c)
+	if !ok || !authorize(c, policy.ActionCategoryUpdate, categoryAttributes(category)) {
+		return
+	}
+
+	var req categoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	before := category
+	if status, err := req.applyTo(initializers.DB, &category); err != nil {
+		c.AbortWithStatusJSON(status, gin.H{
+			"error":   "Invalid category",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&category).Error; err != nil {
+			return err
+		}
+		if category.Name == before.Name {
+			return nil
+		}
+		return refreshCategoryText(c, tx, category)
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update category",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionCategoryUpdated,
+		TargetType: "category",
+		TargetID:   category.ID,
+		Before:     before,
+		After:      category,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": category,
+	})
+}
+
+// DeleteCategory deletes a category without subcategories and books,
+// including the books in the trash
+func (cc *CategoryController) DeleteCategory(c *gin.Context) {
+	category, ok := loadCategory(c)
+	if !ok || !authorize(c, policy.ActionCategoryDelete, categoryAttributes(category)) {
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var children, books int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&types.Book{}).Where("category_id = ?", category.ID).Count(&books).Error; err != nil {
+			return err
+		}
+		if children > 0 || books > 0 {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error":   "Category is in use",
+				"details": fmt.Sprintf("Move its %d subcategories and %d book(s), including trashed ones, first", children, books),
+			})
+			return errAborted
+		}
+		return tx.Delete(&category).Error
+	})
+	if err == errAborted {
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete category",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionCategoryDeleted,
+		TargetType: "category",
+		TargetID:   category.ID,
+		Before:     category,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Category deleted successfully",
+	})
+}
+
+func derefUint(value *uint) uint {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/types"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var validCollaboratorRoles = map[string]bool{
+	models.CollaboratorViewer: true,
+	models.CollaboratorEditor: true,
+}
+
+// loadVisibleBook loads the book named by the :id URL parameter and checks
+// that the caller may perform action on it
+func loadVisibleBook(c *gin.Context, action string) (types.Book, bool) {
+	return loadBookFrom(c, visibleBooks(c, initializers.DB), action)
+}
+
+// loadBookFrom is loadVisibleBook for the books of the given query
+func loadBookFrom(c *gin.Context, books *gorm.DB, action string) (types.Book, bool) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid book ID format",
+			"details": "ID must be a numeric value",
+		})
+		return types.Book{}, false
+	}
+
+	var book types.Book
+	if err := books.First(&book, bookID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Book not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve book",
+				"details": err.Error(),
+			})
+		}
+		return types.Book{}, false
+	}
+
+	if !authorizeBook(c, action, book) {
+		return types.Book{}, false
+	}
+	return book, true
+}
+
+// GetCollaborators lists the users a book is shared with
+func (bc *BookController) GetCollaborators(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+
+	var collaborators []struct {
+		UserID    uint   `json:"user_id"`
+		Email     string `json:"email"`
+		Role      string `json:"role"`
+		AddedByID *uint  `json:"added_by_id"`
+	}
+	if err := initializers.DB.Table("book_collaborators").
+		Select("book_collaborators.user_id, users.email, book_collaborators.role, book_collaborators.added_by_id").
+		Joins("JOIN users ON users.id = book_collaborators.user_id").
+		Where("book_collaborators.book_id = ?", book.ID).
+		Order("book_collaborators.id").
+		Scan(&collaborators).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch collaborators",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": collaborators,
+	})
+}
+
+// AddCollaborator shares a book with a user by email, or changes the role of
+// an existing collaborator
+func (bc *BookController) AddCollaborator(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookShare)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if role == "" {
+		role = models.CollaboratorViewer
+	}
+	if !validCollaboratorRoles[role] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid role",
+		})
+		return
+	}
+
+	var user types.User
+	if err := initializers.DB.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(req.Email))).First(&user).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	if book.CreatedByID != nil && *book.CreatedByID == user.ID {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "User already owns this book",
+		})
+		return
+	}
+
+	collaborator := models.BookCollaborator{BookID: uint(book.ID), UserID: user.ID}
+	if err := initializers.DB.Where(&collaborator).FirstOrInit(&collaborator).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to add collaborator",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	status := http.StatusOK
+	var before interface{}
+	if collaborator.ID == 0 {
+		status = http.StatusCreated
+		collaborator.AddedByID = requestUserID(c)
+	} else {
+		before = gin.H{"user_id": user.ID, "role": collaborator.Role}
+	}
+	collaborator.Role = role
+
+	if err := initializers.DB.Save(&collaborator).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to add collaborator",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionCollaboratorAdded,
+		TargetType: "book",
+		TargetID:   book.ID,
+		Before:     before,
+		After:      gin.H{"user_id": user.ID, "role": role},
+	})
+
+	c.JSON(status, gin.H{
+		"data": collaborator,
+	})
+}
+
+// RemoveCollaborator stops sharing a book with a user
+func (bc *BookController) RemoveCollaborator(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookShare)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID format",
+			"details": "ID must be a numeric value",
+		})
+		return
+	}
+
+	var collaborator models.BookCollaborator
+	if err := initializers.DB.Where("book_id = ? AND user_id = ?", book.ID, userID).First(&collaborator).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Collaborator not found",
+		})
+		return
+	}
+
+	if err := initializers.DB.Delete(&collaborator).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to remove collaborator",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionCollaboratorRemoved,
+		TargetType: "book",
+		TargetID:   book.ID,
+		Before:     gin.H{"user_id": collaborator.UserID, "role": collaborator.Role},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Collaborator removed successfully",
+	})
+}
+
+// myBook is a book with the caller's relation to it
+type myBook struct {
+	types.Book
+	Relation string `json:"relation"`
+}
+
+// GetMyBooks lists the books the caller created or collaborates on, across
+// organizations, with the caller's relation to each. Filter with
+// relation=owner|editor|viewer.
+func (bc *BookController) GetMyBooks(c *gin.Context) {
+	user, _ := requestUser(c)
+
+	paging, err := newPaginator(c, bookSortKeys, "id", 10, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
+	}
+
+	query := initializers.DB.Table("books").
+		Joins("LEFT JOIN book_collaborators ON book_collaborators.book_id = books.id AND book_collaborators.user_id = ?", user.ID).
+		Where("books.deleted_at IS NULL")
+
+	switch relation := strings.ToLower(strings.TrimSpace(c.Query("relation"))); relation {
+	case "":
+		query = query.Where("books.created_by_id = ? OR book_collaborators.id IS NOT NULL", user.ID)
+	case "owner":
+		query = query.Where("books.created_by_id = ?", user.ID)
+	case models.CollaboratorViewer, models.CollaboratorEditor:
+		query = query.Where("book_collaborators.role = ?", relation)
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid relation",
+		})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var books []myBook
+	if err := paging.Apply(query.
+		Select("books.*, CASE WHEN books.created_by_id = ? THEN 'owner' ELSE book_collaborators.role END AS relation", user.ID)).
+		Scan(&books).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": books,
+		"meta": paging.Finish(c, &books, total),
+	})
+}
@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/covers"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/storage"
+	"authSystem/types"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCoverMaxBytes = 10 << 20
+
+	// coverImmutableMaxAge is how long browsers keep a cover fetched with
+	// its version in the URL, which changes when the cover does
+	coverImmutableMaxAge = 365 * 24 * 60 * 60
+)
+
+// coverMaxBytes is the largest cover upload, configured with
+// COVER_MAX_BYTES
+func coverMaxBytes() int64 {
+	size, err := strconv.ParseInt(os.Getenv("COVER_MAX_BYTES"), 10, 64)
+	if err != nil || size <= 0 {
+		size = defaultCoverMaxBytes
+	}
+	return size
+}
+
+// coverURLs are the URLs of the variants of a cover below prefix (the path
+// of the book), versioned so they can be cached for good
+func coverURLs(prefix string, cover models.BookCover) map[string]string {
+	urls := map[string]string{}
+	variants, _ := covers.ParseVariants(cover)
+	for _, variant := range variants {
+		urls[variant.Name] = fmt.Sprintf("%s/cover/%s?v=%s", prefix, variant.Name, cover.Hash)
+	}
+	return urls
+}
+
+// coversByBook loads the covers of several books at once, by book ID
+func coversByBook(books []types.Book) (map[uint]models.BookCover, error) {
+	byBook := map[uint]models.BookCover{}
+	if len(books) == 0 {
+		return byBook, nil
+	}
+	ids := make([]int, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	var list []models.BookCover
+	if err := initializers.DB.Where("book_id IN ?", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, cover := range list {
+		byBook[cover.BookID] = cover
+	}
+	return byBook, nil
+}
+
+func coverResponse(book types.Book, cover models.BookCover) gin.H {
+	return gin.H{
+		"data": cover,
+		"meta": gin.H{"urls": coverURLs(fmt.Sprintf("/api/book/%d", book.ID), cover)},
+	}
+}
+
+// loadBookCover loads the cover of a book, aborting with 404 when it has
+// none
+func loadBookCover(c *gin.Context, book types.Book) (models.BookCover, bool) {
+	var cover models.BookCover
+	if err := initializers.DB.Where("book_id = ?", book.ID).First(&cover).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Book has no cover",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve cover",
+				"details": err.Error(),
+			})
+		}
+		return cover, false
+	}
+	return cover, true
+}
+
+// readCoverUpload reads an uploaded image from the request body, or from
+// the cover field of a multipart form, and the type it was declared as
+func readCoverUpload(c *gin.Context) ([]byte, string, bool) {
+	maxBytes := coverMaxBytes()
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64<<10)
+
+	var body io.Reader = c.Request.Body
+	declaredType := c.ContentType()
+	if strings.HasPrefix(declaredType, "multipart/form-data") {
+		file, header, err := c.Request.FormFile("cover")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortCoverTooLarge(c, maxBytes)
+			} else {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid cover upload",
+					"details": err.Error(),
+				})
+			}
+			return nil, "", false
+		}
+		defer file.Close()
+		body = file
+		declaredType, _, _ = mime.ParseMediaType(header.Header.Get("Content-Type"))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortCoverTooLarge(c, maxBytes)
+		} else {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid cover upload",
+				"details": err.Error(),
+			})
+		}
+		return nil, "", false
+	}
+	if int64(len(data)) > maxBytes {
+		abortCoverTooLarge(c, maxBytes)
+		return nil, "", false
+	}
+	if len(data) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid cover upload",
+			"details": "The upload is empty",
+		})
+		return nil, "", false
+	}
+	return data, declaredType, true
+}
+
+func abortCoverTooLarge(c *gin.Context, maxBytes int64) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":   "Cover is too large",
+		"details": fmt.Sprintf("Covers must be at most %d bytes", maxBytes),
+	})
+}
+
+// PutCover sets the cover of a book from a JPEG, PNG or WebP image, sent as
+// the request body or as the cover field of a multipart form. The image is
+// checked by its content, stripped of its metadata and stored with its
+// thumbnails; the previous cover is removed.
+func (bc *BookController) PutCover(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookUpdate)
+	if !ok {
+		return
+	}
+	data, declaredType, ok := readCoverUpload(c)
+	if !ok {
+		return
+	}
+
+	img, err := covers.Process(data, declaredType)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, covers.ErrUnsupportedType) || errors.Is(err, covers.ErrTypeMismatch) {
+			status = http.StatusUnsupportedMediaType
+		}
+		c.AbortWithStatusJSON(status, gin.H{
+			"error":   "Invalid cover image",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var previous models.BookCover
+	if err := initializers.DB.Where("book_id = ?", book.ID).Limit(1).Find(&previous).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve cover",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	store := storage.Default()
+	cover, err := covers.Save(c.Request.Context(), store, models.BookCover{
+		ID:             previous.ID,
+		CreatedAt:      previous.CreatedAt,
+		BookID:         uint(book.ID),
+		OrganizationID: book.OrganizationID,
+		UploadedByID:   requestUserID(c),
+	}, img)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to store cover",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// The same image uploaded again is stored under the same keys
+	replaced := previous.ID != 0 && covers.Key(previous, "original") != covers.Key(cover, "original")
+	if err := initializers.DB.Save(&cover).Error; err != nil {
+		if previous.ID == 0 || replaced {
+			covers.Discard(c.Request.Context(), store, cover)
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to save cover",
+			"details": err.Error(),
+		})
+		return
+	}
+	if replaced {
+		covers.Discard(c.Request.Context(), store, previous)
+	}
+
+	event := audit.Event{
+		Action:     audit.ActionBookCoverUpdated,
+		TargetType: "book",
+		TargetID:   book.ID,
+		After:      cover,
+	}
+	if previous.ID != 0 {
+		event.Before = previous
+	}
+	audit.Record(c, event)
+
+	c.JSON(http.StatusOK, coverResponse(book, cover))
+}
+
+// GetCover describes the cover of a book and where its variants are
+func (bc *BookController) GetCover(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+	cover, ok := loadBookCover(c, book)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, coverResponse(book, cover))
+}
+
+// GetCoverImage serves a variant of a book's cover. Requests naming the
+// current version with ?v= may be cached for good, others are revalidated
+// with the ETag.
+func (bc *BookController) GetCoverImage(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+	cover, ok := loadBookCover(c, book)
+	if !ok {
+		return
+	}
+	size := c.Param("size")
+	if !covers.HasSize(cover, size) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error":   "Cover size not found",
+			"details": "size must be one of original, large, medium or small",
+		})
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%s"`, cover.Hash, size)
+	c.Header("ETag", etag)
+	if c.Query("v") == cover.Hash {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", coverImmutableMaxAge))
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+	}
+	if etagMatches(c.GetHeader("If-None-Match"), etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	reader, info, err := storage.Default().Get(c.Request.Context(), covers.Key(cover, size))
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		if errors.Is(err, storage.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Cover file not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to read cover",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, info.Size, cover.ContentType, reader, map[string]string{
+		"Last-Modified":          cover.UpdatedAt.UTC().Format(http.TimeFormat),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// DeleteCover removes the cover of a book
+func (bc *BookController) DeleteCover(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookUpdate)
+	if !ok {
+		return
+	}
+	cover, ok := loadBookCover(c, book)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Delete(&cover).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to remove cover",
+			"details": err.Error(),
+		})
+		return
+	}
+	covers.Discard(c.Request.Context(), storage.Default(), cover)
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBookCoverRemoved,
+		TargetType: "book",
+		TargetID:   book.ID,
+		Before:     cover,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cover removed successfully",
+	})
+}
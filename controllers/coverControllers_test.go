@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"authSystem/middleware"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countingReader is a body of size bytes that counts how many were read
+type countingReader struct {
+	size, read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.read >= r.size {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if n > r.size-r.read {
+		n = r.size - r.read
+	}
+	r.read += n
+	return int(n), nil
+}
+
+func TestReadCoverUploadStopsAtLimit(t *testing.T) {
+	t.Setenv("COVER_MAX_BYTES", "1024")
+	router := gin.New()
+	router.Use(middleware.Logger())
+	router.PUT("/cover", func(c *gin.Context) {
+		if data, _, ok := readCoverUpload(c); ok {
+			t.Errorf("readCoverUpload() read %d bytes of an oversized upload", len(data))
+		}
+	})
+
+	for _, contentType := range []string{"image/jpeg", "multipart/form-data; boundary=x"} {
+		body := &countingReader{size: 100 << 20}
+		req := httptest.NewRequest(http.MethodPut, "/cover", body)
+		req.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if contentType == "image/jpeg" && recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status %d, want 413", contentType, recorder.Code)
+		}
+		if body.read > 1<<20 {
+			t.Errorf("%s: read %d bytes of the upload, want it to stop near the limit", contentType, body.read)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/export"
+	"authSystem/initializers"
+	"authSystem/jobs"
+	"authSystem/models"
+	"authSystem/types"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// bookExportColumns are the columns of a catalog export
+var bookExportColumns = []string{
+	"id", "title", "subtitle", "author", "category", "isbn", "publisher",
+	"publication_date", "language", "page_count", "edition", "description",
+	"version", "created_at", "updated_at",
+}
+
+func bookExportRow(book types.Book) []interface{} {
+	return []interface{}{
+		book.ID, book.Title, book.Subtitle, book.Author, book.Category, book.ISBN, book.Publisher,
+		book.PublicationDate, book.Language, book.PageCount, book.Edition, book.Description,
+		book.Version, book.CreatedAt, book.UpdatedAt,
+	}
+}
+
+// exportJobView is an export job with the link to its file once it is done
+type exportJobView struct {
+	models.ExportJob
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+func newExportJobView(job models.ExportJob) exportJobView {
+	view := exportJobView{ExportJob: job}
+	if job.Status == models.ExportDone {
+		view.DownloadURL = fmt.Sprintf("/admin/books/exports/%d/download", job.ID)
+	}
+	return view
+}
+
+// exportedBooks returns the books of an organization that match the filters
+// of GetAllBooks in params
+func exportedBooks(params url.Values, orgID uint) (*gorm.DB, error) {
+	query, _, err := filterBookParams(params, orgID, initializers.DB.Model(&types.Book{}).Where("organization_id = ?", orgID))
+	return query, err
+}
+
+// exportOptions reads the format and gzip parameters of an export
+func exportOptions(c *gin.Context) (export.Format, bool, bool) {
+	format, err := export.Lookup(c.DefaultQuery("format", export.FormatCSV))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid export format",
+			"details": err.Error(),
+		})
+		return format, false, false
+	}
+	return format, c.Query("gzip") == "true", true
+}
+
+// writeBookExport streams the books a query selects, in ID order, to w and
+// returns the number of books written
+func writeBookExport(ctx context.Context, query *gorm.DB, format export.Format, gzipped bool, w io.Writer) (int64, error) {
+	rows, err := query.WithContext(ctx).Order("books.id").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	writer, err := export.NewWriter(format, w, bookExportColumns, gzipped)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for rows.Next() {
+		var book types.Book
+		if err := initializers.DB.ScanRows(rows, &book); err != nil {
+			return count, err
+		}
+		if err := writer.WriteRow(bookExportRow(book)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, writer.Close()
+}
+
+// RunBookExport writes the file of a background export job, applying the
+// filters stored with the job
+func RunBookExport(ctx context.Context, job models.ExportJob, w io.Writer) (int64, error) {
+	format, err := export.Lookup(job.Format)
+	if err != nil {
+		return 0, err
+	}
+
+	params, err := url.ParseQuery(job.Query)
+	if err != nil {
+		return 0, err
+	}
+	query, err := exportedBooks(params, job.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+	return writeBookExport(ctx, query, format, job.Gzip, w)
+}
+
+// ExportBooks streams the books of the active organization matching the
+// filters of GetAllBooks as csv, ndjson or xlsx (format), gzipped with
+// gzip=true
+func (bc *BookController) ExportBooks(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	format, gzipped, ok := exportOptions(c)
+	if !ok {
+		return
+	}
+
+	query, err := exportedBooks(c.Request.URL.Query(), orgID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search query",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBooksExported,
+		TargetType: "organization",
+		TargetID:   orgID,
+		After:      gin.H{"format": format.Name, "query": c.Request.URL.RawQuery},
+	})
+
+	contentType := format.ContentType
+	if gzipped {
+		contentType = "application/gzip"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+format.Filename("books", time.Now(), gzipped)+`"`)
+	c.Status(http.StatusOK)
+
+	// The response has started, errors can only be logged
+	if _, err := writeBookExport(c.Request.Context(), query, format, gzipped, c.Writer); err != nil {
+		c.Error(err)
+	}
+}
+
+// CreateBookExport queues an export of the books of the active organization
+// with the same parameters as ExportBooks, to be downloaded once it is done
+func (bc *BookController) CreateBookExport(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	format, gzipped, ok := exportOptions(c)
+	if !ok {
+		return
+	}
+
+	// Check the filters now rather than when the job runs
+	if _, err := exportedBooks(c.Request.URL.Query(), orgID); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search query",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	filters := c.Request.URL.Query()
+	filters.Del("format")
+	filters.Del("gzip")
+	job := models.ExportJob{
+		OrganizationID: orgID,
+		RequestedByID:  requestUserID(c),
+		Format:         format.Name,
+		Gzip:           gzipped,
+		Query:          filters.Encode(),
+		Status:         models.ExportPending,
+	}
+	if err := initializers.DB.Create(&job).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create export",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBooksExported,
+		TargetType: "organization",
+		TargetID:   orgID,
+		After:      job,
+	})
+
+	c.Header("Location", fmt.Sprintf("/admin/books/exports/%d", job.ID))
+	c.JSON(http.StatusAccepted, gin.H{
+		"data": newExportJobView(job),
+	})
+}
+
+// GetBookExports lists the 50 latest export jobs of the active organization
+func (bc *BookController) GetBookExports(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	var exportJobs []models.ExportJob
+	if err := initializers.DB.Where("organization_id = ?", orgID).
+		Order("id DESC").Limit(50).Find(&exportJobs).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch exports",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	views := make([]exportJobView, 0, len(exportJobs))
+	for _, job := range exportJobs {
+		views = append(views, newExportJobView(job))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": views,
+	})
+}
+
+// loadExportJob loads the export job of the active organization named by the
+// :id URL parameter
+func loadExportJob(c *gin.Context) (models.ExportJob, bool) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return models.ExportJob{}, false
+	}
+
+	jobID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid export ID format",
+			"details": "ID must be a numeric value",
+		})
+		return models.ExportJob{}, false
+	}
+
+	var job models.ExportJob
+	if err := initializers.DB.Where("organization_id = ?", orgID).First(&job, jobID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Export not found",
+		})
+		return models.ExportJob{}, false
+	}
+	return job, true
+}
+
+// GetBookExport returns the status of an export job
+func (bc *BookController) GetBookExport(c *gin.Context) {
+	job, ok := loadExportJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": newExportJobView(job),
+	})
+}
+
+// DownloadBookExport serves the file of a finished export job
+func (bc *BookController) DownloadBookExport(c *gin.Context) {
+	job, ok := loadExportJob(c)
+	if !ok {
+		return
+	}
+
+	switch job.Status {
+	case models.ExportDone:
+	case models.ExportExpired:
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{
+			"error": "Export has expired",
+		})
+		return
+	default:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":   "Export is not ready",
+			"details": "The export is " + job.Status,
+		})
+		return
+	}
+
+	format, err := export.Lookup(job.Format)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Invalid export format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	contentType := format.ContentType
+	if job.Gzip {
+		contentType = "application/gzip"
+	}
+	c.Header("Content-Type", contentType)
+	c.FileAttachment(jobs.ExportPath(job), format.Filename("books", job.CreatedAt, job.Gzip))
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxFacetBuckets caps the buckets returned per facet
+const maxFacetBuckets = 20
+
+// facet groups a listing by the value of an expression
+type facet struct {
+	Name string
+	// Expr is the SQL expression of a row's bucket; empty values are left out
+	Expr string
+}
+
+// bookFacets are the facets of the book listing. Decades are named like
+// "1990s" after the publication date.
+var bookFacets = []facet{
+	{Name: "category", Expr: "TRIM(COALESCE(books.category, ''))"},
+	{Name: "author", Expr: "TRIM(COALESCE(books.author, ''))"},
+	{Name: "decade", Expr: "CASE WHEN books.publication_date <> '' THEN LEFT(books.publication_date, 3) || '0s' ELSE '' END"},
+	{Name: "language", Expr: "books.language"},
+}
+
+// facetBucket is one value of a facet with the number of matching rows
+type facetBucket struct {
+	Value    string `json:"value"`
+	Count    int64  `json:"count"`
+	Selected bool   `json:"selected"`
+}
+
+// selectedFacetValues returns the values selected for a facet with repeated
+// facet.<name> parameters
+func selectedFacetValues(c *gin.Context, f facet) []string {
+	var values []string
+	for _, value := range c.QueryArray("facet." + f.Name) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// filterFacets restricts query to the selected facet values: a row must match
+// one of the values of every facet with a selection (OR within a facet, AND
+// across facets). The facet named except is skipped, so that its own counts
+// still show the alternatives.
+func filterFacets(c *gin.Context, query *gorm.DB, facets []facet, except string) *gorm.DB {
+	for _, f := range facets {
+		if f.Name == except {
+			continue
+		}
+		if values := selectedFacetValues(c, f); len(values) > 0 {
+			query = query.Where(f.Expr+" IN ?", values)
+		}
+	}
+	return query
+}
+
+// countFacets computes the buckets of the facets requested with facets=
+// (all by default, "none" for none). base must return a fresh query with the
+// listing's other filters applied.
+func countFacets(c *gin.Context, base func() *gorm.DB, facets []facet) (map[string][]facetBucket, error) {
+	requested := map[string]bool{}
+	if param, ok := c.GetQuery("facets"); ok {
+		for _, name := range strings.Split(param, ",") {
+			requested[strings.TrimSpace(name)] = true
+		}
+	}
+
+	counts := map[string][]facetBucket{}
+	for _, f := range facets {
+		if len(requested) > 0 && !requested[f.Name] {
+			continue
+		}
+
+		buckets := []facetBucket{}
+		if err := filterFacets(c, base(), facets, f.Name).
+			Select(f.Expr + " AS value, COUNT(*) AS count").
+			Where(f.Expr + " <> ''").
+			Group("value").
+			Order("count DESC, value").
+			Limit(maxFacetBuckets).
+			Scan(&buckets).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s facet: %w", f.Name, err)
+		}
+
+		listed := map[string]int{}
+		for i, bucket := range buckets {
+			listed[bucket.Value] = i
+		}
+		for _, value := range selectedFacetValues(c, f) {
+			if i, ok := listed[value]; ok {
+				buckets[i].Selected = true
+				continue
+			}
+			// Selected values without matches are still shown so they can be cleared
+			buckets = append(buckets, facetBucket{Value: value, Selected: true})
+			listed[value] = len(buckets) - 1
+		}
+
+		counts[f.Name] = buckets
+	}
+	return counts, nil
+}
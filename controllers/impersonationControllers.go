@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/middleware"
+	"authSystem/types"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	// impersonatorCookie keeps the admin's own token while impersonating so it can be restored
+	impersonatorCookie = "Impersonator"
+
+	defaultImpersonationTTL = 15 * time.Minute
+	maxImpersonationTTL     = time.Hour
+)
+
+// ImpersonateUser issues a short-lived token that lets an admin act as another user
+func (uc *UserController) ImpersonateUser(c *gin.Context) {
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID format",
+			"details": "ID must be a numeric value",
+		})
+		return
+	}
+
+	var body struct {
+		Reason          string `json:"reason"`
+		DurationMinutes int    `json:"duration_minutes"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	ttl := defaultImpersonationTTL
+	if body.DurationMinutes > 0 {
+		ttl = time.Duration(body.DurationMinutes) * time.Minute
+	}
+	if ttl > maxImpersonationTTL {
+		ttl = maxImpersonationTTL
+	}
+
+	currentUser, _ := c.Get("user")
+	admin := currentUser.(types.User)
+
+	if uint(targetID) == admin.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "You cannot impersonate yourself",
+		})
+		return
+	}
+
+	var target types.User
+	if err := initializers.DB.First(&target, targetID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve user",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	// Admins can't be impersonated, otherwise the token would grant admin access
+	if target.Role == "admin" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Admin accounts cannot be impersonated",
+		})
+		return
+	}
+
+	adminToken, err := c.Cookie("Authorization")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Impersonation requires a cookie-based admin session",
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	tokenString, err := generateToken(jwt.MapClaims{
+		"sub": target.ID,
+		"exp": expiresAt.Unix(),
+		"act": map[string]interface{}{
+			"sub":   admin.ID,
+			"email": admin.Email,
+		},
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate the token",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionImpersonationStart,
+		TargetType: "user",
+		TargetID:   target.ID,
+		After: gin.H{
+			"reason":     body.Reason,
+			"expires_at": expiresAt,
+		},
+	})
+
+	// Stash the admin token so the session can be restored when impersonation ends
+	c.SetCookie(impersonatorCookie, adminToken, 3600*24, "", "", false, true)
+	c.SetCookie("Authorization", tokenString, int(ttl.Seconds()), "", "", false, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Impersonation started",
+		"user":       target,
+		"token":      tokenString,
+		"expires_at": expiresAt,
+	})
+}
+
+// EndImpersonation drops the impersonation token and restores the admin session
+func EndImpersonation(c *gin.Context) {
+	impersonator, ok := c.Get("impersonator")
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "No active impersonation",
+		})
+		return
+	}
+	admin := impersonator.(types.User)
+	currentUser, _ := c.Get("user")
+	target := currentUser.(types.User)
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionImpersonationEnd,
+		TargetType: "user",
+		TargetID:   target.ID,
+	})
+
+	c.SetCookie(impersonatorCookie, "", -1, "", "", false, true)
+
+	// Only restore the stashed token if it is still valid and belongs to the impersonating admin
+	adminToken, err := c.Cookie(impersonatorCookie)
+	if err == nil {
+		if claims, err := middleware.ParseToken(adminToken); err == nil {
+			if sub, ok := claims["sub"].(float64); ok && uint(sub) == admin.ID {
+				exp := time.Unix(int64(claims["exp"].(float64)), 0)
+				c.SetCookie("Authorization", adminToken, int(time.Until(exp).Seconds()), "", "", false, true)
+				c.JSON(http.StatusOK, gin.H{
+					"message": "Impersonation ended, admin session restored",
+					"user":    admin,
+				})
+				return
+			}
+		}
+	}
+
+	c.SetCookie("Authorization", "", -1, "", "", false, true)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Impersonation ended, please log in again",
+	})
+}
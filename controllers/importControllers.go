@@ -0,0 +1,640 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/biblio"
+	"authSystem/credits"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/types"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Conflict modes of an import, for rows that duplicate an existing book or
+// an earlier row
+const (
+	importConflictSkip   = "skip"
+	importConflictUpdate = "update"
+	importConflictFail   = "fail"
+)
+
+const (
+	importBatchSize    = 500
+	maxImportErrors    = 100
+	maxImportLineBytes = 1 << 20
+)
+
+// importFields are the book fields an import can set, by their JSON names
+var importFields = map[string]bool{
+	"title": true, "subtitle": true, "author": true, "category": true,
+	"isbn": true, "publisher": true, "publication_date": true, "language": true,
+	"page_count": true, "edition": true, "description": true,
+}
+
+var errImportRolledBack = errors.New("import rolled back")
+
+// importRow is a row of an import with the book fields it sets; Line is
+// where it starts in the file
+type importRow struct {
+	Line   int
+	Fields map[string]interface{}
+	Err    error
+}
+
+// importRowError reports why a row wasn't imported
+type importRowError struct {
+	Line   int    `json:"line"`
+	Error  string `json:"error"`
+	BookID int    `json:"book_id,omitempty"`
+}
+
+// importReport sums up an import
+type importReport struct {
+	Format         string           `json:"format"`
+	OnConflict     string           `json:"on_conflict"`
+	DryRun         bool             `json:"dry_run"`
+	Committed      bool             `json:"committed"`
+	Rows           int              `json:"rows"`
+	Created        int              `json:"created"`
+	Updated        int              `json:"updated"`
+	Unchanged      int              `json:"unchanged"`
+	Skipped        int              `json:"skipped"`
+	Failed         int              `json:"failed"`
+	IgnoredColumns []string         `json:"ignored_columns"`
+	Errors         []importRowError `json:"errors"`
+}
+
+// importReader reads the rows of an import one at a time and returns io.EOF
+// after the last one
+type importReader interface {
+	Next() (importRow, error)
+}
+
+// importColumns maps the columns of an import to book fields: a column is
+// renamed by the mapping or else used when it names a field, ignoring case,
+// spaces and dashes. Other columns are ignored.
+type importColumns struct {
+	mapping map[string]string
+	ignored map[string]bool
+}
+
+func (ic *importColumns) field(column string) (string, bool) {
+	if field, ok := ic.mapping[column]; ok {
+		return field, field != ""
+	}
+	normalized := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(column)))
+	if importFields[normalized] {
+		return normalized, true
+	}
+	ic.ignored[column] = true
+	return "", false
+}
+
+// csvReadAhead is how far encoding/csv may have read past the record it
+// returned, the size of its bufio.Reader
+const csvReadAhead = 4096
+
+// csvRecordLimiter keeps a CSV reader from buffering a record longer than
+// maxImportLineBytes, e.g. when a quote is never closed: it won't read that
+// far past the end of the previous record
+type csvRecordLimiter struct {
+	r     io.Reader
+	read  int64
+	limit int64
+}
+
+func (l *csvRecordLimiter) Read(p []byte) (int, error) {
+	if l.read >= l.limit {
+		return 0, fmt.Errorf("a record is longer than %d bytes", maxImportLineBytes)
+	}
+	if int64(len(p)) > l.limit-l.read {
+		p = p[:l.limit-l.read]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// next allows reading the record after the one ending at offset
+func (l *csvRecordLimiter) next(offset int64) {
+	l.limit = offset + maxImportLineBytes + csvReadAhead
+}
+
+// csvImportReader reads CSV with a header row
+type csvImportReader struct {
+	reader  *csv.Reader
+	limiter *csvRecordLimiter
+	columns *importColumns
+	header  []string
+}
+
+func newCSVImportReader(r io.Reader, delimiter rune, columns *importColumns) (*csvImportReader, error) {
+	limiter := &csvRecordLimiter{r: r}
+	limiter.next(0)
+	reader := csv.NewReader(limiter)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("the file is empty, a header row is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	limiter.next(reader.InputOffset())
+	ir := &csvImportReader{reader: reader, limiter: limiter, columns: columns}
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		field, _ := columns.field(column)
+		ir.header = append(ir.header, field)
+	}
+	return ir, nil
+}
+
+func (ir *csvImportReader) Next() (importRow, error) {
+	record, err := ir.reader.Read()
+	ir.limiter.next(ir.reader.InputOffset())
+	if err == io.EOF {
+		return importRow{}, err
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return importRow{Line: parseErr.StartLine, Err: parseErr.Err}, nil
+		}
+		return importRow{}, err
+	}
+
+	line, _ := ir.reader.FieldPos(0)
+	row := importRow{Line: line, Fields: map[string]interface{}{}}
+	for i, value := range record {
+		if i >= len(ir.header) || ir.header[i] == "" {
+			continue
+		}
+		if ir.header[i] != "page_count" {
+			row.Fields[ir.header[i]] = value
+			continue
+		}
+		pages := 0
+		if value = strings.TrimSpace(value); value != "" {
+			if pages, err = strconv.Atoi(value); err != nil {
+				row.Err = fmt.Errorf("page_count: %q is not a number", value)
+			}
+		}
+		row.Fields["page_count"] = pages
+	}
+	return row, nil
+}
+
+// ndjsonImportReader reads one JSON object per line; blank lines are skipped
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	columns *importColumns
+	line    int
+}
+
+func newNDJSONImportReader(r io.Reader, columns *importColumns) *ndjsonImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineBytes)
+	return &ndjsonImportReader{scanner: scanner, columns: columns}
+}
+
+func (ir *ndjsonImportReader) Next() (importRow, error) {
+	for ir.scanner.Scan() {
+		ir.line++
+		data := bytes.TrimSpace(ir.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := importRow{Line: ir.line, Fields: map[string]interface{}{}}
+		var object map[string]interface{}
+		if err := json.Unmarshal(data, &object); err != nil {
+			row.Err = fmt.Errorf("not a JSON object: %v", err)
+			return row, nil
+		}
+		for key, value := range object {
+			if field, ok := ir.columns.field(key); ok {
+				row.Fields[field] = value
+			}
+		}
+		return row, nil
+	}
+	if err := ir.scanner.Err(); err != nil {
+		return importRow{}, err
+	}
+	return importRow{}, io.EOF
+}
+
+// importer imports rows into an organization within a transaction, a batch
+// at a time
+type importer struct {
+	c      *gin.Context
+	tx     *gorm.DB
+	orgID  uint
+	report *importReport
+
+	// seen maps the duplicate keys of the rows so far to their lines
+	seen map[string]int
+}
+
+// fail records a row that wasn't imported
+func (im *importer) fail(line int, bookID int, err error) {
+	im.report.Failed++
+	if len(im.report.Errors) < maxImportErrors {
+		im.report.Errors = append(im.report.Errors, importRowError{Line: line, Error: err.Error(), BookID: bookID})
+	}
+}
+
+// bookFrom overlays the fields of a row onto req and checks the resulting
+// book the way validateBook does, without the duplicate check
+func (im *importer) bookFrom(row importRow, req types.AddBookRequest, book types.Book) (types.Book, error) {
+	raw, _ := json.Marshal(row.Fields)
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return book, fmt.Errorf("%s: must be a %s", typeErr.Field, typeErr.Type)
+		}
+		return book, err
+	}
+	req.ApplyTo(&book)
+
+	if strings.TrimSpace(book.Title) == "" {
+		return book, fmt.Errorf("title is required")
+	}
+	if strings.TrimSpace(book.Author) == "" {
+		return book, fmt.Errorf("author is required")
+	}
+	if err := normalizeBookMetadata(&book); err != nil {
+		return book, err
+	}
+	if err := linkBookCategory(im.tx, &book); err != nil {
+		return book, fmt.Errorf("category %q: %w", book.Category, err)
+	}
+	return book, nil
+}
+
+// duplicateKey identifies the books a book would duplicate under the rules
+// of validateBook: the same ISBN, or the same title when it has none
+func duplicateKey(book types.Book) string {
+	if book.ISBN != "" {
+		return "isbn:" + book.ISBN
+	}
+	return titleKey(book)
+}
+
+// titleKey is the duplicate key of a book's title, which books without an
+// ISBN are matched by whether or not the book they duplicate has one
+func titleKey(book types.Book) string {
+	return "title:" + strings.ToLower(strings.TrimSpace(book.Title))
+}
+
+// importBatch imports a batch of rows: it finds the books they duplicate
+// with a single query, updates or skips those according to onConflict and
+// inserts the rest together
+func (im *importer) importBatch(rows []importRow, onConflict string) error {
+	type candidate struct {
+		line int
+		row  importRow
+		book types.Book
+		key  string
+	}
+
+	var candidates []candidate
+	var isbns, titles []string
+	for _, row := range rows {
+		if row.Err != nil {
+			im.fail(row.Line, 0, row.Err)
+			continue
+		}
+
+		book, err := im.bookFrom(row, types.AddBookRequest{}, types.Book{
+			OrganizationID: im.orgID,
+			CreatedByID:    requestUserID(im.c),
+			UpdatedByID:    requestUserID(im.c),
+			Version:        1,
+		})
+		if err != nil {
+			im.fail(row.Line, 0, err)
+			continue
+		}
+
+		key := duplicateKey(book)
+		if line, ok := im.seen[key]; ok {
+			if onConflict == importConflictSkip {
+				im.report.Skipped++
+			} else {
+				im.fail(row.Line, 0, fmt.Errorf("duplicates the book of line %d", line))
+			}
+			continue
+		}
+		im.seen[key] = row.Line
+		// Later rows without an ISBN duplicate this one by its title
+		if _, ok := im.seen[titleKey(book)]; !ok {
+			im.seen[titleKey(book)] = row.Line
+		}
+
+		if book.ISBN != "" {
+			isbns = append(isbns, book.ISBN)
+		} else {
+			titles = append(titles, strings.ToLower(strings.TrimSpace(book.Title)))
+		}
+		candidates = append(candidates, candidate{line: row.Line, row: row, book: book, key: key})
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Books without an ISBN duplicate any book with their title
+	matches := im.tx.Where("1 = 0")
+	if len(isbns) > 0 {
+		matches = matches.Or("isbn IN ?", isbns)
+	}
+	if len(titles) > 0 {
+		matches = matches.Or("LOWER(TRIM(title)) IN ?", titles)
+	}
+	var existing []types.Book
+	if err := im.tx.Where("organization_id = ?", im.orgID).Where(matches).Find(&existing).Error; err != nil {
+		return err
+	}
+	duplicates := map[string]types.Book{}
+	for _, book := range existing {
+		if book.ISBN != "" {
+			duplicates["isbn:"+book.ISBN] = book
+		}
+		title := titleKey(book)
+		if _, ok := duplicates[title]; !ok {
+			duplicates[title] = book
+		}
+	}
+
+	var created []types.Book
+	for _, candidate := range candidates {
+		current, duplicate := duplicates[candidate.key]
+		if !duplicate {
+			if decision := decide(im.c, policy.ActionBookCreate, bookAttributes(candidate.book)); !decision.Allowed {
+				im.fail(candidate.line, 0, fmt.Errorf("forbidden: %s", decision.Reason))
+				continue
+			}
+			created = append(created, candidate.book)
+			continue
+		}
+
+		switch onConflict {
+		case importConflictSkip:
+			im.report.Skipped++
+		case importConflictFail:
+			conflict := "a book with this title already exists"
+			if candidate.book.ISBN != "" {
+				conflict = "a book with this ISBN already exists"
+			}
+			im.fail(candidate.line, current.ID, errors.New(conflict))
+		case importConflictUpdate:
+			if err := im.updateBook(candidate.line, candidate.row, current); err != nil {
+				return err
+			}
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+
+	if err := im.tx.Create(&created).Error; err != nil {
+		return err
+	}
+	for _, book := range created {
+		if err := credits.Sync(im.tx, uint(book.ID), book.OrganizationID, book.Author); err != nil {
+			return err
+		}
+		if err := recordBookRevision(im.c, im.tx, models.RevisionCreate, nil, book, nil); err != nil {
+			return err
+		}
+	}
+	im.report.Created += len(created)
+	return nil
+}
+
+// updateBook overwrites the fields of an existing book that a row sets, the
+// way saveBookUpdate does
+func (im *importer) updateBook(line int, row importRow, before types.Book) error {
+	if decision := decide(im.c, policy.ActionBookUpdate, bookAttributes(before)); !decision.Allowed {
+		im.fail(line, before.ID, fmt.Errorf("forbidden: %s", decision.Reason))
+		return nil
+	}
+
+	book, err := im.bookFrom(row, types.BookRequestFrom(before), before)
+	if err != nil {
+		im.fail(line, before.ID, err)
+		return nil
+	}
+	if types.BookRequestFrom(book) == types.BookRequestFrom(before) {
+		im.report.Unchanged++
+		return nil
+	}
+	if decision := decide(im.c, policy.ActionBookUpdate, bookAttributes(book)); !decision.Allowed {
+		im.fail(line, before.ID, fmt.Errorf("forbidden: %s", decision.Reason))
+		return nil
+	}
+
+	book.UpdatedByID = requestUserID(im.c)
+	book.Version = before.Version + 1
+	if err := im.tx.Model(&book).
+		Select("*").
+		Omit("id", "organization_id", "created_by_id", "created_at").
+		Updates(&book).Error; err != nil {
+		return err
+	}
+	if book.Author != before.Author {
+		if err := credits.Sync(im.tx, uint(book.ID), book.OrganizationID, book.Author); err != nil {
+			return err
+		}
+	}
+	if err := recordBookRevision(im.c, im.tx, models.RevisionUpdate, &before, book, nil); err != nil {
+		return err
+	}
+	im.report.Updated++
+	return nil
+}
+
+// ImportBooks imports books into the active organization from a CSV file
+// with a header row (text/csv) or JSON Lines (application/x-ndjson), read as
+// a stream. Columns named like book fields are imported; map[column]=field
+// renames others (an empty field ignores the column). on_conflict decides
+// what happens to rows duplicating a book by the rules of CreateBook: fail
+// (default) reports them as errors, skip leaves the book alone and update
+// overwrites the fields the row sets.
+//
+// The import runs in a single transaction and is only committed when every
+// row is valid; dry_run=true reports what would happen without committing.
+func (bc *BookController) ImportBooks(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	report := importReport{
+		OnConflict:     c.DefaultQuery("on_conflict", importConflictFail),
+		DryRun:         c.Query("dry_run") == "true",
+		IgnoredColumns: []string{},
+		Errors:         []importRowError{},
+	}
+	switch report.OnConflict {
+	case importConflictSkip, importConflictUpdate, importConflictFail:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid on_conflict",
+			"details": "on_conflict must be skip, update or fail",
+		})
+		return
+	}
+
+	columns := &importColumns{mapping: c.QueryMap("map"), ignored: map[string]bool{}}
+	for column, field := range columns.mapping {
+		if field != "" && !importFields[field] {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid column mapping",
+				"details": fmt.Sprintf("Column %q is mapped to %q, which is not a book field", column, field),
+			})
+			return
+		}
+	}
+
+	if !authorizeBook(c, policy.ActionBookCreate, types.Book{OrganizationID: orgID}) {
+		return
+	}
+
+	var reader importReader
+	switch contentType := c.ContentType(); contentType {
+	case "text/csv":
+		delimiter, size := utf8.DecodeRuneInString(c.DefaultQuery("delimiter", ","))
+		if size == 0 || size != len(c.DefaultQuery("delimiter", ",")) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid delimiter",
+				"details": "delimiter must be a single character",
+			})
+			return
+		}
+		csvReader, err := newCSVImportReader(c.Request.Body, delimiter, columns)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid CSV",
+				"details": err.Error(),
+			})
+			return
+		}
+		report.Format, reader = "csv", csvReader
+	case "application/x-ndjson", "application/jsonl", "application/json-lines":
+		report.Format, reader = "ndjson", newNDJSONImportReader(c.Request.Body, columns)
+	case biblio.MediaTypes[biblio.FormatMARCXML], biblio.MediaTypes[biblio.FormatMARC]:
+		format := biblio.FormatMARCXML
+		if contentType == biblio.MediaTypes[biblio.FormatMARC] {
+			format = biblio.FormatMARC
+		}
+		report.Format, reader = format, newMARCImportReader(c.Request.Body, format)
+	default:
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":   "Unsupported import format",
+			"details": "Send text/csv, application/x-ndjson, application/marcxml+xml or application/marc",
+		})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		im := &importer{c: c, tx: tx, orgID: orgID, report: &report, seen: map[string]int{}}
+
+		batch := make([]importRow, 0, importBatchSize)
+		for {
+			row, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error":   "Failed to read import",
+					"details": err.Error(),
+				})
+				return errAborted
+			}
+
+			report.Rows++
+			if batch = append(batch, row); len(batch) == importBatchSize {
+				if err := im.importBatch(batch, report.OnConflict); err != nil {
+					return err
+				}
+				batch = batch[:0]
+			}
+		}
+		if err := im.importBatch(batch, report.OnConflict); err != nil {
+			return err
+		}
+
+		if report.DryRun || report.Failed > 0 {
+			return errImportRolledBack
+		}
+		return nil
+	})
+	if err == errAborted {
+		return
+	}
+	if err != nil && err != errImportRolledBack {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to import books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	for column := range columns.ignored {
+		report.IgnoredColumns = append(report.IgnoredColumns, column)
+	}
+	sort.Strings(report.IgnoredColumns)
+	report.Committed = err == nil
+
+	if !report.Committed && !report.DryRun {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Import has invalid rows, nothing was imported",
+			"data":  report,
+		})
+		return
+	}
+
+	if report.Committed {
+		audit.Record(c, audit.Event{
+			Action:     audit.ActionBooksImported,
+			TargetType: "organization",
+			TargetID:   orgID,
+			After: gin.H{
+				"format":  report.Format,
+				"rows":    report.Rows,
+				"created": report.Created,
+				"updated": report.Updated,
+				"skipped": report.Skipped,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": report,
+	})
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func readCSVImport(t *testing.T, data string) ([]importRow, error) {
+	t.Helper()
+	reader, err := newCSVImportReader(strings.NewReader(data), ',', &importColumns{mapping: map[string]string{}, ignored: map[string]bool{}})
+	if err != nil {
+		return nil, err
+	}
+	var rows []importRow
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestCSVImportReader(t *testing.T) {
+	long := strings.Repeat("x", maxImportLineBytes/2)
+	rows, err := readCSVImport(t, "Title,Author,Page Count,Shelf\n"+
+		"The Hobbit,J. R. R. Tolkien,310,A1\n"+
+		"\"Long, \"\"quoted\"\"\",\""+long+"\",,\n"+
+		"Bad,Someone,many,\n")
+	if err != nil {
+		t.Fatalf("reading error = %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("read %d rows, want 3", len(rows))
+	}
+	if rows[0].Line != 2 || rows[0].Fields["title"] != "The Hobbit" || rows[0].Fields["page_count"] != 310 {
+		t.Errorf("row 1 = %+v", rows[0])
+	}
+	if _, ok := rows[0].Fields["shelf"]; ok {
+		t.Errorf("row 1 has the unknown column: %+v", rows[0].Fields)
+	}
+	if rows[1].Fields["title"] != `Long, "quoted"` || rows[1].Fields["author"] != long {
+		t.Errorf("row 2 title = %q", rows[1].Fields["title"])
+	}
+	if rows[2].Err == nil {
+		t.Error("row 3 error = nil, want an invalid page_count")
+	}
+}
+
+func TestCSVImportReaderLimitsRecords(t *testing.T) {
+	tests := map[string]string{
+		"unclosed quote":  "title,author\n\"never closed," + strings.Repeat("x", 2*maxImportLineBytes),
+		"long line":       "title,author\n" + strings.Repeat("x", 2*maxImportLineBytes) + ",a\n",
+		"long header row": strings.Repeat("x", 2*maxImportLineBytes) + "\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readCSVImport(t, data); err == nil {
+				t.Error("reading error = nil, want a record too long")
+			}
+		})
+	}
+}
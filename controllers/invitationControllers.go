@@ -0,0 +1,418 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/types"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Signup modes
+const (
+	SignupOpen            = "open"
+	SignupInviteOnly      = "invite_only"
+	SignupDomainAllowlist = "domain_allowlist"
+	SignupClosed          = "closed"
+)
+
+const (
+	signupModeSetting    = "signup_mode"
+	signupDomainsSetting = "signup_allowed_domains"
+
+	defaultInvitationTTL = 7 * 24 * time.Hour
+)
+
+var validSignupModes = map[string]bool{
+	SignupOpen:            true,
+	SignupInviteOnly:      true,
+	SignupDomainAllowlist: true,
+	SignupClosed:          true,
+}
+
+// signupConfig controls who may create an account through /auth/signup
+type signupConfig struct {
+	Mode           string   `json:"mode"`
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// loadSignupConfig reads the signup settings, falling back to the
+// SIGNUP_MODE and SIGNUP_ALLOWED_DOMAINS environment variables
+func loadSignupConfig() (signupConfig, error) {
+	config := signupConfig{
+		Mode:           strings.ToLower(strings.TrimSpace(os.Getenv("SIGNUP_MODE"))),
+		AllowedDomains: splitDomains(os.Getenv("SIGNUP_ALLOWED_DOMAINS")),
+	}
+	if !validSignupModes[config.Mode] {
+		config.Mode = SignupOpen
+	}
+
+	var settings []models.Setting
+	if err := initializers.DB.Where("key IN ?", []string{signupModeSetting, signupDomainsSetting}).Find(&settings).Error; err != nil {
+		return config, err
+	}
+	for _, setting := range settings {
+		switch setting.Key {
+		case signupModeSetting:
+			if validSignupModes[setting.Value] {
+				config.Mode = setting.Value
+			}
+		case signupDomainsSetting:
+			config.AllowedDomains = splitDomains(setting.Value)
+		}
+	}
+
+	return config, nil
+}
+
+// allowsDomain reports whether the email's domain is on the allowlist
+func (sc signupConfig) allowsDomain(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range sc.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func splitDomains(value string) []string {
+	domains := []string{}
+	for _, domain := range strings.Split(value, ",") {
+		domain = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(domain), "@")))
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// findPendingInvitation looks up an unused, unexpired invitation by its plaintext token
+func findPendingInvitation(tx *gorm.DB, token string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := tx.Where("token_hash = ? AND redeemed_at IS NULL AND revoked_at IS NULL AND expires_at > ?", hashSecret(token), time.Now()).
+		First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+type InvitationController struct{}
+
+func NewInvitationController() *InvitationController {
+	return &InvitationController{}
+}
+
+// GetSignupSettings returns the active signup configuration
+func (ic *InvitationController) GetSignupSettings(c *gin.Context) {
+	config, err := loadSignupConfig()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to load signup settings",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": config,
+	})
+}
+
+// UpdateSignupSettings changes the signup mode and domain allowlist
+func (ic *InvitationController) UpdateSignupSettings(c *gin.Context) {
+	var req struct {
+		Mode           string   `json:"mode"`
+		AllowedDomains []string `json:"allowed_domains"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(req.Mode))
+	if !validSignupModes[mode] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid signup mode",
+			"details": "mode must be one of open, invite_only, domain_allowlist, closed",
+		})
+		return
+	}
+
+	before, err := loadSignupConfig()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to load signup settings",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	after := signupConfig{
+		Mode:           mode,
+		AllowedDomains: splitDomains(strings.Join(req.AllowedDomains, ",")),
+	}
+	if after.Mode == SignupDomainAllowlist && len(after.AllowedDomains) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "At least one allowed domain is required for domain_allowlist mode",
+		})
+		return
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&models.Setting{Key: signupModeSetting, Value: after.Mode}).Error; err != nil {
+			return err
+		}
+		return tx.Save(&models.Setting{Key: signupDomainsSetting, Value: strings.Join(after.AllowedDomains, ",")}).Error
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update signup settings",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionSignupSettingsChanged,
+		TargetType: "setting",
+		TargetID:   signupModeSetting,
+		Before:     before,
+		After:      after,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": after,
+	})
+}
+
+// GetAllInvitations returns a paginated list of invitations
+func (ic *InvitationController) GetAllInvitations(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 50 {
+		limit = 10
+	}
+	offset := (page - 1) * limit
+
+	query := initializers.DB.Model(&models.Invitation{})
+
+	now := time.Now()
+	switch c.Query("status") {
+	case "pending":
+		query = query.Where("redeemed_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	case "redeemed":
+		query = query.Where("redeemed_at IS NOT NULL")
+	case "revoked":
+		query = query.Where("revoked_at IS NOT NULL")
+	case "expired":
+		query = query.Where("redeemed_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	}
+	if email := strings.TrimSpace(c.Query("email")); email != "" {
+		query = query.Where("LOWER(email) LIKE ?", "%"+strings.ToLower(email)+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count invitations",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var invitations []models.Invitation
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&invitations).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch invitations",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	data := make([]gin.H, 0, len(invitations))
+	for _, invitation := range invitations {
+		data = append(data, gin.H{
+			"invitation": invitation,
+			"status":     invitation.Status(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": data,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// CreateInvitation creates an invitation and returns its token once
+func (ic *InvitationController) CreateInvitation(c *gin.Context) {
+	var req struct {
+		Email            string `json:"email"`
+		Role             string `json:"role"`
+		OrganizationID   *uint  `json:"organization_id"`
+		OrganizationRole string `json:"organization_role"`
+		ExpiresInHours   int    `json:"expires_in_hours"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if role == "" {
+		role = "user"
+	}
+	if !validRoles[role] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid role",
+		})
+		return
+	}
+
+	orgRole := strings.ToLower(strings.TrimSpace(req.OrganizationRole))
+	if req.OrganizationID != nil {
+		if orgRole == "" {
+			orgRole = models.OrgRoleMember
+		}
+		if !validOrgRoles[orgRole] {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid organization role",
+			})
+			return
+		}
+		var org models.Organization
+		if err := initializers.DB.First(&org, *req.OrganizationID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Organization not found",
+			})
+			return
+		}
+	} else {
+		orgRole = ""
+	}
+
+	ttl := defaultInvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	token, err := generateSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate the invitation token",
+		})
+		return
+	}
+
+	currentUser, _ := c.Get("user")
+	invitation := models.Invitation{
+		Email:       strings.ToLower(strings.TrimSpace(req.Email)),
+		TokenHash:   hashSecret(token),
+		Role:        role,
+		ExpiresAt:   time.Now().Add(ttl),
+		CreatedByID: currentUser.(types.User).ID,
+
+		OrganizationID:   req.OrganizationID,
+		OrganizationRole: orgRole,
+	}
+
+	if err := initializers.DB.Create(&invitation).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create invitation",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionInvitationCreated,
+		TargetType: "invitation",
+		TargetID:   invitation.ID,
+		After:      invitation,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data":  invitation,
+		"token": token,
+	})
+}
+
+// RevokeInvitation prevents a pending invitation from being redeemed
+func (ic *InvitationController) RevokeInvitation(c *gin.Context) {
+	invitationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid invitation ID format",
+			"details": "ID must be a numeric value",
+		})
+		return
+	}
+
+	var invitation models.Invitation
+	if err := initializers.DB.First(&invitation, invitationID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Invitation not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve invitation",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	if status := invitation.Status(); status != "pending" {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Invitation is already " + status,
+		})
+		return
+	}
+
+	now := time.Now()
+	if err := initializers.DB.Model(&invitation).Update("revoked_at", now).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to revoke invitation",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionInvitationRevoked,
+		TargetType: "invitation",
+		TargetID:   invitation.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation revoked successfully",
+	})
+}
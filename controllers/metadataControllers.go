@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"authSystem/credits"
+	"authSystem/isbn"
+	"authSystem/metadata"
+	"authSystem/types"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// lookupTimeout bounds a lookup asked for by a client
+	lookupTimeout = 10 * time.Second
+
+	// autofillTimeout bounds the lookup while creating a book, which
+	// shouldn't be held up long by a slow catalog
+	autofillTimeout = 3 * time.Second
+)
+
+// LookupBook returns the metadata external catalogs have for the ISBN in
+// ?isbn=, one candidate per catalog that knows the book. Catalogs that
+// failed while others answered are listed in meta.failures.
+func (bc *BookController) LookupBook(c *gin.Context) {
+	normalized, err := isbn.Normalize(c.Query("isbn"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid isbn",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), lookupTimeout)
+	defer cancel()
+	candidates, err := metadata.Lookup(ctx, normalized)
+	var partial *metadata.PartialError
+	if err != nil && !errors.As(err, &partial) {
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+			"error":   "Metadata lookup failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	meta := gin.H{"isbn": normalized, "total": len(candidates)}
+	if partial != nil {
+		meta["failures"] = partial.Failures
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": candidates,
+		"meta": meta,
+	})
+}
+
+// autofillReport tells which fields of a new book were filled in from a
+// catalog, or why none were
+type autofillReport struct {
+	Source string   `json:"source,omitempty"`
+	Fields []string `json:"fields"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// autofillBook fills the empty fields of a new book from the first
+// candidate the catalogs have for its ISBN. A failing lookup leaves the
+// book as it is and is only reported, so it never prevents the book from
+// being created; catalogs failing while others answered are reported too.
+func autofillBook(c *gin.Context, book *types.Book) autofillReport {
+	report := autofillReport{Fields: []string{}}
+	normalized, err := isbn.Normalize(book.ISBN)
+	if err != nil {
+		// validateBook rejects the ISBN
+		return report
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), autofillTimeout)
+	defer cancel()
+	candidates, err := metadata.Lookup(ctx, normalized)
+	if err != nil {
+		report.Error = err.Error()
+		var partial *metadata.PartialError
+		if !errors.As(err, &partial) {
+			return report
+		}
+	}
+	if len(candidates) == 0 {
+		return report
+	}
+
+	found := candidates[0]
+	report.Source = found.Source
+	fill := func(field string, value *string, found string) {
+		if *value == "" && found != "" {
+			*value = found
+			report.Fields = append(report.Fields, field)
+		}
+	}
+	fill("title", &book.Title, found.Title)
+	fill("subtitle", &book.Subtitle, found.Subtitle)
+	fill("author", &book.Author, credits.Join(found.Authors))
+	fill("publisher", &book.Publisher, found.Publisher)
+	fill("publication_date", &book.PublicationDate, found.PublicationDate)
+	fill("language", &book.Language, found.Language)
+	fill("description", &book.Description, found.Description)
+	if book.PageCount == 0 && found.PageCount > 0 {
+		book.PageCount = found.PageCount
+		report.Fields = append(report.Fields, "page_count")
+	}
+	return report
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"authSystem/metadata"
+	"authSystem/types"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useCatalog points the metadata lookups at an Open Library stand-in
+// served by handler
+func useCatalog(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Setenv("METADATA_PROVIDERS", "openlibrary")
+	t.Setenv("OPENLIBRARY_URL", server.URL)
+	if err := metadata.Init(); err != nil {
+		t.Fatalf("metadata.Init() error = %v", err)
+	}
+}
+
+func autofillContext(ctx context.Context) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/book?autofill=true", nil).WithContext(ctx)
+	return c
+}
+
+func TestAutofillBookFillsEmptyFields(t *testing.T) {
+	useCatalog(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ISBN:9780261103573": {
+			"title": "The Hobbit",
+			"authors": [{"name": "J. R. R. Tolkien"}],
+			"publishers": [{"name": "HarperCollins"}],
+			"number_of_pages": 310
+		}}`))
+	})
+
+	book := types.Book{ISBN: "0261103571", Title: "My Hobbit"}
+	report := autofillBook(autofillContext(context.Background()), &book)
+
+	if book.Title != "My Hobbit" || book.Author != "J. R. R. Tolkien" || book.Publisher != "HarperCollins" || book.PageCount != 310 {
+		t.Errorf("book = %+v, want the empty fields filled in", book)
+	}
+	if report.Source != "openlibrary" || report.Error != "" || len(report.Fields) != 3 {
+		t.Errorf("report = %+v, want author, publisher and page_count from openlibrary", report)
+	}
+}
+
+func TestAutofillBookLeavesBookOnFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		// timeout bounds the request creating the book
+		timeout time.Duration
+	}{
+		{
+			name: "catalog error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			},
+		},
+		{
+			name: "catalog timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			timeout: 50 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCatalog(t, tt.handler)
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			book := types.Book{ISBN: "9780261103573", Title: "The Hobbit"}
+			before := book
+			started := time.Now()
+			report := autofillBook(autofillContext(ctx), &book)
+
+			if book != before {
+				t.Errorf("book = %+v, want it untouched", book)
+			}
+			if report.Error == "" || len(report.Fields) != 0 {
+				t.Errorf("report = %+v, want the error and no fields", report)
+			}
+			if elapsed := time.Since(started); elapsed > autofillTimeout {
+				t.Errorf("autofillBook() took %s, want at most %s", elapsed, autofillTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package controllers
+
+import (
+	"authSystem/biblio"
+	"authSystem/initializers"
+	"authSystem/middleware"
+	"authSystem/models"
+	"authSystem/opds"
+	"authSystem/types"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// opdsRealm is the realm e-reader apps show when they ask for credentials
+const opdsRealm = "Book catalog"
+
+// opdsRecordFormats are the bibliographic records offered for each book, in
+// the order they are listed
+var opdsRecordFormats = []struct {
+	format string
+	title  string
+}{
+	{biblio.FormatMARCXML, "MARCXML"},
+	{biblio.FormatMARC, "MARC 21"},
+	{biblio.FormatDC, "Dublin Core"},
+	{biblio.FormatBibTeX, "BibTeX"},
+	{biblio.FormatRIS, "RIS"},
+}
+
+// OPDSAuth authenticates e-reader apps, many of which only support HTTP
+// Basic. The Basic password is an access token, with any user name, or the
+// client secret of the service account named by the user name, which is
+// exchanged for a token limited to books:read. Bearer tokens and the session
+// cookie work as on the API. Clients without credentials, or with wrong
+// ones, are challenged so that apps prompt for them.
+func OPDSAuth(c *gin.Context) {
+	if username, password, ok := c.Request.BasicAuth(); ok {
+		token, err := basicAuthToken(username, password)
+		if err != nil {
+			challengeBasicAuth(c)
+			return
+		}
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+	} else if _, err := c.Cookie("Authorization"); err != nil && !strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+		challengeBasicAuth(c)
+		return
+	}
+	middleware.RequireAuth(c)
+}
+
+// basicAuthToken maps Basic credentials to an access token
+func basicAuthToken(username, password string) (string, error) {
+	if _, err := middleware.ParseToken(password); err == nil {
+		return password, nil
+	}
+
+	var account models.ServiceAccount
+	if err := initializers.DB.Where("client_id = ?", username).First(&account).Error; err != nil {
+		return "", err
+	}
+	if account.Disabled || !checkClientSecret(account, password) {
+		return "", errors.New("invalid client credentials")
+	}
+	initializers.DB.Model(&account).Update("last_used_at", time.Now())
+
+	// Catalogs are read-only, so the token carries no more than books:read
+	scopes := []string{}
+	if account.HasScope(models.ScopeBooksRead) {
+		scopes = append(scopes, models.ScopeBooksRead)
+	}
+	return serviceToken(account, scopes)
+}
+
+func challengeBasicAuth(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="`+opdsRealm+`", charset="UTF-8"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - credentials required"})
+}
+
+// requestBaseURL is the scheme and host the request was made to, for the
+// absolute URLs Atom IDs and OpenSearch templates need
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// OPDSController serves the catalog of the active organization to e-reader
+// apps, as OPDS 1.2 under /opds or OPDS 2.0 under /opds/v2
+type OPDSController struct {
+	version int
+	base    string
+}
+
+func NewOPDSController(version int) *OPDSController {
+	base := "/opds"
+	if version == opds.Version2 {
+		base = "/opds/v2"
+	}
+	return &OPDSController{version: version, base: base}
+}
+
+// link is a link to another feed of the catalog
+func (oc *OPDSController) link(rel, path string, acquisition bool) opds.Link {
+	return opds.Link{Rel: rel, Href: oc.base + path, Type: opds.FeedType(oc.version, acquisition)}
+}
+
+// feed starts a feed with the links every feed has
+func (oc *OPDSController) feed(c *gin.Context, title string, acquisition bool) opds.Feed {
+	feed := opds.Feed{
+		ID:          requestBaseURL(c) + c.Request.URL.RequestURI(),
+		Title:       title,
+		Updated:     time.Now(),
+		Acquisition: acquisition,
+		Links: []opds.Link{
+			{Rel: opds.RelSelf, Href: c.Request.URL.RequestURI(), Type: opds.FeedType(oc.version, acquisition)},
+			oc.link(opds.RelStart, "", false),
+		},
+	}
+	if oc.version == opds.Version2 {
+		feed.Links = append(feed.Links, opds.Link{Rel: opds.RelSearch, Href: oc.base + "/books{?query}", Type: opds.JSONType, Templated: true})
+	} else {
+		feed.Links = append(feed.Links, opds.Link{Rel: opds.RelSearch, Href: oc.base + "/search.xml", Type: opds.OpenSearchType})
+	}
+	return feed
+}
+
+// write renders a feed in the controller's version
+func (oc *OPDSController) write(c *gin.Context, feed opds.Feed) {
+	var buf bytes.Buffer
+	var err error
+	if oc.version == opds.Version2 {
+		err = opds.WriteJSON(&buf, feed)
+	} else {
+		err = opds.WriteAtom(&buf, feed)
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to render feed",
+			"details": err.Error(),
+		})
+		return
+	}
+	c.Data(http.StatusOK, opds.FeedType(oc.version, feed.Acquisition), buf.Bytes())
+}
+
+// pageLinks are the links to the other pages of a paginated feed, from the
+// meta of its paginator
+func pageLinks(c *gin.Context, meta gin.H, feedType string) []opds.Link {
+	var links []opds.Link
+	add := func(rel, href string) {
+		links = append(links, opds.Link{Rel: rel, Href: href, Type: feedType})
+	}
+
+	if page, ok := meta["page"].(int); ok {
+		totalPages, _ := meta["totalPages"].(int)
+		if page > 1 {
+			add(opds.RelFirst, pageURL(c, "page", "1"))
+			add(opds.RelPrevious, pageURL(c, "page", strconv.Itoa(page-1)))
+		}
+		if page < totalPages {
+			add(opds.RelNext, pageURL(c, "page", strconv.Itoa(page+1)))
+			add(opds.RelLast, pageURL(c, "page", strconv.Itoa(totalPages)))
+		}
+		return links
+	}
+	if prev, ok := meta["prev_cursor"].(string); ok {
+		add(opds.RelPrevious, pageURL(c, "cursor", prev))
+	}
+	if next, ok := meta["next_cursor"].(string); ok {
+		add(opds.RelNext, pageURL(c, "cursor", next))
+	}
+	return links
+}
+
+// catalogTitle is the title of the catalog of an organization
+func catalogTitle(orgID uint) string {
+	var organization models.Organization
+	if err := initializers.DB.Select("name").First(&organization, orgID).Error; err != nil || organization.Name == "" {
+		return "Books"
+	}
+	return organization.Name + " books"
+}
+
+// GetRoot is the start of the catalog, leading to all books, the newest
+// books, categories and authors
+func (oc *OPDSController) GetRoot(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	feed := oc.feed(c, catalogTitle(orgID), false)
+	base := requestBaseURL(c) + oc.base
+	entry := func(id, title, summary string, link opds.Link) {
+		link.Title = title
+		feed.Navigation = append(feed.Navigation, opds.Entry{ID: base + id, Title: title, Summary: summary, Updated: feed.Updated, Link: link})
+	}
+	entry("/books", "All books", "Every book in the catalog, by title", oc.link(opds.RelSubsection, "/books", true))
+	entry("/books?sort=-created_at", "Recently added", "The books added last", oc.link(opds.RelSortNew, "/books?sort=-created_at", true))
+	entry("/categories", "Categories", "Books by category", oc.link(opds.RelSubsection, "/categories", false))
+	entry("/authors", "Authors", "Books by author", oc.link(opds.RelSubsection, "/authors", false))
+
+	oc.write(c, feed)
+}
+
+// GetSearchDescription is the OpenSearch description OPDS 1.2 apps search
+// the catalog with
+func (oc *OPDSController) GetSearchDescription(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	var buf bytes.Buffer
+	title := catalogTitle(orgID)
+	if err := opds.WriteOpenSearch(&buf, title, "Search "+title+" by title, author or category",
+		requestBaseURL(c)+oc.base+"/books?q={searchTerms}"); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to render search description",
+			"details": err.Error(),
+		})
+		return
+	}
+	c.Data(http.StatusOK, opds.OpenSearchType, buf.Bytes())
+}
+
+// GetBooks is an acquisition feed of the books the caller can see, with the
+// filters, sorting (by title by default) and pagination of GET /api/books.
+// OPDS 2.0 search templates send the search as query instead of q.
+func (oc *OPDSController) GetBooks(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	if search := c.Query("query"); search != "" && c.Query("q") == "" {
+		values := c.Request.URL.Query()
+		values.Set("q", search)
+		values.Del("query")
+		c.Request.URL.RawQuery = values.Encode()
+	}
+
+	query, _, err := filterBooks(c, visibleBooks(c, initializers.DB.Model(&types.Book{})))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search query",
+			"details": err.Error(),
+		})
+		return
+	}
+	query = filterFacets(c, query, bookFacets, "")
+
+	paging, err := newPaginator(c, bookSortKeys, "title", 20, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var books []types.Book
+	if err := paging.Apply(query).Find(&books).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch books",
+			"details": err.Error(),
+		})
+		return
+	}
+	meta := paging.Finish(c, &books, total)
+
+	bookCredits, err := creditsByBook(books)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch book authors",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	bookCovers, err := coversByBook(books)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch book covers",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	feed := oc.feed(c, oc.booksTitle(c, orgID), true)
+	feed.Links = append(feed.Links, pageLinks(c, meta, opds.FeedType(oc.version, true))...)
+	feed.TotalResults, feed.ItemsPerPage, feed.CurrentPage = int(total), paging.Limit, paging.Page
+	feed.Publications = make([]opds.Publication, 0, len(books))
+	for _, book := range books {
+		cover, hasCover := bookCovers[uint(book.ID)]
+		publication := oc.publication(c, book, bookCredits[uint(book.ID)])
+		if hasCover {
+			urls := coverURLs(fmt.Sprintf("/opds/books/%d", book.ID), cover)
+			publication.Images = []opds.Link{
+				{Rel: opds.RelImage, Href: urls["large"], Type: cover.ContentType},
+				{Rel: opds.RelThumbnail, Href: urls["small"], Type: cover.ContentType},
+			}
+		}
+		feed.Publications = append(feed.Publications, publication)
+	}
+
+	oc.write(c, feed)
+}
+
+// booksTitle names a books feed after its category, author or search
+func (oc *OPDSController) booksTitle(c *gin.Context, orgID uint) string {
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		return fmt.Sprintf("Search results for %q", q)
+	}
+	if id, err := strconv.Atoi(c.Query("category_id")); err == nil {
+		var category models.Category
+		if initializers.DB.Where("organization_id = ?", orgID).First(&category, id).Error == nil {
+			return category.Name
+		}
+	}
+	if id, err := strconv.Atoi(c.Query("author_id")); err == nil {
+		var author models.Author
+		if initializers.DB.Where("organization_id = ?", orgID).First(&author, id).Error == nil {
+			return "Books by " + author.Name
+		}
+	}
+	if c.Query("sort") == "-created_at" {
+		return "Recently added"
+	}
+	return "All books"
+}
+
+// publication describes a book in an acquisition feed. The books have no
+// files, so what can be acquired are their bibliographic records.
+func (oc *OPDSController) publication(c *gin.Context, book types.Book, credits []models.BookAuthor) opds.Publication {
+	record := bookRecord(book, credits)
+	publication := opds.Publication{
+		ID:          fmt.Sprintf("%s/opds/books/%d", requestBaseURL(c), book.ID),
+		Title:       book.Title,
+		Subtitle:    book.Subtitle,
+		Authors:     record.Names(biblio.RoleAuthor),
+		Publisher:   book.Publisher,
+		Published:   book.PublicationDate,
+		Language:    book.Language,
+		ISBN:        book.ISBN,
+		Description: book.Description,
+		PageCount:   book.PageCount,
+		Updated:     book.UpdatedAt,
+	}
+	if book.Category != "" {
+		publication.Subjects = append(publication.Subjects, opds.Subject{Name: book.Category})
+	}
+	for _, record := range opdsRecordFormats {
+		publication.Links = append(publication.Links, opds.Link{
+			Rel:   opds.RelAcquisition,
+			Href:  fmt.Sprintf("/opds/books/%d/export/%s", book.ID, record.format),
+			Type:  biblio.MediaTypes[record.format],
+			Title: record.title,
+		})
+	}
+	return publication
+}
+
+// GetCategories is a navigation feed of the categories below parent (an
+// ID), or of the top categories. Categories without books are left out;
+// a category leads to its subcategories if it has any, else to its books.
+func (oc *OPDSController) GetCategories(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	roots, err := categoryTree(orgID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch categories",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	nodes, title := roots, "Categories"
+	var parent *categoryNode
+	if param := c.Query("parent"); param != "" {
+		parentID, _ := strconv.Atoi(param)
+		if parent = findCategoryNode(roots, uint(parentID)); parent == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Category not found",
+			})
+			return
+		}
+		nodes, title = parent.Children, parent.Name
+	}
+
+	feed := oc.feed(c, title, false)
+	base := requestBaseURL(c) + oc.base
+	entry := func(path, title string, count int64, link opds.Link) {
+		link.Title, link.Count = title, int(count)
+		feed.Navigation = append(feed.Navigation, opds.Entry{
+			ID:      base + path,
+			Title:   title,
+			Summary: fmt.Sprintf("%d books", count),
+			Updated: feed.Updated,
+			Link:    link,
+		})
+	}
+
+	if parent != nil {
+		up := "/categories"
+		if parent.ParentID != nil {
+			up += fmt.Sprintf("?parent=%d", *parent.ParentID)
+		}
+		feed.Links = append(feed.Links, oc.link(opds.RelUp, up, false))
+
+		path := fmt.Sprintf("/books?category_id=%d", parent.ID)
+		entry(path, "All books in "+parent.Name, parent.TotalCount, oc.link(opds.RelSubsection, path, true))
+	}
+	for _, node := range nodes {
+		if node.TotalCount == 0 {
+			continue
+		}
+		if len(node.Children) > 0 {
+			path := fmt.Sprintf("/categories?parent=%d", node.ID)
+			entry(path, node.Name, node.TotalCount, oc.link(opds.RelSubsection, path, false))
+		} else {
+			path := fmt.Sprintf("/books?category_id=%d", node.ID)
+			entry(path, node.Name, node.TotalCount, oc.link(opds.RelSubsection, path, true))
+		}
+	}
+
+	oc.write(c, feed)
+}
+
+func findCategoryNode(nodes []*categoryNode, id uint) *categoryNode {
+	for _, node := range nodes {
+		if node.ID == id {
+			return node
+		}
+		if found := findCategoryNode(node.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// GetAuthors is a paginated navigation feed of the authors credited on
+// books of the organization, by sort name, each leading to their books
+func (oc *OPDSController) GetAuthors(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	paging, err := newPaginator(c, authorSortKeys, "sort_name", 20, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
+	}
+
+	query := initializers.DB.Model(&models.Author{}).
+		Where("organization_id = ?", orgID).
+		Where("EXISTS (SELECT 1 FROM book_authors JOIN books ON books.id = book_authors.book_id " +
+			"WHERE book_authors.author_id = authors.id AND books.deleted_at IS NULL)")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count authors",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var authors []models.Author
+	if err := paging.Apply(query).Find(&authors).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch authors",
+			"details": err.Error(),
+		})
+		return
+	}
+	meta := paging.Finish(c, &authors, total)
+
+	feed := oc.feed(c, "Authors", false)
+	feed.Links = append(feed.Links, pageLinks(c, meta, opds.FeedType(oc.version, false))...)
+	feed.TotalResults, feed.ItemsPerPage, feed.CurrentPage = int(total), paging.Limit, paging.Page
+	base := requestBaseURL(c) + oc.base
+	for _, author := range authors {
+		path := fmt.Sprintf("/books?author_id=%d", author.ID)
+		link := oc.link(opds.RelSubsection, path, true)
+		link.Title = author.Name
+		feed.Navigation = append(feed.Navigation, opds.Entry{
+			ID:      base + path,
+			Title:   author.Name,
+			Summary: author.SortName,
+			Updated: author.UpdatedAt,
+			Link:    link,
+		})
+	}
+
+	oc.write(c, feed)
+}
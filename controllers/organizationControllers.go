@@ -0,0 +1,581 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// validOrgRoles lists the roles a member can hold within an organization
+var validOrgRoles = map[string]bool{
+	models.OrgRoleOwner:  true,
+	models.OrgRoleAdmin:  true,
+	models.OrgRoleEditor: true,
+	models.OrgRoleMember: true,
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns a display name into a lowercase, URL-safe identifier
+func slugify(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// uniqueSlug returns a slug for name that isn't used by any row of model yet
+func uniqueSlug(tx *gorm.DB, model interface{}, name string) (string, error) {
+	base := slugify(name)
+	if base == "" {
+		base = "item"
+	}
+	slug := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Model(model).Unscoped().Where("slug = ?", slug).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// activeMembership returns the caller's membership in their active organization
+func activeMembership(c *gin.Context) (models.Membership, bool) {
+	value, ok := c.Get("membership")
+	if !ok {
+		return models.Membership{}, false
+	}
+	return value.(models.Membership), true
+}
+
+// activeOrganizationID returns the organization every book query is scoped to
+func activeOrganizationID(c *gin.Context) (uint, bool) {
+	value, ok := c.Get("organizationID")
+	if !ok {
+		return 0, false
+	}
+	return value.(uint), true
+}
+
+// abortNoOrganization rejects requests from callers without an active organization
+func abortNoOrganization(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error": "No active organization",
+	})
+}
+
+// defaultOrganizationID returns the organization a new session starts in
+func defaultOrganizationID(userID uint) (uint, bool) {
+	var membership models.Membership
+	if err := initializers.DB.Where("user_id = ?", userID).Order("id").First(&membership).Error; err != nil {
+		return 0, false
+	}
+	return membership.OrganizationID, true
+}
+
+// createPersonalOrganization gives a new user their own organization as owner
+func createPersonalOrganization(tx *gorm.DB, user models.User) error {
+	slug, err := uniqueSlug(tx, &models.Organization{}, strings.Split(user.Email, "@")[0])
+	if err != nil {
+		return err
+	}
+	org := models.Organization{Name: user.Email, Slug: slug}
+	if err := tx.Create(&org).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.Membership{
+		UserID:         user.ID,
+		OrganizationID: org.ID,
+		Role:           models.OrgRoleOwner,
+	}).Error
+}
+
+type OrganizationController struct{}
+
+func NewOrganizationController() *OrganizationController {
+	return &OrganizationController{}
+}
+
+// parseOrgMembership checks that the caller belongs to the organization in
+// the URL and, when roles are given, holds one of them
+func parseOrgMembership(c *gin.Context, roles ...string) (models.Membership, bool) {
+	orgID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid organization ID format",
+			"details": "ID must be a numeric value",
+		})
+		return models.Membership{}, false
+	}
+
+	currentUser, _ := c.Get("user")
+	var membership models.Membership
+	if err := initializers.DB.Where("user_id = ? AND organization_id = ?", currentUser.(types.User).ID, orgID).
+		First(&membership).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Organization not found",
+		})
+		return models.Membership{}, false
+	}
+
+	if len(roles) > 0 {
+		allowed := false
+		for _, role := range roles {
+			allowed = allowed || membership.Role == role
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Insufficient organization role",
+			})
+			return models.Membership{}, false
+		}
+	}
+
+	return membership, true
+}
+
+// GetMyOrganizations lists the organizations the caller belongs to
+func (oc *OrganizationController) GetMyOrganizations(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+
+	var memberships []models.Membership
+	if err := initializers.DB.Preload("Organization").
+		Where("user_id = ?", currentUser.(types.User).ID).
+		Order("id").Find(&memberships).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch organizations",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	activeID, _ := activeOrganizationID(c)
+	data := make([]gin.H, 0, len(memberships))
+	for _, membership := range memberships {
+		data = append(data, gin.H{
+			"organization": membership.Organization,
+			"role":         membership.Role,
+			"active":       membership.OrganizationID == activeID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": data,
+	})
+}
+
+// CreateOrganization creates an organization owned by the caller
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Name is required",
+		})
+		return
+	}
+
+	currentUser, _ := c.Get("user")
+	var org models.Organization
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		slug, err := uniqueSlug(tx, &models.Organization{}, name)
+		if err != nil {
+			return err
+		}
+		org = models.Organization{Name: name, Slug: slug}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{
+			UserID:         currentUser.(types.User).ID,
+			OrganizationID: org.ID,
+			Role:           models.OrgRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create organization",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionOrganizationCreated,
+		TargetType: "organization",
+		TargetID:   org.ID,
+		After:      org,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": org,
+	})
+}
+
+// GetMembers lists the members of an organization the caller belongs to
+func (oc *OrganizationController) GetMembers(c *gin.Context) {
+	membership, ok := parseOrgMembership(c)
+	if !ok {
+		return
+	}
+
+	var members []struct {
+		UserID uint   `json:"user_id"`
+		Email  string `json:"email"`
+		Role   string `json:"role"`
+	}
+	if err := initializers.DB.Table("memberships").
+		Select("memberships.user_id, users.email, memberships.role").
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ? AND memberships.deleted_at IS NULL", membership.OrganizationID).
+		Order("users.email").Scan(&members).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch members",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": members,
+	})
+}
+
+// AddMember adds an existing user to the organization
+func (oc *OrganizationController) AddMember(c *gin.Context) {
+	membership, ok := parseOrgMembership(c, models.OrgRoleOwner, models.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+	if !validOrgRoles[role] || (role == models.OrgRoleOwner && membership.Role != models.OrgRoleOwner) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid role",
+		})
+		return
+	}
+
+	var user types.User
+	if err := initializers.DB.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(req.Email))).First(&user).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var count int64
+	if err := initializers.DB.Model(&models.Membership{}).Where("user_id = ? AND organization_id = ?", user.ID, membership.OrganizationID).Count(&count).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to check membership",
+			"details": err.Error(),
+		})
+		return
+	}
+	if count > 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "User is already a member of this organization",
+		})
+		return
+	}
+
+	newMembership := models.Membership{
+		UserID:         user.ID,
+		OrganizationID: membership.OrganizationID,
+		Role:           role,
+	}
+	if err := initializers.DB.Create(&newMembership).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to add member",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionMemberAdded,
+		TargetType: "organization",
+		TargetID:   membership.OrganizationID,
+		After:      gin.H{"user_id": user.ID, "role": role},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": newMembership,
+	})
+}
+
+// loadTargetMembership loads the membership named by the :userId URL parameter
+func loadTargetMembership(c *gin.Context, orgID uint) (models.Membership, bool) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID format",
+			"details": "ID must be a numeric value",
+		})
+		return models.Membership{}, false
+	}
+
+	var target models.Membership
+	if err := initializers.DB.Where("user_id = ? AND organization_id = ?", userID, orgID).First(&target).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Member not found",
+		})
+		return models.Membership{}, false
+	}
+	return target, true
+}
+
+// errLastOwner rejects a change that would leave an organization without
+// an owner
+var errLastOwner = errors.New("an organization needs at least one owner")
+
+// checkOwnersRemain fails with errLastOwner when target is the only owner
+// of its organization. It locks every membership of the organization until
+// tx ends, so concurrent changes of owners are serialized and two owners
+// can't demote or remove each other at the same time.
+func checkOwnersRemain(tx *gorm.DB, target models.Membership) error {
+	var members []models.Membership
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("organization_id = ?", target.OrganizationID).
+		Find(&members).Error; err != nil {
+		return err
+	}
+	owners, targetIsOwner := 0, false
+	for _, member := range members {
+		if member.Role == models.OrgRoleOwner {
+			owners++
+			targetIsOwner = targetIsOwner || member.ID == target.ID
+		}
+	}
+	if targetIsOwner && owners <= 1 {
+		return errLastOwner
+	}
+	return nil
+}
+
+// abortMemberChange reports the failure of a change to a membership
+func abortMemberChange(c *gin.Context, message string, err error) {
+	if errors.Is(err, errLastOwner) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "An organization needs at least one owner",
+		})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+		"error":   message,
+		"details": err.Error(),
+	})
+}
+
+// UpdateMember changes a member's role within the organization
+func (oc *OrganizationController) UpdateMember(c *gin.Context) {
+	membership, ok := parseOrgMembership(c, models.OrgRoleOwner, models.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	target, ok := loadTargetMembership(c, membership.OrganizationID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role       string    `json:"role"`
+		Categories *[]string `json:"categories"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if role == "" {
+		role = target.Role
+	}
+	if !validOrgRoles[role] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid role",
+		})
+		return
+	}
+
+	// Only owners may grant or take away ownership
+	if (role == models.OrgRoleOwner || target.Role == models.OrgRoleOwner) && membership.Role != models.OrgRoleOwner {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Only owners can change ownership",
+		})
+		return
+	}
+
+	previous := gin.H{"user_id": target.UserID, "role": target.Role, "categories": target.Categories}
+	categories := target.Categories
+	if req.Categories != nil {
+		categories = strings.Join(*req.Categories, ",")
+	}
+	updates := map[string]interface{}{"role": role, "categories": categories}
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if role != models.OrgRoleOwner {
+			if err := checkOwnersRemain(tx, target); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&target).Updates(updates).Error
+	})
+	if err != nil {
+		abortMemberChange(c, "Failed to update member", err)
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionMemberUpdated,
+		TargetType: "organization",
+		TargetID:   membership.OrganizationID,
+		Before:     previous,
+		After:      gin.H{"user_id": target.UserID, "role": role, "categories": categories},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": target,
+	})
+}
+
+// RemoveMember removes a user from the organization
+func (oc *OrganizationController) RemoveMember(c *gin.Context) {
+	membership, ok := parseOrgMembership(c, models.OrgRoleOwner, models.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	target, ok := loadTargetMembership(c, membership.OrganizationID)
+	if !ok {
+		return
+	}
+
+	if target.Role == models.OrgRoleOwner && membership.Role != models.OrgRoleOwner {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Only owners can remove owners",
+		})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkOwnersRemain(tx, target); err != nil {
+			return err
+		}
+		// Hard delete so the user can be added back later
+		return tx.Unscoped().Delete(&target).Error
+	})
+	if err != nil {
+		abortMemberChange(c, "Failed to remove member", err)
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionMemberRemoved,
+		TargetType: "organization",
+		TargetID:   membership.OrganizationID,
+		Before:     gin.H{"user_id": target.UserID, "role": target.Role},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member removed successfully",
+	})
+}
+
+// SwitchOrganization reissues the caller's token with another active organization
+func SwitchOrganization(c *gin.Context) {
+	var req struct {
+		OrganizationID uint `json:"organization_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	currentUser, _ := c.Get("user")
+	var membership models.Membership
+	if err := initializers.DB.Preload("Organization").
+		Where("user_id = ? AND organization_id = ?", currentUser.(types.User).ID, req.OrganizationID).
+		First(&membership).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "You are not a member of this organization",
+		})
+		return
+	}
+
+	// Keep every other claim (expiry, impersonation) of the current token
+	value, _ := c.Get("claims")
+	claims := jwt.MapClaims{}
+	for key, claim := range value.(jwt.MapClaims) {
+		claims[key] = claim
+	}
+	claims["org"] = membership.OrganizationID
+
+	tokenString, err := generateToken(claims)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate the token",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionOrganizationSwitched,
+		TargetType: "organization",
+		TargetID:   membership.OrganizationID,
+	})
+
+	maxAge := 3600 * 24
+	if exp, ok := claims["exp"].(float64); ok {
+		maxAge = int(exp) - int(jwt.TimeFunc().Unix())
+	}
+	c.SetCookie("Authorization", tokenString, maxAge, "", "", false, true)
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Active organization switched",
+		"organization": membership.Organization,
+		"role":         membership.Role,
+		"token":        tokenString,
+	})
+}
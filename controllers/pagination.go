@@ -0,0 +1,340 @@
+package controllers
+
+import (
+	"authSystem/initializers"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// sortKey is a field a listing may be sorted by
+type sortKey struct {
+	// Expr is the SQL expression to order and seek by; it must never be NULL
+	Expr string
+	Vars []interface{}
+	// Column names the field of the result rows holding the value, used
+	// to build cursors
+	Column string
+}
+
+// sortKeys whitelists the sort parameter values of a listing
+type sortKeys map[string]sortKey
+
+var bookSortKeys = sortKeys{
+	"id":               {Expr: "books.id", Column: "id"},
+	"title":            {Expr: "books.title", Column: "title"},
+	"author":           {Expr: "COALESCE(books.author, '')", Column: "author"},
+	"category":         {Expr: "COALESCE(books.category, '')", Column: "category"},
+	"created_at":       {Expr: "books.created_at", Column: "created_at"},
+	"updated_at":       {Expr: "books.updated_at", Column: "updated_at"},
+	"publication_date": {Expr: "books.publication_date", Column: "publication_date"},
+	"page_count":       {Expr: "books.page_count", Column: "page_count"},
+}
+
+var userSortKeys = sortKeys{
+	"id":         {Expr: "users.id", Column: "id"},
+	"email":      {Expr: "users.email", Column: "email"},
+	"role":       {Expr: "COALESCE(users.role, '')", Column: "role"},
+	"created_at": {Expr: "users.created_at", Column: "created_at"},
+}
+
+// with returns a copy of the keys with one more key
+func (keys sortKeys) with(name string, key sortKey) sortKeys {
+	extended := sortKeys{name: key}
+	for existing, value := range keys {
+		extended[existing] = value
+	}
+	return extended
+}
+
+type sortField struct {
+	Name string
+	Desc bool
+	sortKey
+}
+
+// cursor is the decoded form of the opaque cursor parameter: the sort key
+// values of the row to continue from
+type cursor struct {
+	Sort     string   `json:"s"`
+	Values   []string `json:"v"`
+	Backward bool     `json:"b,omitempty"`
+}
+
+// paginator pages a listing either with opaque keyset cursors (cursor=) or,
+// for backwards compatibility, with page numbers (page=, the default). Both
+// modes share the sort=title,-created_at parameter, where "-" sorts
+// descending and id is always added as a tie-breaker. Every page carries the
+// cursors of its neighbours, so clients can switch to cursors at any point.
+type paginator struct {
+	Limit  int
+	Page   int // 0 in cursor mode
+	Sort   []sortField
+	cursor *cursor
+}
+
+// newPaginator reads limit, page, cursor and sort from the request.
+// defaultSort is used when the sort parameter is absent.
+func newPaginator(c *gin.Context, keys sortKeys, defaultSort string, defaultLimit, maxLimit int) (*paginator, error) {
+	p := &paginator{Limit: defaultLimit}
+
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit >= 1 && limit <= maxLimit {
+		p.Limit = limit
+	}
+
+	sortParam := strings.TrimSpace(c.Query("sort"))
+	if sortParam == "" {
+		sortParam = defaultSort
+	}
+	hasID := false
+	for _, name := range strings.Split(sortParam, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		key, ok := keys[name]
+		if !ok {
+			return nil, fmt.Errorf("cannot sort by %q", name)
+		}
+		p.Sort = append(p.Sort, sortField{Name: name, Desc: desc, sortKey: key})
+		hasID = hasID || name == "id"
+	}
+	if !hasID {
+		p.Sort = append(p.Sort, sortField{Name: "id", sortKey: keys["id"]})
+	}
+
+	if encoded := c.Query("cursor"); encoded != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		var cur cursor
+		if err := json.Unmarshal(raw, &cur); err != nil || len(cur.Values) != len(p.Sort) {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		if cur.Sort != p.sortString() {
+			return nil, fmt.Errorf("cursor does not match sort %q", p.sortString())
+		}
+		p.cursor = &cur
+	} else {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		p.Page = page
+	}
+
+	return p, nil
+}
+
+// sortString is the normalized sort parameter, e.g. "title,-created_at,id"
+func (p *paginator) sortString() string {
+	names := make([]string, len(p.Sort))
+	for i, field := range p.Sort {
+		names[i] = field.Name
+		if field.Desc {
+			names[i] = "-" + field.Name
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// backward reports whether the rows are being fetched towards the start
+func (p *paginator) backward() bool {
+	return p.cursor != nil && p.cursor.Backward
+}
+
+// Apply adds the ordering, the keyset condition and the limit to query. One
+// extra row is fetched to find out whether there is a next page.
+func (p *paginator) Apply(query *gorm.DB) *gorm.DB {
+	var order []string
+	var orderVars []interface{}
+	for _, field := range p.Sort {
+		direction := " ASC"
+		if field.Desc != p.backward() {
+			direction = " DESC"
+		}
+		order = append(order, field.Expr+direction)
+		orderVars = append(orderVars, field.Vars...)
+	}
+	query = query.Clauses(clause.OrderBy{Expression: clause.Expr{SQL: strings.Join(order, ", "), Vars: orderVars}})
+
+	if p.cursor != nil {
+		// (a > x) OR (a = x AND b > y) OR ..., with < for descending fields
+		var alternatives []string
+		var vars []interface{}
+		for i, field := range p.Sort {
+			var parts []string
+			for j, previous := range p.Sort[:i] {
+				parts = append(parts, previous.Expr+" = ?")
+				vars = append(vars, previous.Vars...)
+				vars = append(vars, p.cursor.Values[j])
+			}
+			operator := " > ?"
+			if field.Desc != p.backward() {
+				operator = " < ?"
+			}
+			parts = append(parts, field.Expr+operator)
+			vars = append(vars, field.Vars...)
+			vars = append(vars, p.cursor.Values[i])
+			alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+		}
+		query = query.Where(strings.Join(alternatives, " OR "), vars...)
+	}
+
+	if p.Page > 0 {
+		query = query.Offset((p.Page - 1) * p.Limit)
+	}
+	return query.Limit(p.Limit + 1)
+}
+
+// Finish trims the extra row from rows (a pointer to the fetched slice),
+// restores the order of a backward page, sets the Link header and returns
+// the response meta
+func (p *paginator) Finish(c *gin.Context, rows interface{}, total int64) gin.H {
+	slice := reflect.ValueOf(rows).Elem()
+	hasMore := slice.Len() > p.Limit
+	if hasMore {
+		slice.Set(slice.Slice(0, p.Limit))
+	}
+	if p.backward() {
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			first, last := slice.Index(i).Interface(), slice.Index(j).Interface()
+			slice.Index(i).Set(reflect.ValueOf(last))
+			slice.Index(j).Set(reflect.ValueOf(first))
+		}
+	}
+
+	meta := gin.H{
+		"limit": p.Limit,
+		"total": total,
+		"sort":  p.sortString(),
+	}
+
+	// Going forward there are earlier rows once a cursor was followed, and
+	// going backward the cursor row itself comes next
+	hasNext, hasPrev := hasMore, p.cursor != nil || p.Page > 1
+	if p.backward() {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	links := map[string]string{}
+	if p.Page > 0 {
+		meta["page"] = p.Page
+		meta["totalPages"] = (int(total) + p.Limit - 1) / p.Limit
+		if hasNext {
+			links["next"] = pageURL(c, "page", strconv.Itoa(p.Page+1))
+		}
+		if hasPrev {
+			links["prev"] = pageURL(c, "page", strconv.Itoa(p.Page-1))
+		}
+	}
+
+	if slice.Len() > 0 {
+		if hasNext {
+			if next, err := p.encodeCursor(slice.Index(slice.Len()-1), false); err == nil {
+				meta["next_cursor"] = next
+				if p.Page == 0 {
+					links["next"] = pageURL(c, "cursor", next)
+				}
+			}
+		}
+		if hasPrev {
+			if prev, err := p.encodeCursor(slice.Index(0), true); err == nil {
+				meta["prev_cursor"] = prev
+				if p.Page == 0 {
+					links["prev"] = pageURL(c, "cursor", prev)
+				}
+			}
+		}
+	}
+
+	var header []string
+	for _, rel := range []string{"next", "prev"} {
+		if link, ok := links[rel]; ok {
+			header = append(header, fmt.Sprintf(`<%s>; rel="%s"`, link, rel))
+		}
+	}
+	if len(header) > 0 {
+		c.Header("Link", strings.Join(header, ", "))
+	}
+
+	return meta
+}
+
+var cursorSchemas sync.Map
+
+// encodeCursor builds the cursor pointing at row
+func (p *paginator) encodeCursor(row reflect.Value, backward bool) (string, error) {
+	rowSchema, err := schema.Parse(row.Addr().Interface(), &cursorSchemas, initializers.DB.NamingStrategy)
+	if err != nil {
+		return "", err
+	}
+
+	cur := cursor{Sort: p.sortString(), Backward: backward}
+	for _, field := range p.Sort {
+		schemaField := rowSchema.LookUpField(field.Column)
+		if schemaField == nil {
+			return "", fmt.Errorf("no field %s for cursor", field.Column)
+		}
+		value, _ := schemaField.ValueOf(context.Background(), row)
+		cur.Values = append(cur.Values, cursorValue(value))
+	}
+
+	raw, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// cursorValue formats a sort key value the way PostgreSQL parses it back
+func cursorValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case *time.Time:
+		if v != nil {
+			return v.Format(time.RFC3339Nano)
+		}
+		return ""
+	case gorm.DeletedAt:
+		if v.Valid {
+			return v.Time.Format(time.RFC3339Nano)
+		}
+		return ""
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// pageURL is the current request URL with one pagination parameter replaced
+func pageURL(c *gin.Context, param, value string) string {
+	query := c.Request.URL.Query()
+	query.Del("page")
+	query.Del("cursor")
+	query.Set(param, value)
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+// abortInvalidPagination rejects an unknown sort field or a malformed cursor
+func abortInvalidPagination(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"error":   "Invalid pagination parameters",
+		"details": err.Error(),
+	})
+}
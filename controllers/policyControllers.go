@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"authSystem/initializers"
+	"authSystem/middleware"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/types"
+	"net/http"
+	"strings"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// subjectAttributes describes the caller for policy evaluation
+func subjectAttributes(c *gin.Context) policy.Attributes {
+	attrs := policy.Attributes{}
+
+	if value, ok := c.Get("principal"); ok {
+		principal := value.(types.Principal)
+		attrs["type"] = principal.Type
+		attrs["id"] = principal.ID
+	}
+	if value, ok := c.Get("user"); ok {
+		attrs["role"] = value.(types.User).Role
+	}
+	if orgID, ok := activeOrganizationID(c); ok {
+		attrs["org_id"] = orgID
+	}
+	if membership, ok := activeMembership(c); ok {
+		addMembershipAttributes(attrs, membership)
+	}
+	if scopes, ok := c.Get("scopes"); ok {
+		attrs["scopes"] = scopes
+	}
+
+	return attrs
+}
+
+// addMembershipAttributes adds the organization role and editor categories
+func addMembershipAttributes(attrs policy.Attributes, membership models.Membership) {
+	attrs["org_id"] = membership.OrganizationID
+	attrs["org_role"] = membership.Role
+	if categories := membership.CategoryList(); len(categories) > 0 {
+		attrs["categories"] = categories
+	}
+}
+
+// bookAttributes describes a book for policy evaluation, including its
+// creator and the users it is shared with
+func bookAttributes(book types.Book) policy.Attributes {
+	attrs := policy.Attributes{
+		"type":     "book",
+		"id":       book.ID,
+		"org_id":   book.OrganizationID,
+		"title":    book.Title,
+		"author":   book.Author,
+		"category": strings.TrimSpace(book.Category),
+	}
+	if book.CreatedByID != nil {
+		attrs["created_by_id"] = *book.CreatedByID
+	}
+
+	if book.ID != 0 {
+		var collaborators []models.BookCollaborator
+		initializers.DB.Where("book_id = ?", book.ID).Find(&collaborators)
+
+		collaboratorIDs, editorIDs := []uint{}, []uint{}
+		for _, collaborator := range collaborators {
+			collaboratorIDs = append(collaboratorIDs, collaborator.UserID)
+			if collaborator.Role == models.CollaboratorEditor {
+				editorIDs = append(editorIDs, collaborator.UserID)
+			}
+		}
+		attrs["collaborator_ids"] = collaboratorIDs
+		attrs["editor_ids"] = editorIDs
+	}
+
+	return attrs
+}
+
+// authorizeBook evaluates the policies for an action on a book, logs the
+// decision and aborts with 403 when it is denied
+func authorizeBook(c *gin.Context, action string, book types.Book) bool {
+	return authorize(c, action, bookAttributes(book))
+}
+
+// authorAttributes describes an author for policy evaluation
+func authorAttributes(author models.Author) policy.Attributes {
+	return policy.Attributes{
+		"type":   "author",
+		"id":     author.ID,
+		"org_id": author.OrganizationID,
+		"name":   author.Name,
+	}
+}
+
+// categoryAttributes describes a category for policy evaluation
+func categoryAttributes(category models.Category) policy.Attributes {
+	return policy.Attributes{
+		"type":   "category",
+		"id":     category.ID,
+		"org_id": category.OrganizationID,
+		"name":   category.Name,
+		"slug":   category.Slug,
+	}
+}
+
+// authorize evaluates the policies for an action on a resource, logs the
+// decision and aborts with 403 when it is denied
+func authorize(c *gin.Context, action string, resource policy.Attributes) bool {
+	decision := decide(c, action, resource)
+	if !decision.Allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"details": decision.Reason,
+		})
+		return false
+	}
+	return true
+}
+
+// decide evaluates the policies for an action on a resource and logs the
+// decision, for callers that report denials themselves
+func decide(c *gin.Context, action string, resource policy.Attributes) policy.Decision {
+	req := policy.Request{
+		Subject:  subjectAttributes(c),
+		Action:   action,
+		Resource: resource,
+	}
+	decision := policy.Evaluate(req)
+
+	middleware.GetLogger().Info("Policy decision",
+		zap.String("action", action),
+		zap.Any("subject_type", req.Subject["type"]),
+		zap.Any("subject_id", req.Subject["id"]),
+		zap.Any("resource_type", resource["type"]),
+		zap.Any("resource_id", resource["id"]),
+		zap.Bool("allowed", decision.Allowed),
+		zap.String("policy", decision.PolicyID),
+		zap.String("reason", decision.Reason),
+		zap.String("request_id", requestid.Get(c)),
+	)
+	return decision
+}
+
+type PolicyController struct{}
+
+func NewPolicyController() *PolicyController {
+	return &PolicyController{}
+}
+
+// GetPolicies returns the loaded policies
+func (pc *PolicyController) GetPolicies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": policy.Policies(),
+	})
+}
+
+// TestPolicy evaluates a request without performing it. The subject and
+// resource can be given as attributes, or loaded from user_id and book_id
+// with explicit attributes taking precedence. Passing "policies" evaluates a
+// draft policy set instead of the loaded one.
+func (pc *PolicyController) TestPolicy(c *gin.Context) {
+	var req struct {
+		Action   string            `json:"action"`
+		UserID   *uint             `json:"user_id"`
+		BookID   *uint             `json:"book_id"`
+		Subject  policy.Attributes `json:"subject"`
+		Resource policy.Attributes `json:"resource"`
+		Policies []policy.Policy   `json:"policies"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if req.Action == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Action is required",
+		})
+		return
+	}
+
+	resource := policy.Attributes{}
+	if req.BookID != nil {
+		var book types.Book
+		if err := initializers.DB.First(&book, *req.BookID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Book not found",
+			})
+			return
+		}
+		resource = bookAttributes(book)
+	}
+	for key, value := range req.Resource {
+		resource[key] = value
+	}
+
+	subject := policy.Attributes{}
+	if req.UserID != nil {
+		var user types.User
+		if err := initializers.DB.First(&user, *req.UserID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+		subject["type"] = types.PrincipalUser
+		subject["id"] = user.ID
+		subject["role"] = user.Role
+
+		// Use the membership in the resource's organization, or the first one
+		membershipQuery := initializers.DB.Where("user_id = ?", user.ID)
+		if orgID, ok := resource["org_id"]; ok {
+			membershipQuery = membershipQuery.Where("organization_id = ?", orgID)
+		}
+		var membership models.Membership
+		if err := membershipQuery.Order("id").First(&membership).Error; err == nil {
+			addMembershipAttributes(subject, membership)
+		}
+	}
+	for key, value := range req.Subject {
+		subject[key] = value
+	}
+
+	request := policy.Request{Subject: subject, Action: req.Action, Resource: resource}
+
+	var decision policy.Decision
+	if req.Policies != nil {
+		draft, err := policy.New(req.Policies)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid policies",
+				"details": err.Error(),
+			})
+			return
+		}
+		decision = draft.Evaluate(request)
+	} else {
+		decision = policy.Evaluate(request)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"request":  request,
+		"decision": decision,
+	})
+}
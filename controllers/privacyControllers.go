@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultDeletionGraceDays = 30
+
+// deletionGracePeriod is how long a deletion request can be canceled before
+// the account is anonymized, configured with ACCOUNT_DELETION_GRACE_DAYS
+func deletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = defaultDeletionGraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+type PrivacyController struct{}
+
+func NewPrivacyController() *PrivacyController {
+	return &PrivacyController{}
+}
+
+// buildUserExport collects every piece of personal data held about a user
+func buildUserExport(userID uint) (gin.H, error) {
+	var user types.User
+	if err := initializers.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var memberships []models.Membership
+	if err := initializers.DB.Preload("Organization").Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+
+	// Tokens are stateless, so the login history is the record of sessions
+	var sessions []models.AuditEvent
+	if err := initializers.DB.Where("actor_id = ? AND action = ?", userID, audit.ActionLogin).
+		Order("created_at").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	var books []types.Book
+	if err := initializers.DB.Unscoped().Where("created_by_id = ?", userID).Find(&books).Error; err != nil {
+		return nil, err
+	}
+
+	var collaborations []models.BookCollaborator
+	if err := initializers.DB.Where("user_id = ?", userID).Find(&collaborations).Error; err != nil {
+		return nil, err
+	}
+
+	var auditEvents []models.AuditEvent
+	if err := initializers.DB.Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userID, "user", fmt.Sprint(userID)).
+		Order("created_at").Find(&auditEvents).Error; err != nil {
+		return nil, err
+	}
+
+	sessionData := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		sessionData = append(sessionData, gin.H{
+			"logged_in_at": session.CreatedAt,
+			"ip":           session.IP,
+		})
+	}
+
+	return gin.H{
+		"exported_at": time.Now().UTC(),
+		"profile": gin.H{
+			"id":                    user.ID,
+			"email":                 user.Email,
+			"role":                  user.Role,
+			"created_at":            user.CreatedAt,
+			"updated_at":            user.UpdatedAt,
+			"deletion_scheduled_at": user.DeletionScheduledAt,
+		},
+		"memberships":  memberships,
+		"sessions":     sessionData,
+		"books":        books,
+		"shared_books": collaborations,
+		"audit_events": auditEvents,
+	}, nil
+}
+
+// sendUserExport writes the export of a user as a downloadable JSON file
+func sendUserExport(c *gin.Context, userID uint) {
+	export, err := buildUserExport(userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to export user data",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionDataExported,
+		TargetType: "user",
+		TargetID:   userID,
+	})
+
+	filename := fmt.Sprintf("user-%d-export-%s.json", userID, time.Now().UTC().Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.IndentedJSON(http.StatusOK, export)
+}
+
+// scheduleDeletion marks a user for anonymization once the grace period has passed
+func scheduleDeletion(c *gin.Context, userID uint, grace time.Duration) {
+	var user types.User
+	if err := initializers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve user",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	scheduledAt := time.Now().Add(grace)
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var owned []models.Membership
+		if err := tx.Where("user_id = ? AND role = ?", user.ID, models.OrgRoleOwner).
+			Find(&owned).Error; err != nil {
+			return err
+		}
+		for _, membership := range owned {
+			if err := checkOwnersRemain(tx, membership); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&user).Update("deletion_scheduled_at", scheduledAt).Error
+	})
+	if err != nil {
+		if errors.Is(err, errLastOwner) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "The account is the last owner of an organization, transfer the ownership first",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to schedule account deletion",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionDeletionRequested,
+		TargetType: "user",
+		TargetID:   user.ID,
+		After:      gin.H{"deletion_scheduled_at": scheduledAt},
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "Account deletion scheduled",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+// ExportMyData downloads the caller's personal data
+func (pc *PrivacyController) ExportMyData(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	sendUserExport(c, currentUser.(types.User).ID)
+}
+
+// DeleteMyAccount schedules the caller's account for deletion
+func (pc *PrivacyController) DeleteMyAccount(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	scheduleDeletion(c, currentUser.(types.User).ID, deletionGracePeriod())
+}
+
+// CancelMyAccountDeletion withdraws a pending deletion request during the grace period
+func (pc *PrivacyController) CancelMyAccountDeletion(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(types.User)
+
+	if user.DeletionScheduledAt == nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "No account deletion is pending",
+		})
+		return
+	}
+
+	if err := initializers.DB.Model(&user).Update("deletion_scheduled_at", nil).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to cancel account deletion",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionDeletionCanceled,
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account deletion canceled",
+	})
+}
+
+// ExportUserData lets an admin download a user's personal data on their behalf
+func (pc *PrivacyController) ExportUserData(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID format",
+			"details": "ID must be a numeric value",
+		})
+		return
+	}
+	sendUserExport(c, uint(userID))
+}
+
+// DeleteUserAccount lets an admin schedule a user's deletion on their behalf;
+// grace_days overrides the default grace period (0 deletes on the next job run)
+func (pc *PrivacyController) DeleteUserAccount(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID format",
+			"details": "ID must be a numeric value",
+		})
+		return
+	}
+
+	var req struct {
+		GraceDays *int `json:"grace_days"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	grace := deletionGracePeriod()
+	if req.GraceDays != nil && *req.GraceDays >= 0 {
+		grace = time.Duration(*req.GraceDays) * 24 * time.Hour
+	}
+
+	scheduleDeletion(c, uint(userID), grace)
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/types"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var revisionSortKeys = sortKeys{
+	"id":         {Expr: "book_revisions.id", Column: "id"},
+	"created_at": {Expr: "book_revisions.created_at", Column: "created_at"},
+}
+
+// recordBookRevision stores a revision of after within the transaction
+// changing the book. before is nil for creations.
+func recordBookRevision(c *gin.Context, tx *gorm.DB, action string, before *types.Book, after types.Book, restoredFrom *uint) error {
+	snapshot, err := json.Marshal(types.BookRequestFrom(after))
+	if err != nil {
+		return err
+	}
+
+	revision := models.BookRevision{
+		BookID:         uint(after.ID),
+		Version:        after.Version,
+		Action:         action,
+		Snapshot:       snapshot,
+		RestoredFromID: restoredFrom,
+	}
+
+	if action != models.RevisionDelete {
+		var previous interface{}
+		if before != nil {
+			previous = types.BookRequestFrom(*before)
+		}
+		if revision.Changes, err = json.Marshal(audit.Diff(previous, types.BookRequestFrom(after))); err != nil {
+			return err
+		}
+	}
+
+	if value, ok := c.Get("principal"); ok {
+		principal := value.(types.Principal)
+		revision.EditorType = principal.Type
+		revision.EditorID = &principal.ID
+		revision.EditorName = principal.Name
+	}
+
+	return tx.Create(&revision).Error
+}
+
+// loadBookRevision loads a revision of book by its ID in the URL parameter
+// param
+func loadBookRevision(c *gin.Context, book types.Book, param string) (models.BookRevision, bool) {
+	revisionID, err := strconv.Atoi(c.Param(param))
+	if err != nil {
+		revisionID, err = strconv.Atoi(c.Query(param))
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid revision ID format",
+			"details": "ID must be a numeric value",
+		})
+		return models.BookRevision{}, false
+	}
+
+	var revision models.BookRevision
+	if err := initializers.DB.Where("book_id = ?", book.ID).First(&revision, revisionID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Revision not found",
+		})
+		return models.BookRevision{}, false
+	}
+	return revision, true
+}
+
+// revisionFields decodes the editable fields stored in a revision
+func revisionFields(revision models.BookRevision) (types.AddBookRequest, error) {
+	var fields types.AddBookRequest
+	err := json.Unmarshal(revision.Snapshot, &fields)
+	return fields, err
+}
+
+// GetRevisions lists the revisions of a book, newest first
+func (bc *BookController) GetRevisions(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+
+	paging, err := newPaginator(c, revisionSortKeys, "-id", 10, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
+	}
+
+	query := initializers.DB.Model(&models.BookRevision{}).Where("book_id = ?", book.ID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count revisions",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var revisions []models.BookRevision
+	if err := paging.Apply(query).Find(&revisions).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch revisions",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": revisions,
+		"meta": paging.Finish(c, &revisions, total),
+	})
+}
+
+// GetRevision returns a single revision of a book
+func (bc *BookController) GetRevision(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+
+	revision, ok := loadBookRevision(c, book, "revisionId")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": revision,
+	})
+}
+
+// DiffRevisions compares a revision with another one given by ?to=, or with
+// the current book when to is omitted
+func (bc *BookController) DiffRevisions(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+
+	from, ok := loadBookRevision(c, book, "revisionId")
+	if !ok {
+		return
+	}
+	fromFields, err := revisionFields(from)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read revision",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	toFields := types.BookRequestFrom(book)
+	toInfo := gin.H{"current": true, "version": book.Version}
+	if c.Query("to") != "" {
+		to, ok := loadBookRevision(c, book, "to")
+		if !ok {
+			return
+		}
+		if toFields, err = revisionFields(to); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to read revision",
+				"details": err.Error(),
+			})
+			return
+		}
+		toInfo = gin.H{"revision_id": to.ID, "version": to.Version}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    gin.H{"revision_id": from.ID, "version": from.Version},
+		"to":      toInfo,
+		"changes": audit.Diff(fromFields, toFields),
+	})
+}
+
+// RollbackBook restores the fields of a book from a previous revision. The
+// rollback is an update like any other: it is validated, honors If-Match
+// and is recorded as a new revision.
+func (bc *BookController) RollbackBook(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookUpdate)
+	if !ok || !checkIfMatch(c, book) {
+		return
+	}
+
+	revision, ok := loadBookRevision(c, book, "revisionId")
+	if !ok {
+		return
+	}
+	fields, err := revisionFields(revision)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read revision",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	saveBookUpdate(c, book, fields, models.RevisionRollback, &revision.ID)
+}
@@ -0,0 +1,570 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/types"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	serviceTokenTTL = time.Hour
+
+	// maxAssertionLifetime bounds how far in the future a client assertion may expire
+	maxAssertionLifetime = 5 * time.Minute
+
+	// maxAssertionIDLength bounds the jti claims that are remembered
+	maxAssertionIDLength = 255
+
+	defaultRotationGrace = 24 * time.Hour
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// validScopes lists the scopes that can be granted to service accounts
+var validScopes = map[string]bool{
+	models.ScopeBooksRead:  true,
+	models.ScopeBooksWrite: true,
+}
+
+// tokenAudience is the "aud" client assertions must be issued for
+func tokenAudience() string {
+	if audience := os.Getenv("TOKEN_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return "authSystem"
+}
+
+// normalizeScopes validates a list of scopes and returns them space separated
+func normalizeScopes(scopes []string) (string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !validScopes[scope] {
+			return "", fmt.Errorf("unknown scope %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return strings.Join(normalized, " "), nil
+}
+
+// validatePublicKey makes sure a PEM public key can verify client assertions
+func validatePublicKey(pem string) error {
+	if pem == "" {
+		return nil
+	}
+	if _, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pem)); err == nil {
+		return nil
+	}
+	if _, err := jwt.ParseECPublicKeyFromPEM([]byte(pem)); err == nil {
+		return nil
+	}
+	return fmt.Errorf("public_key must be a PEM encoded RSA or ECDSA public key")
+}
+
+type ServiceAccountController struct{}
+
+func NewServiceAccountController() *ServiceAccountController {
+	return &ServiceAccountController{}
+}
+
+// loadServiceAccount loads the service account named by the :id URL parameter
+func loadServiceAccount(c *gin.Context) (models.ServiceAccount, bool) {
+	var account models.ServiceAccount
+
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid service account ID format",
+			"details": "ID must be a numeric value",
+		})
+		return account, false
+	}
+
+	if err := initializers.DB.First(&account, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Service account not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve service account",
+				"details": err.Error(),
+			})
+		}
+		return account, false
+	}
+	return account, true
+}
+
+// GetAllServiceAccounts lists service accounts, optionally only the caller's
+func (sc *ServiceAccountController) GetAllServiceAccounts(c *gin.Context) {
+	query := initializers.DB.Model(&models.ServiceAccount{})
+	if c.Query("mine") == "true" {
+		currentUser, _ := c.Get("user")
+		query = query.Where("owner_id = ?", currentUser.(types.User).ID)
+	}
+
+	var accounts []models.ServiceAccount
+	if err := query.Order("id").Find(&accounts).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch service accounts",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": accounts,
+	})
+}
+
+// CreateServiceAccount registers a service account owned by the calling admin
+// and returns its client secret once
+func (sc *ServiceAccountController) CreateServiceAccount(c *gin.Context) {
+	var req struct {
+		Name           string   `json:"name"`
+		OrganizationID uint     `json:"organization_id"`
+		Scopes         []string `json:"scopes"`
+		PublicKey      string   `json:"public_key"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Name is required",
+		})
+		return
+	}
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid scopes",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := validatePublicKey(req.PublicKey); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid public key",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var org models.Organization
+	if err := initializers.DB.First(&org, req.OrganizationID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Organization not found",
+		})
+		return
+	}
+
+	clientSecret, err := generateSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate the client secret",
+		})
+		return
+	}
+	clientIDSuffix, err := generateSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate the client ID",
+		})
+		return
+	}
+
+	currentUser, _ := c.Get("user")
+	now := time.Now()
+	account := models.ServiceAccount{
+		Name:            strings.TrimSpace(req.Name),
+		ClientID:        "svc_" + strings.ToLower(clientIDSuffix[:16]),
+		OwnerID:         currentUser.(types.User).ID,
+		OrganizationID:  org.ID,
+		Scopes:          scopes,
+		PublicKey:       req.PublicKey,
+		SecretHash:      hashSecret(clientSecret),
+		SecretRotatedAt: &now,
+	}
+
+	if err := initializers.DB.Create(&account).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create service account",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountCreated,
+		TargetType: "service_account",
+		TargetID:   account.ID,
+		After:      account,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data":          account,
+		"client_secret": clientSecret,
+	})
+}
+
+// UpdateServiceAccount changes the scopes, public key or disabled flag of a service account
+func (sc *ServiceAccountController) UpdateServiceAccount(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Scopes    *[]string `json:"scopes"`
+		PublicKey *string   `json:"public_key"`
+		Disabled  *bool     `json:"disabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	before := account
+	if req.Scopes != nil {
+		scopes, err := normalizeScopes(*req.Scopes)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid scopes",
+				"details": err.Error(),
+			})
+			return
+		}
+		account.Scopes = scopes
+	}
+	if req.PublicKey != nil {
+		if err := validatePublicKey(*req.PublicKey); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid public key",
+				"details": err.Error(),
+			})
+			return
+		}
+		account.PublicKey = *req.PublicKey
+	}
+	if req.Disabled != nil {
+		account.Disabled = *req.Disabled
+	}
+
+	if err := initializers.DB.Save(&account).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update service account",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountUpdated,
+		TargetType: "service_account",
+		TargetID:   account.ID,
+		Before:     before,
+		After:      account,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": account,
+	})
+}
+
+// RotateServiceAccountSecret issues a new client secret. The previous secret
+// keeps working for grace_minutes (default 24h) so deployments can roll over.
+func (sc *ServiceAccountController) RotateServiceAccountSecret(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		GraceMinutes *int `json:"grace_minutes"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	grace := defaultRotationGrace
+	if req.GraceMinutes != nil && *req.GraceMinutes >= 0 {
+		grace = time.Duration(*req.GraceMinutes) * time.Minute
+	}
+
+	clientSecret, err := generateSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate the client secret",
+		})
+		return
+	}
+
+	now := time.Now()
+	previousExpiresAt := now.Add(grace)
+	account.PreviousSecretHash = account.SecretHash
+	account.PreviousSecretExpiresAt = &previousExpiresAt
+	account.SecretHash = hashSecret(clientSecret)
+	account.SecretRotatedAt = &now
+
+	if err := initializers.DB.Save(&account).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to rotate the client secret",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountRotated,
+		TargetType: "service_account",
+		TargetID:   account.ID,
+		After:      gin.H{"previous_secret_expires_at": previousExpiresAt},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":          account,
+		"client_secret": clientSecret,
+	})
+}
+
+// DeleteServiceAccount removes a service account; its tokens stop working immediately
+func (sc *ServiceAccountController) DeleteServiceAccount(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Delete(&account).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete service account",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceAccountDeleted,
+		TargetType: "service_account",
+		TargetID:   account.ID,
+		Before:     account,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Service account deleted successfully",
+	})
+}
+
+// checkClientSecret compares a presented secret with the current and, during
+// the rotation grace period, the previous secret
+func checkClientSecret(account models.ServiceAccount, secret string) bool {
+	hash := hashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(account.SecretHash)) == 1 {
+		return true
+	}
+	return account.PreviousSecretHash != "" &&
+		account.PreviousSecretExpiresAt != nil && time.Now().Before(*account.PreviousSecretExpiresAt) &&
+		subtle.ConstantTimeCompare([]byte(hash), []byte(account.PreviousSecretHash)) == 1
+}
+
+// serviceToken issues an access token for a service account with scopes
+func serviceToken(account models.ServiceAccount, scopes []string) (string, error) {
+	return generateToken(jwt.MapClaims{
+		"sub":       account.ClientID,
+		"principal": types.PrincipalService,
+		"scope":     strings.Join(scopes, " "),
+		"org":       account.OrganizationID,
+		"exp":       time.Now().Add(serviceTokenTTL).Unix(),
+	})
+}
+
+// verifyClientAssertion checks a JWT signed with the service account's private
+// key (RFC 7523 private_key_jwt) and returns the client ID it was issued by.
+// Assertions must carry a jti, which is remembered until they expire so that
+// each can be used once.
+func verifyClientAssertion(assertion string) (models.ServiceAccount, error) {
+	var account models.ServiceAccount
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		clientID, _ := claims["iss"].(string)
+		if sub, _ := claims["sub"].(string); sub != clientID {
+			return nil, fmt.Errorf("iss and sub must both be the client ID")
+		}
+		if err := initializers.DB.Where("client_id = ?", clientID).First(&account).Error; err != nil {
+			return nil, fmt.Errorf("unknown client")
+		}
+		if account.PublicKey == "" {
+			return nil, fmt.Errorf("no public key registered for this client")
+		}
+
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return jwt.ParseRSAPublicKeyFromPEM([]byte(account.PublicKey))
+		case *jwt.SigningMethodECDSA:
+			return jwt.ParseECPublicKeyFromPEM([]byte(account.PublicKey))
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+	})
+	if err != nil {
+		return account, err
+	}
+
+	if !claims.VerifyAudience(tokenAudience(), true) {
+		return account, fmt.Errorf("invalid audience")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Until(time.Unix(int64(exp), 0)) > maxAssertionLifetime {
+		return account, fmt.Errorf("assertion must expire within %s", maxAssertionLifetime)
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" || len(jti) > maxAssertionIDLength {
+		return account, fmt.Errorf("assertion must have a jti of at most %d characters", maxAssertionIDLength)
+	}
+	if err := useClientAssertion(account.ClientID, jti, time.Unix(int64(exp), 0)); err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+// useClientAssertion records the jti of an assertion and fails if it has
+// been used before. Expired records of the client are dropped first: the
+// assertions they remember can't be used anymore anyway.
+func useClientAssertion(clientID, jti string, expiresAt time.Time) error {
+	if err := initializers.DB.Where("client_id = ? AND expires_at < ?", clientID, time.Now()).
+		Delete(&models.UsedClientAssertion{}).Error; err != nil {
+		return err
+	}
+	result := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UsedClientAssertion{
+		ClientID:  clientID,
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("assertion has already been used")
+	}
+	return nil
+}
+
+// IssueServiceToken implements the OAuth 2.0 client credentials grant for
+// service accounts, authenticated with a client secret (form fields or HTTP
+// Basic) or a signed client assertion
+func IssueServiceToken(c *gin.Context) {
+	if c.PostForm("grant_type") != "client_credentials" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "unsupported_grant_type",
+		})
+		return
+	}
+
+	var account models.ServiceAccount
+	authenticated := false
+
+	if assertion := c.PostForm("client_assertion"); assertion != "" {
+		if c.PostForm("client_assertion_type") != clientAssertionType {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid_request",
+			})
+			return
+		}
+		var err error
+		account, err = verifyClientAssertion(assertion)
+		authenticated = err == nil
+	} else {
+		clientID, clientSecret, ok := c.Request.BasicAuth()
+		if !ok {
+			clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+		}
+		if err := initializers.DB.Where("client_id = ?", clientID).First(&account).Error; err == nil {
+			authenticated = checkClientSecret(account, clientSecret)
+		}
+	}
+
+	if !authenticated || account.Disabled {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid_client",
+		})
+		return
+	}
+
+	// Grant the requested scopes, or all of the account's scopes if none were requested
+	scopes := account.ScopeList()
+	if requested := strings.Fields(c.PostForm("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !account.HasScope(scope) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": "invalid_scope",
+				})
+				return
+			}
+		}
+		scopes = requested
+	}
+
+	tokenString, err := serviceToken(account, scopes)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate the token",
+		})
+		return
+	}
+
+	now := time.Now()
+	initializers.DB.Model(&account).Update("last_used_at", now)
+
+	accountID := account.ID
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionServiceTokenIssued,
+		ActorType:  types.PrincipalService,
+		ActorID:    &accountID,
+		ActorEmail: account.ClientID,
+		TargetType: "service_account",
+		TargetID:   account.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": tokenString,
+		"token_type":   "Bearer",
+		"expires_in":   int(serviceTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/taxonomy"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxTagLength = 50
+
+// cloudTag is a tag with the number of books carrying it and its weight
+// from 1 (rarest) to 5 (most used) for sizing it in a tag cloud
+type cloudTag struct {
+	ID     uint   `json:"id"`
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`
+	Count  int64  `json:"count"`
+	Weight int    `json:"weight" gorm:"-"`
+}
+
+type TagController struct{}
+
+func NewTagController() *TagController {
+	return &TagController{}
+}
+
+// GetTags returns the tag cloud of the active organization: the tags on its
+// books that aren't trashed with their counts, most used first. q filters by
+// name prefix and limit caps the number of tags (default 50, max 200).
+func (tc *TagController) GetTags(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	limit := 50
+	if input := c.Query("limit"); input != "" {
+		value, err := strconv.Atoi(input)
+		if err != nil || value < 1 || value > 200 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid limit",
+				"details": "limit must be between 1 and 200",
+			})
+			return
+		}
+		limit = value
+	}
+
+	query := initializers.DB.Table("tags").
+		Select("tags.id, tags.name, tags.slug, COUNT(*) AS count").
+		Joins("JOIN book_tags ON book_tags.tag_id = tags.id").
+		Joins("JOIN books ON books.id = book_tags.book_id AND books.deleted_at IS NULL").
+		Where("tags.organization_id = ?", orgID)
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(q)) + "%"
+		query = query.Where("LOWER(tags.name) LIKE ? OR tags.slug LIKE ?", pattern, pattern)
+	}
+
+	tags := []cloudTag{}
+	if err := query.Group("tags.id, tags.name, tags.slug").
+		Order("count DESC, LOWER(tags.name)").
+		Limit(limit).Scan(&tags).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch tags",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Weights are spread on a log scale between the rarest and the most
+	// used tag, so a few popular tags don't flatten the rest
+	if len(tags) > 0 {
+		low, high := math.Log(float64(tags[len(tags)-1].Count)), math.Log(float64(tags[0].Count))
+		for i := range tags {
+			tags[i].Weight = 5
+			if high > low {
+				tags[i].Weight = 1 + int(math.Round(4*(math.Log(float64(tags[i].Count))-low)/(high-low)))
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": tags,
+	})
+}
+
+// bookTags returns the tags of a book sorted by name
+func bookTags(db *gorm.DB, bookID int) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	err := db.Joins("JOIN book_tags ON book_tags.tag_id = tags.id").
+		Where("book_tags.book_id = ?", bookID).
+		Order("LOWER(tags.name)").Find(&tags).Error
+	return tags, err
+}
+
+// GetBookTags lists the tags of a book
+func (bc *BookController) GetBookTags(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookRead)
+	if !ok {
+		return
+	}
+
+	tags, err := bookTags(initializers.DB, book.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch tags",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": tags,
+	})
+}
+
+// AddBookTags tags a book with the given names. Tags are found or created in
+// the book's organization, ignoring case; tags the book already has are kept.
+// Tagging doesn't change the book's version.
+func (bc *BookController) AddBookTags(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookTag)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Tags []string `json:"tags" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": "Expected {\"tags\": [names]}",
+		})
+		return
+	}
+
+	var names []string
+	for _, name := range req.Tags {
+		if name = strings.Join(strings.Fields(name), " "); name == "" {
+			continue
+		}
+		if len([]rune(name)) > maxTagLength || taxonomy.Slugify(name) == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid tag",
+				"details": fmt.Sprintf("%q: tags have up to %d characters and contain letters or digits", name, maxTagLength),
+			})
+			return
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "At least one tag is required",
+		})
+		return
+	}
+
+	var added []string
+	var tags []models.Tag
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			tag, err := taxonomy.FindOrCreateTag(tx, book.OrganizationID, name)
+			if err != nil {
+				return err
+			}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.BookTag{
+				BookID:    uint(book.ID),
+				TagID:     tag.ID,
+				AddedByID: requestUserID(c),
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				added = append(added, tag.Slug)
+			}
+		}
+
+		var err error
+		tags, err = bookTags(tx, book.ID)
+		return err
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to tag book",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if len(added) > 0 {
+		audit.Record(c, audit.Event{
+			Action:     audit.ActionBookTagged,
+			TargetType: "book",
+			TargetID:   book.ID,
+			After:      gin.H{"tags": added},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": tags,
+	})
+}
+
+// RemoveBookTag removes the tag with the :tag slug from a book
+func (bc *BookController) RemoveBookTag(c *gin.Context) {
+	book, ok := loadVisibleBook(c, policy.ActionBookTag)
+	if !ok {
+		return
+	}
+
+	var tag models.Tag
+	if err := initializers.DB.Where("organization_id = ? AND slug = ?", book.OrganizationID, strings.ToLower(c.Param("tag"))).
+		First(&tag).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Tag not found",
+		})
+		return
+	}
+
+	result := initializers.DB.Where("book_id = ? AND tag_id = ?", book.ID, tag.ID).Delete(&models.BookTag{})
+	if result.Error != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to remove tag",
+			"details": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Book doesn't have this tag",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBookUntagged,
+		TargetType: "book",
+		TargetID:   book.ID,
+		Before:     gin.H{"tags": []string{tag.Slug}},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tag removed successfully",
+	})
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"authSystem/audit"
+	"authSystem/covers"
+	"authSystem/initializers"
+	"authSystem/jobs"
+	"authSystem/models"
+	"authSystem/policy"
+	"authSystem/storage"
+	"authSystem/types"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// trashedBook is a deleted book with the time it will be purged, if the
+// trash is purged automatically
+type trashedBook struct {
+	types.Book
+	PurgeAt *time.Time `json:"purge_at,omitempty" gorm:"-"`
+}
+
+// trashedBooks scopes an unscoped book query to the books in the trash
+func trashedBooks(db *gorm.DB) *gorm.DB {
+	return db.Where("books.deleted_at IS NOT NULL")
+}
+
+// GetTrash lists the deleted books visible to the caller, most recently
+// deleted first. It takes the same filters as the book listing.
+func (bc *BookController) GetTrash(c *gin.Context) {
+	if _, ok := activeOrganizationID(c); !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	paging, err := newPaginator(c, bookSortKeys.with("deleted_at", sortKey{Expr: "books.deleted_at", Column: "deleted_at"}), "-deleted_at", 10, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
+	}
+
+	query, _, err := filterBooks(c, trashedBooks(visibleBooks(c, initializers.DB.Unscoped().Model(&types.Book{}))))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search query",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to count books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var books []trashedBook
+	if err := paging.Apply(query).Find(&books).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fetch books",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if retention := jobs.TrashRetention(); retention > 0 {
+		for i := range books {
+			purgeAt := books[i].DeletedAt.Time.Add(retention)
+			books[i].PurgeAt = &purgeAt
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": books,
+		"meta": paging.Finish(c, &books, total),
+	})
+}
+
+// RestoreBook takes a book out of the trash. Whoever may delete a book may
+// restore it; its title or ISBN must not have been taken in the meantime.
+func (bc *BookController) RestoreBook(c *gin.Context) {
+	book, ok := loadBookFrom(c, trashedBooks(visibleBooks(c, initializers.DB.Unscoped())), policy.ActionBookDelete)
+	if !ok || !checkIfMatch(c, book) || !validateBook(c, &book, book.ID) {
+		return
+	}
+
+	before := book
+	book.DeletedAt = gorm.DeletedAt{}
+	book.Version = before.Version + 1
+	book.UpdatedByID = requestUserID(c)
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&book).
+			Where("version = ?", before.Version).
+			Updates(map[string]interface{}{
+				"deleted_at":    nil,
+				"version":       book.Version,
+				"updated_by_id": book.UpdatedByID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errBookChanged
+		}
+		return recordBookRevision(c, tx, models.RevisionRestore, &before, book, nil)
+	})
+	if err == errBookChanged {
+		var current types.Book
+		initializers.DB.Unscoped().First(&current, book.ID)
+		abortBookChanged(c, current)
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to restore book",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBookRestored,
+		TargetType: "book",
+		TargetID:   book.ID,
+	})
+
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, gin.H{
+		"data": book,
+	})
+}
+
+// PurgeBook permanently deletes a book of the active organization from the
+// trash, along with its collaborators and revisions
+func (bc *BookController) PurgeBook(c *gin.Context) {
+	orgID, ok := activeOrganizationID(c)
+	if !ok {
+		abortNoOrganization(c)
+		return
+	}
+
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid book ID format",
+			"details": "ID must be a numeric value",
+		})
+		return
+	}
+
+	var book types.Book
+	var cover *models.BookCover
+	err = initializers.DB.Transaction(func(tx *gorm.DB) (err error) {
+		if err := tx.Unscoped().Where("organization_id = ?", orgID).First(&book, bookID).Error; err != nil {
+			return err
+		}
+
+		if !book.DeletedAt.Valid {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error":   "Book is not in the trash",
+				"details": "Delete the book before purging it",
+			})
+			return errAborted
+		}
+
+		cover, err = jobs.PurgeBook(tx, uint(book.ID))
+		return err
+	})
+
+	if err == errAborted {
+		return
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Book not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to purge book",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	if cover != nil {
+		covers.Discard(c.Request.Context(), storage.Default(), *cover)
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionBookPurged,
+		TargetType: "book",
+		TargetID:   book.ID,
+		Before:     book,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Book purged successfully",
+	})
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"authSystem/audit"
 	"authSystem/initializers"
 	"authSystem/types"
 	"net/http"
@@ -8,9 +9,15 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	// "gorm.io/gorm"
+	"gorm.io/gorm"
 )
 
+// validRoles lists the roles that can be assigned to a user
+var validRoles = map[string]bool{
+	"user":  true,
+	"admin": true,
+}
+
 type UserController struct{}
 
 func NewUserController() *UserController {
@@ -19,17 +26,12 @@ func NewUserController() *UserController {
 
 // GetAllUsers returns a paginated list of users with filtering options
 func (uc *UserController) GetAllUsers(c *gin.Context) {
-	// Parse pagination parameters with defaults and validation
-	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
-	if err != nil || page < 1 {
-		page = 1
-	}
-
-	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	if err != nil || limit < 1 || limit > 50 { // Enforce reasonable limit
-		limit = 10
+	// Parse pagination and sorting parameters
+	paging, err := newPaginator(c, userSortKeys, "id", 10, 50)
+	if err != nil {
+		abortInvalidPagination(c, err)
+		return
 	}
-	offset := (page - 1) * limit
 
 	// Parse filter parameters
 	email := strings.TrimSpace(c.Query("email"))
@@ -56,7 +58,7 @@ func (uc *UserController) GetAllUsers(c *gin.Context) {
 	}
 	// Fetch paginated results
 	var users []types.User
-	if err := query.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+	if err := paging.Apply(query).Find(&users).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to fetch users",
 			"details": err.Error(),
@@ -66,10 +68,82 @@ func (uc *UserController) GetAllUsers(c *gin.Context) {
 	// Return paginated results
 	c.JSON(http.StatusOK, gin.H{
 		"users": users,
-		"Meta": gin.H{
-			"page":  page,
-			"limit": limit,
-			"total": total,
-		},
+		"meta":  paging.Finish(c, &users, total),
+	})
+}
+
+// UpdateUserRole changes the role of a user
+func (uc *UserController) UpdateUserRole(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID format",
+			"details": "ID must be a numeric value",
+		})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if !validRoles[role] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid role",
+		})
+		return
+	}
+
+	// Prevent admins from locking themselves out
+	currentUser, _ := c.Get("user")
+	if uint(userID) == currentUser.(types.User).ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "You cannot change your own role",
+		})
+		return
+	}
+
+	var user types.User
+	if err := initializers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to retrieve user",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	previousRole := user.Role
+	if err := initializers.DB.Model(&user).Update("role", role).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update user role",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionRoleChanged,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Before:     gin.H{"role": previousRole},
+		After:      gin.H{"role": role},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": user,
 	})
 }
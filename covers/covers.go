@@ -0,0 +1,98 @@
+// Package covers turns uploaded cover images into the variants books are
+// shown with and keeps them in a blob store.
+package covers
+
+import (
+	"authSystem/middleware"
+	"authSystem/models"
+	"authSystem/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Key is where a variant of a cover is stored
+func Key(cover models.BookCover, size string) string {
+	ext := ".jpg"
+	if cover.ContentType == "image/png" {
+		ext = ".png"
+	}
+	return fmt.Sprintf("covers/%d/%d/%s-%s%s", cover.OrganizationID, cover.BookID, cover.Hash, size, ext)
+}
+
+// ParseVariants returns the variants stored of a cover
+func ParseVariants(cover models.BookCover) ([]Variant, error) {
+	var variants []Variant
+	if len(cover.Variants) == 0 {
+		return variants, nil
+	}
+	err := json.Unmarshal(cover.Variants, &variants)
+	return variants, err
+}
+
+// HasSize reports whether a cover is stored in size
+func HasSize(cover models.BookCover, size string) bool {
+	variants, _ := ParseVariants(cover)
+	for _, variant := range variants {
+		if variant.Name == size {
+			return true
+		}
+	}
+	return false
+}
+
+// Save stores every variant of a processed cover of a book and returns the
+// cover to record. If a variant can't be stored the ones already stored are
+// removed again.
+func Save(ctx context.Context, store storage.BlobStore, book models.BookCover, img *Image) (models.BookCover, error) {
+	cover := book
+	cover.Hash = img.Hash
+	cover.ContentType = img.ContentType
+	cover.Width, cover.Height = img.Width, img.Height
+	variants, err := json.Marshal(img.Variants)
+	if err != nil {
+		return cover, err
+	}
+	cover.Variants = models.JSON(variants)
+
+	for i, variant := range img.Variants {
+		if err := store.Put(ctx, Key(cover, variant.Name), variant.data, img.ContentType); err != nil {
+			for _, stored := range img.Variants[:i] {
+				store.Delete(context.WithoutCancel(ctx), Key(cover, stored.Name))
+			}
+			return cover, fmt.Errorf("failed to store %s cover: %w", variant.Name, err)
+		}
+	}
+	return cover, nil
+}
+
+// Remove deletes the stored variants of a cover
+func Remove(ctx context.Context, store storage.BlobStore, cover models.BookCover) error {
+	variants, err := ParseVariants(cover)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, variant := range variants {
+		if err := store.Delete(ctx, Key(cover, variant.Name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Discard removes the variants of a cover that is no longer recorded. The
+// change that dropped it is already committed, so failures are only logged
+// and leave unreferenced blobs behind.
+func Discard(ctx context.Context, store storage.BlobStore, cover models.BookCover) {
+	if err := Remove(ctx, store, cover); err != nil {
+		middleware.GetLogger().Warn("Failed to remove cover files",
+			zap.Uint("book_id", cover.BookID),
+			zap.String("hash", cover.Hash),
+			zap.Error(err),
+		)
+	}
+}
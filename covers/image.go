@@ -0,0 +1,161 @@
+package covers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// maxPixels bounds the size of decoded images, so a small file can't
+	// decompress into gigabytes
+	maxPixels = 40_000_000
+
+	jpegQuality = 85
+)
+
+// Accepted upload types
+var uploadTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+var (
+	ErrUnsupportedType = errors.New("cover must be a JPEG, PNG or WebP image")
+	ErrTypeMismatch    = errors.New("cover content doesn't match its declared type")
+	ErrTooManyPixels   = fmt.Errorf("cover must have at most %d pixels", maxPixels)
+)
+
+// Size is a variant of a cover, scaled to fit MaxSide pixels
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+// Sizes are the variants every cover is stored in. The original is kept up
+// to a size that is plenty for a cover; smaller images are never enlarged.
+var Sizes = []Size{
+	{Name: "original", MaxSide: 2048},
+	{Name: "large", MaxSide: 640},
+	{Name: "medium", MaxSide: 320},
+	{Name: "small", MaxSide: 160},
+}
+
+// Variant is a stored size of a cover
+type Variant struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int    `json:"bytes"`
+
+	data []byte
+}
+
+// Image is a processed cover: the upload decoded, turned upright and
+// re-encoded in every size. Re-encoding drops EXIF and any other metadata
+// of the upload.
+type Image struct {
+	Hash        string
+	ContentType string
+	Width       int
+	Height      int
+	Variants    []Variant
+}
+
+// Process checks an upload by its content and makes the variants of a
+// cover from it. The type the client declared, if any, has to match the
+// content; "" and application/octet-stream declare none. Covers without
+// transparency are stored as JPEG, others as PNG.
+func Process(data []byte, declaredType string) (*Image, error) {
+	contentType := http.DetectContentType(data)
+	if !uploadTypes[contentType] {
+		return nil, ErrUnsupportedType
+	}
+	switch declaredType = strings.ToLower(declaredType); declaredType {
+	case "", "application/octet-stream", contentType:
+	case "image/jpg":
+		// A common misspelling of image/jpeg
+		if contentType != "image/jpeg" {
+			return nil, ErrTypeMismatch
+		}
+	default:
+		return nil, ErrTypeMismatch
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if contentType == "image/jpeg" {
+		decoded = orient(decoded, jpegOrientation(data))
+	}
+
+	sum := sha256.Sum256(data)
+	cover := &Image{Hash: hex.EncodeToString(sum[:8]), ContentType: "image/jpeg"}
+	if !opaque(decoded) {
+		cover.ContentType = "image/png"
+	}
+	for _, size := range Sizes {
+		scaled := scale(decoded, size.MaxSide)
+		var buf bytes.Buffer
+		if cover.ContentType == "image/png" {
+			err = png.Encode(&buf, scaled)
+		} else {
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil {
+			return nil, err
+		}
+		bounds := scaled.Bounds()
+		cover.Variants = append(cover.Variants, Variant{
+			Name:   size.Name,
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+			Bytes:  buf.Len(),
+			data:   buf.Bytes(),
+		})
+	}
+	cover.Width, cover.Height = cover.Variants[0].Width, cover.Variants[0].Height
+	return cover, nil
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// scale shrinks img to fit maxSide pixels, keeping its aspect ratio
+func scale(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			width, height = maxSide, max(1, height*maxSide/width)
+		} else {
+			width, height = max(1, width*maxSide/height), maxSide
+		}
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
@@ -0,0 +1,253 @@
+package covers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves is a width x height image, red on the left and blue on the right
+func halves(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF segment with an orientation tag after the
+// start of a JPEG image
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientationTag)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // value padding, no next IFD
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+// red reports whether a pixel is clearly red rather than blue
+func red(img image.Image, x, y int) bool {
+	r, _, b, _ := img.At(x, y).RGBA()
+	return r > 0xC000 && b < 0x4000
+}
+
+func decodeVariant(t *testing.T, variant Variant) image.Image {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(variant.data))
+	if err != nil {
+		t.Fatalf("variant %s doesn't decode: %v", variant.Name, err)
+	}
+	return img
+}
+
+func TestProcessMakesEverySize(t *testing.T) {
+	cover, err := Process(encodeJPEG(t, halves(1000, 500)), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if cover.ContentType != "image/jpeg" || cover.Width != 1000 || cover.Height != 500 || len(cover.Hash) != 16 {
+		t.Errorf("Process() = %+v, want a 1000x500 JPEG", cover)
+	}
+
+	want := map[string][2]int{"original": {1000, 500}, "large": {640, 320}, "medium": {320, 160}, "small": {160, 80}}
+	if len(cover.Variants) != len(want) {
+		t.Fatalf("Process() made %d variants, want %d", len(cover.Variants), len(want))
+	}
+	for _, variant := range cover.Variants {
+		size := decodeVariant(t, variant).Bounds().Size()
+		if w := want[variant.Name]; variant.Width != w[0] || variant.Height != w[1] || size.X != w[0] || size.Y != w[1] {
+			t.Errorf("variant %s is %dx%d (%v), want %dx%d", variant.Name, variant.Width, variant.Height, size, w[0], w[1])
+		}
+		if variant.Bytes != len(variant.data) {
+			t.Errorf("variant %s has Bytes %d, want %d", variant.Name, variant.Bytes, len(variant.data))
+		}
+	}
+}
+
+func TestProcessKeepsTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	img.Set(5, 5, color.NRGBA{G: 255, A: 128})
+	cover, err := Process(encodePNG(t, img), "image/png")
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if cover.ContentType != "image/png" {
+		t.Errorf("ContentType = %q, want image/png", cover.ContentType)
+	}
+}
+
+func TestProcessRejectsUploads(t *testing.T) {
+	png := encodePNG(t, halves(10, 10))
+	tests := []struct {
+		name     string
+		data     []byte
+		declared string
+		err      error
+	}{
+		{"PNG declared as JPEG", png, "image/jpeg", ErrTypeMismatch},
+		{"PNG declared as jpg", png, "image/jpg", ErrTypeMismatch},
+		{"PNG declared as WebP", png, "image/webp", ErrTypeMismatch},
+		{"GIF", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), "", ErrUnsupportedType},
+		{"HTML", []byte("<html><script>alert(1)</script></html>"), "image/png", ErrUnsupportedType},
+		{"SVG", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "image/svg+xml", ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data, tt.declared); !errors.Is(err, tt.err) {
+				t.Errorf("Process() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestProcessAcceptsUndeclaredTypes(t *testing.T) {
+	for _, declared := range []string{"", "application/octet-stream", "IMAGE/PNG"} {
+		if _, err := Process(encodePNG(t, halves(10, 10)), declared); err != nil {
+			t.Errorf("Process() declared as %q error = %v", declared, err)
+		}
+	}
+	if _, err := Process(encodeJPEG(t, halves(10, 10)), "image/jpg"); err != nil {
+		t.Errorf("Process() of a JPEG declared as image/jpg error = %v", err)
+	}
+}
+
+func TestProcessRejectsTooManyPixels(t *testing.T) {
+	// A PNG whose header claims 10000x5000 pixels; the pixels are never
+	// decoded
+	ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), 10000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 5000)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0) // 8-bit RGB
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+
+	if _, err := Process(data, "image/png"); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("Process() error = %v, want ErrTooManyPixels", err)
+	}
+}
+
+func TestProcessStripsEXIF(t *testing.T) {
+	data := withOrientation(encodeJPEG(t, halves(40, 20)), 1)
+	if !bytes.Contains(data, []byte("Exif")) {
+		t.Fatal("test image has no EXIF segment")
+	}
+	cover, err := Process(data, "image/jpeg")
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	for _, variant := range cover.Variants {
+		if bytes.Contains(variant.data, []byte("Exif")) {
+			t.Errorf("variant %s still has EXIF", variant.Name)
+		}
+	}
+}
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	// 6 means the camera was turned clockwise: the left of the stored image
+	// is the top of the photo
+	cover, err := Process(withOrientation(encodeJPEG(t, halves(40, 20)), 6), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if cover.Width != 20 || cover.Height != 40 {
+		t.Fatalf("Process() is %dx%d, want 20x40", cover.Width, cover.Height)
+	}
+	img := decodeVariant(t, cover.Variants[0])
+	if !red(img, 10, 5) || red(img, 10, 35) {
+		t.Error("orientation 6 not applied: want red at the top and blue at the bottom")
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// Where the red left half of a stored 4x2 image ends up
+	tests := []struct {
+		orientation int
+		size        image.Point
+		redAt       image.Point
+		blueAt      image.Point
+	}{
+		{1, image.Pt(4, 2), image.Pt(0, 0), image.Pt(3, 0)},
+		{2, image.Pt(4, 2), image.Pt(3, 0), image.Pt(0, 0)},
+		{3, image.Pt(4, 2), image.Pt(3, 1), image.Pt(0, 1)},
+		{4, image.Pt(4, 2), image.Pt(0, 1), image.Pt(3, 1)},
+		{5, image.Pt(2, 4), image.Pt(0, 0), image.Pt(0, 3)},
+		{6, image.Pt(2, 4), image.Pt(0, 0), image.Pt(0, 3)},
+		{7, image.Pt(2, 4), image.Pt(0, 3), image.Pt(0, 0)},
+		{8, image.Pt(2, 4), image.Pt(0, 3), image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		img := orient(halves(4, 2), tt.orientation)
+		if size := img.Bounds().Size(); size != tt.size {
+			t.Errorf("orientation %d: size %v, want %v", tt.orientation, size, tt.size)
+			continue
+		}
+		if !red(img, tt.redAt.X, tt.redAt.Y) || red(img, tt.blueAt.X, tt.blueAt.Y) {
+			t.Errorf("orientation %d: want red at %v and blue at %v", tt.orientation, tt.redAt, tt.blueAt)
+		}
+	}
+}
+
+func TestProcessDecodesWebP(t *testing.T) {
+	tests := map[string]string{
+		"lossless": "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==",
+		"lossy":    "UklGRiIAAABXRUJQVlA4IBYAAAAwAQCdASoBAAEADsD+JaQAA3AAAAAA",
+	}
+	for name, encoded := range tests {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cover, err := Process(data, "image/webp")
+		if err != nil {
+			t.Errorf("%s: Process() error = %v", name, err)
+			continue
+		}
+		if cover.Width != 1 || cover.Height != 1 || len(cover.Variants) != len(Sizes) {
+			t.Errorf("%s: Process() = %+v, want a 1x1 cover in every size", name, cover)
+		}
+	}
+}
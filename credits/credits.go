@@ -0,0 +1,203 @@
+// Package credits links the free-text author of a book to author records:
+// it splits the text into names, derives sort names and keeps a book's
+// author credits in line with its text.
+package credits
+
+import (
+	"authSystem/models"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Separator joins the names of a book's authors into its author text, which
+// Split takes apart again
+const Separator = " & "
+
+var (
+	nameSeparators = regexp.MustCompile(`(?i);|\s+(?:&|and)\s+`)
+	etAl           = regexp.MustCompile(`(?i),?\s*et al\.?$`)
+)
+
+// nameSuffixes stay at the end of a sort name
+var nameSuffixes = map[string]bool{"jr.": true, "jr": true, "sr.": true, "sr": true, "ii": true, "iii": true, "iv": true}
+
+// Split returns the names in an author text. Names are separated by ";",
+// "&" or "and", or by commas unless the text is a single inverted name like
+// "Tolkien, J. R. R.", which becomes "J. R. R. Tolkien". "et al." is
+// dropped and repeated names are listed once.
+func Split(text string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, part := range nameSeparators.Split(text, -1) {
+		part = strings.Join(strings.Fields(part), " ")
+		part = strings.TrimSuffix(strings.TrimSpace(etAl.ReplaceAllString(part, "")), ",")
+
+		pieces := strings.Split(part, ",")
+		if len(pieces) == 2 {
+			last, rest := strings.TrimSpace(pieces[0]), strings.TrimSpace(pieces[1])
+			switch {
+			case nameSuffixes[strings.ToLower(rest)]:
+				// "Martin Luther King, Jr." is a single name
+				pieces = []string{part}
+			case rest != "" && !strings.Contains(last, " "):
+				// "Tolkien, J. R. R." is an inverted name
+				pieces = []string{rest + " " + last}
+			}
+		}
+
+		for _, name := range pieces {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[strings.ToLower(name)] {
+				continue
+			}
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Join builds the author text of a book from the names of its authors
+func Join(names []string) string {
+	return strings.Join(names, Separator)
+}
+
+// SortName files a name under its last word: "J. R. R. Tolkien" becomes
+// "Tolkien, J. R. R." and "Martin Luther King, Jr." "King, Martin Luther,
+// Jr.". Names that are already inverted are kept.
+func SortName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if i := strings.LastIndex(name, ","); i >= 0 && nameSuffixes[strings.ToLower(strings.TrimSpace(name[i+1:]))] {
+		name = name[:i] + name[i+1:]
+	}
+	if strings.Contains(name, ",") {
+		return name
+	}
+
+	words := strings.Fields(name)
+	var suffix string
+	if len(words) > 2 && nameSuffixes[strings.ToLower(words[len(words)-1])] {
+		suffix = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	if len(words) < 2 {
+		return name
+	}
+
+	sortName := words[len(words)-1] + ", " + strings.Join(words[:len(words)-1], " ")
+	if suffix != "" {
+		sortName += ", " + suffix
+	}
+	return sortName
+}
+
+// FindOrCreateAuthor returns the author of the organization with the given
+// name, ignoring case, creating it when there is none. Names are unique per
+// organization ignoring case, so concurrent calls end up with the same
+// author.
+func FindOrCreateAuthor(tx *gorm.DB, organizationID uint, name string) (models.Author, error) {
+	author := models.Author{
+		OrganizationID: organizationID,
+		Name:           name,
+		SortName:       SortName(name),
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}, {Name: "(LOWER(name))", Raw: true}},
+		DoNothing: true,
+	}).Create(&author).Error
+	if err != nil || author.ID != 0 {
+		return author, err
+	}
+
+	err = tx.Where("organization_id = ? AND LOWER(name) = LOWER(?)", organizationID, name).First(&author).Error
+	return author, err
+}
+
+// MoveCredits moves the credits of an author to another one. Books crediting
+// both in the same role keep the credit of the target.
+func MoveCredits(tx *gorm.DB, sourceID, targetID uint) error {
+	var moved []models.BookAuthor
+	if err := tx.Where("author_id = ?", sourceID).Find(&moved).Error; err != nil {
+		return err
+	}
+
+	for _, credit := range moved {
+		var duplicates int64
+		if err := tx.Model(&models.BookAuthor{}).
+			Where("book_id = ? AND author_id = ? AND role = ?", credit.BookID, targetID, credit.Role).
+			Count(&duplicates).Error; err != nil {
+			return err
+		}
+		if duplicates > 0 {
+			if err := tx.Delete(&credit).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Model(&credit).Update("author_id", targetID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync makes the author credits of a book match the names in its author
+// text. Credits whose author has one of the names are kept, so a name keeps
+// pointing to the author it was linked to; the other names are found or
+// created by name. Credits in other roles are left alone.
+func Sync(tx *gorm.DB, bookID, organizationID uint, text string) error {
+	var existing []models.BookAuthor
+	if err := tx.Preload("Author").
+		Where("book_id = ? AND role = ?", bookID, models.AuthorRoleAuthor).
+		Find(&existing).Error; err != nil {
+		return err
+	}
+
+	byName := map[string]models.BookAuthor{}
+	for _, credit := range existing {
+		if credit.Author != nil {
+			byName[strings.ToLower(credit.Author.Name)] = credit
+		}
+	}
+
+	kept := map[uint]bool{}
+	for position, name := range Split(text) {
+		credit, ok := byName[strings.ToLower(name)]
+		if !ok {
+			author, err := FindOrCreateAuthor(tx, organizationID, name)
+			if err != nil {
+				return err
+			}
+			credit = models.BookAuthor{BookID: bookID, AuthorID: author.ID, Role: models.AuthorRoleAuthor}
+		}
+		credit.Position = position
+		credit.Author = nil
+		if err := tx.Omit(clause.Associations).Save(&credit).Error; err != nil {
+			return err
+		}
+		kept[credit.ID] = true
+	}
+
+	for _, credit := range existing {
+		if !kept[credit.ID] {
+			if err := tx.Delete(&models.BookAuthor{}, credit.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Text builds the author text of a book from its author credits
+func Text(tx *gorm.DB, bookID uint) (string, error) {
+	var names []string
+	err := tx.Model(&models.BookAuthor{}).
+		Joins("JOIN authors ON authors.id = book_authors.author_id").
+		Where("book_authors.book_id = ? AND book_authors.role = ?", bookID, models.AuthorRoleAuthor).
+		Order("book_authors.position, book_authors.id").
+		Pluck("authors.name", &names).Error
+	return Join(names), err
+}
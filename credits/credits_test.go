@@ -0,0 +1,73 @@
+package credits
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{name: "single name", text: "J. R. R. Tolkien", expected: []string{"J. R. R. Tolkien"}},
+		{name: "inverted name", text: "Tolkien, J. R. R.", expected: []string{"J. R. R. Tolkien"}},
+		{name: "name with a suffix", text: "Martin Luther King, Jr.", expected: []string{"Martin Luther King, Jr."}},
+		{name: "and", text: "A and B", expected: []string{"A", "B"}},
+		{name: "and in any case", text: "Terry Pratchett AND Neil Gaiman", expected: []string{"Terry Pratchett", "Neil Gaiman"}},
+		{name: "ampersand", text: "Terry Pratchett & Neil Gaiman", expected: []string{"Terry Pratchett", "Neil Gaiman"}},
+		{name: "semicolons", text: "Tolkien, J. R. R.; Tolkien, Christopher", expected: []string{"J. R. R. Tolkien", "Christopher Tolkien"}},
+		{name: "commas", text: "Ursula K. Le Guin, Terry Pratchett, Neil Gaiman", expected: []string{"Ursula K. Le Guin", "Terry Pratchett", "Neil Gaiman"}},
+		{name: "et al.", text: "X, et al.", expected: []string{"X"}},
+		{name: "et al. without a comma", text: "Ursula K. Le Guin et al", expected: []string{"Ursula K. Le Guin"}},
+		{name: "repeated names", text: "Neil Gaiman & neil gaiman", expected: []string{"Neil Gaiman"}},
+		{name: "extra spaces", text: "  Terry   Pratchett ;  ; Neil Gaiman ", expected: []string{"Terry Pratchett", "Neil Gaiman"}},
+		{name: "and inside a name", text: "Alexandra Anderson", expected: []string{"Alexandra Anderson"}},
+		{name: "empty", text: "", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := Split(tt.text); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Split(%q) = %q, want %q", tt.text, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJoinRoundTrips(t *testing.T) {
+	names := []string{"J. R. R. Tolkien", "Martin Luther King, Jr.", "Neil Gaiman"}
+
+	text := Join(names)
+	if text != "J. R. R. Tolkien & Martin Luther King, Jr. & Neil Gaiman" {
+		t.Errorf("Join() = %q", text)
+	}
+	if result := Split(text); !reflect.DeepEqual(result, names) {
+		t.Errorf("Split(Join()) = %q, want %q", result, names)
+	}
+}
+
+func TestSortName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "J. R. R. Tolkien", expected: "Tolkien, J. R. R."},
+		{name: "Martin Luther King, Jr.", expected: "King, Martin Luther, Jr."},
+		{name: "Martin Luther King Jr.", expected: "King, Martin Luther, Jr."},
+		{name: "Henry Ford II", expected: "Ford, Henry, II"},
+		{name: "Tolkien, J. R. R.", expected: "Tolkien, J. R. R."},
+		{name: "  Terry   Pratchett ", expected: "Pratchett, Terry"},
+		{name: "Homer", expected: "Homer"},
+		{name: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := SortName(tt.name); result != tt.expected {
+				t.Errorf("SortName(%q) = %q, want %q", tt.name, result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Package export writes tabular data as CSV, newline delimited JSON or Excel
+// workbooks, a row at a time, so exports of any size can be streamed.
+package export
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Formats an export can be written in
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// Format describes how an export is served
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+}
+
+var formats = map[string]Format{
+	FormatCSV:    {FormatCSV, "text/csv; charset=utf-8", ".csv"},
+	FormatNDJSON: {FormatNDJSON, "application/x-ndjson", ".ndjson"},
+	FormatXLSX:   {FormatXLSX, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"},
+}
+
+// Lookup returns the format with the given name
+func Lookup(name string) (Format, error) {
+	format, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("format must be csv, ndjson or xlsx")
+	}
+	return format, nil
+}
+
+// Filename names an export file, e.g. books-20240301T101500Z.csv.gz
+func (f Format) Filename(prefix string, at time.Time, gzipped bool) string {
+	name := prefix + "-" + at.UTC().Format("20060102T150405Z") + f.Extension
+	if gzipped {
+		name += ".gz"
+	}
+	return name
+}
+
+// Writer writes the rows of an export. Values are strings, integers, floats,
+// booleans, times or nil. Close must be called to complete the file.
+type Writer interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// NewWriter returns a writer of format with the given columns to w,
+// compressed with gzip if gzipped is set
+func NewWriter(format Format, w io.Writer, columns []string, gzipped bool) (Writer, error) {
+	var compressor *gzip.Writer
+	if gzipped {
+		compressor = gzip.NewWriter(w)
+		w = compressor
+	}
+
+	var writer Writer
+	var err error
+	switch format.Name {
+	case FormatCSV:
+		writer, err = newCSVWriter(w, columns)
+	case FormatNDJSON:
+		writer = &ndjsonWriter{encoder: json.NewEncoder(w), columns: columns}
+	case FormatXLSX:
+		writer, err = newXLSXWriter(w, columns)
+	default:
+		err = fmt.Errorf("unknown format %q", format.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if compressor != nil {
+		writer = &gzipWriter{Writer: writer, compressor: compressor}
+	}
+	return writer, nil
+}
+
+// gzipWriter flushes the compressor when the format writer is closed
+type gzipWriter struct {
+	Writer
+	compressor *gzip.Writer
+}
+
+func (w *gzipWriter) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	return w.compressor.Close()
+}
+
+// csvWriter writes a header row and a record per row. Cells that a
+// spreadsheet would evaluate as a formula are prefixed with a quote.
+type csvWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: writer, record: make([]string, len(columns))}, nil
+}
+
+func (w *csvWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		text := formatValue(value)
+		if _, ok := value.(string); ok && text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+			text = "'" + text
+		}
+		w.record[i] = text
+	}
+	return w.writer.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// ndjsonWriter writes an object per row keyed by the columns
+type ndjsonWriter struct {
+	encoder *json.Encoder
+	columns []string
+}
+
+func (w *ndjsonWriter) WriteRow(values []interface{}) error {
+	object := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		object[w.columns[i]] = value
+	}
+	return w.encoder.Encode(object)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
+
+// formatValue renders a value as text for CSV and spreadsheet cells
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
@@ -1,8 +1,13 @@
 package initializers
 
 import (
+	"authSystem/credits"
 	"authSystem/models"
+	"authSystem/search"
+	"authSystem/taxonomy"
 	"log"
+
+	"gorm.io/gorm"
 )
 
 func SyncDatabase() error {
@@ -12,7 +17,23 @@ func SyncDatabase() error {
 
 	err := DB.AutoMigrate(
 		&models.User{},
+		&models.Organization{},
+		&models.Membership{},
 		&models.Book{},
+		&models.BookCollaborator{},
+		&models.BookRevision{},
+		&models.Author{},
+		&models.BookAuthor{},
+		&models.Category{},
+		&models.Tag{},
+		&models.BookTag{},
+		&models.BookCover{},
+		&models.ExportJob{},
+		&models.AuditEvent{},
+		&models.Invitation{},
+		&models.Setting{},
+		&models.ServiceAccount{},
+		&models.UsedClientAssertion{},
 	)
 	
 	if err != nil {
@@ -20,6 +41,228 @@ func SyncDatabase() error {
 		return err
 	}
 
+	if err := migrateOrganizations(); err != nil {
+		log.Fatal("Failed to migrate organizations: ", err)
+		return err
+	}
+
+	if err := migrateBookOwners(); err != nil {
+		log.Fatal("Failed to migrate book owners: ", err)
+		return err
+	}
+
+	if err := migrateBookSearch(); err != nil {
+		log.Fatal("Failed to migrate book search: ", err)
+		return err
+	}
+
+	if err := migrateBookTrash(); err != nil {
+		log.Fatal("Failed to migrate book trash: ", err)
+		return err
+	}
+
+	if err := migrateBookMetadata(); err != nil {
+		log.Fatal("Failed to migrate book metadata: ", err)
+		return err
+	}
+
+	if err := migrateAuthorNames(); err != nil {
+		log.Fatal("Failed to migrate author names: ", err)
+		return err
+	}
+
+	if err := migrateBookAuthors(); err != nil {
+		log.Fatal("Failed to migrate book authors: ", err)
+		return err
+	}
+
+	if err := migrateBookCategories(); err != nil {
+		log.Fatal("Failed to migrate book categories: ", err)
+		return err
+	}
+
 	log.Println("Database synced successfully")
 	return nil
-}
\ No newline at end of file
+}
+
+// migrateOrganizations moves data created before multi-tenancy into a default
+// organization: title uniqueness becomes per organization, orphan books are
+// assigned to it and users without any membership join it as editors.
+func migrateOrganizations() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		// Drop the old global unique constraint on books.title
+		for _, constraint := range []string{"uni_books_title", "books_title_key"} {
+			if err := tx.Exec("ALTER TABLE books DROP CONSTRAINT IF EXISTS " + constraint).Error; err != nil {
+				return err
+			}
+		}
+
+		var orphanBooks, orphanUsers int64
+		if err := tx.Model(&models.Book{}).Unscoped().Where("organization_id IS NULL OR organization_id = 0").Count(&orphanBooks).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).
+			Where("NOT EXISTS (SELECT 1 FROM memberships WHERE memberships.user_id = users.id AND memberships.deleted_at IS NULL)").
+			Count(&orphanUsers).Error; err != nil {
+			return err
+		}
+		if orphanBooks == 0 && orphanUsers == 0 {
+			return nil
+		}
+
+		org := models.Organization{Name: "Default", Slug: "default"}
+		if err := tx.Where("slug = ?", org.Slug).FirstOrCreate(&org).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Book{}).Unscoped().
+			Where("organization_id IS NULL OR organization_id = 0").
+			Update("organization_id", org.ID).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`INSERT INTO memberships (created_at, updated_at, user_id, organization_id, role)
+			SELECT NOW(), NOW(), users.id, ?, CASE WHEN users.role = 'admin' THEN ? ELSE ? END
+			FROM users
+			WHERE users.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM memberships WHERE memberships.user_id = users.id AND memberships.deleted_at IS NULL)`,
+			org.ID, models.OrgRoleAdmin, models.OrgRoleEditor).Error
+	})
+}
+
+// migrateBookOwners fills in the creator of books created before ownership
+// was recorded, using the book.create entries of the audit trail
+func migrateBookOwners() error {
+	return DB.Exec(`UPDATE books SET created_by_id = audit_events.actor_id
+		FROM audit_events
+		WHERE books.created_by_id IS NULL
+		AND audit_events.action = 'book.create'
+		AND audit_events.actor_type = 'user'
+		AND audit_events.target_id = CAST(books.id AS text)`).Error
+}
+
+// migrateBookSearch adds the weighted full-text search vector over title,
+// author and category as a generated column with a GIN index, and trigram
+// indexes on title and author for suggestions
+func migrateBookSearch() error {
+	statements := []string{
+		`ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (` + search.Vector + `) STORED`,
+		"CREATE INDEX IF NOT EXISTS idx_books_search_vector ON books USING GIN (search_vector)",
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_books_title_trgm ON books USING GIN (LOWER(title) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_books_author_trgm ON books USING GIN (LOWER(author) gin_trgm_ops)",
+	}
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateBookTrash drops the title index covering all books, replaced by a
+// partial index so that trashed books don't block their title
+func migrateBookTrash() error {
+	return DB.Exec("DROP INDEX IF EXISTS idx_books_org_title").Error
+}
+
+// migrateBookMetadata drops the title index of the trash migration, replaced
+// by idx_books_org_title_without_isbn now that books with an ISBN are unique
+// by ISBN instead
+func migrateBookMetadata() error {
+	return DB.Exec("DROP INDEX IF EXISTS idx_books_org_title_active").Error
+}
+
+// migrateAuthorNames makes author names unique per organization ignoring
+// case: authors spelled like an older one are merged into it, then a unique
+// index keeps new ones from being created side by side
+func migrateAuthorNames() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var duplicates []models.Author
+		if err := tx.Where(`EXISTS (SELECT 1 FROM authors older
+			WHERE older.organization_id = authors.organization_id
+			AND LOWER(older.name) = LOWER(authors.name)
+			AND older.id < authors.id)`).
+			Order("id").Find(&duplicates).Error; err != nil {
+			return err
+		}
+
+		for _, duplicate := range duplicates {
+			var kept models.Author
+			if err := tx.Where("organization_id = ? AND LOWER(name) = LOWER(?)", duplicate.OrganizationID, duplicate.Name).
+				Order("id").First(&kept).Error; err != nil {
+				return err
+			}
+			if err := credits.MoveCredits(tx, duplicate.ID, kept.ID); err != nil {
+				return err
+			}
+			if err := tx.Delete(&duplicate).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_authors_org_lower_name ON authors (organization_id, LOWER(name))").Error
+	})
+}
+
+// migrateBookAuthors links the author text of books without author credits
+// to author records, splitting co-authors and sharing an author between
+// books that spell the name the same way, ignoring case
+func migrateBookAuthors() error {
+	var books []models.Book
+	if err := DB.Unscoped().
+		Where("author <> '' AND NOT EXISTS (SELECT 1 FROM book_authors WHERE book_authors.book_id = books.id)").
+		Find(&books).Error; err != nil {
+		return err
+	}
+
+	for _, book := range books {
+		if err := DB.Transaction(func(tx *gorm.DB) error {
+			return credits.Sync(tx, book.ID, book.OrganizationID, book.Author)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateBookCategories maps the category text of books that aren't linked to
+// a category yet into the category tree. Paths like "Fiction > Fantasy" or
+// "Fiction/Fantasy" become nested categories and the book keeps the name of
+// the innermost one.
+func migrateBookCategories() error {
+	var categories []struct {
+		OrganizationID uint
+		Category       string
+	}
+	if err := DB.Unscoped().Model(&models.Book{}).
+		Select("DISTINCT organization_id, TRIM(category) AS category").
+		Where("category_id IS NULL AND TRIM(COALESCE(category, '')) <> ''").
+		Scan(&categories).Error; err != nil {
+		return err
+	}
+
+	for _, row := range categories {
+		names := taxonomy.SplitPath(row.Category)
+		if len(names) == 0 {
+			continue
+		}
+		if err := DB.Transaction(func(tx *gorm.DB) error {
+			category, err := taxonomy.FindOrCreatePath(tx, row.OrganizationID, names)
+			if err == taxonomy.ErrNoSlug {
+				// Punctuation only, left as text for an admin to fix
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return tx.Unscoped().Model(&models.Book{}).
+				Where("organization_id = ? AND category_id IS NULL AND TRIM(category) = ?", row.OrganizationID, row.Category).
+				Updates(map[string]interface{}{"category_id": category.ID, "category": category.Name}).Error
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package isbn validates International Standard Book Numbers and normalizes
+// them to ISBN-13.
+package isbn
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrLength   = errors.New("ISBN must have 10 or 13 digits")
+	ErrChecksum = errors.New("ISBN check digit is wrong")
+	ErrPrefix   = errors.New("ISBN-13 must start with 978 or 979")
+)
+
+// label matches an "ISBN", "ISBN-10" or "ISBN-13" label before the number
+var label = regexp.MustCompile(`^ISBN(?:-1[03])?\s*:?`)
+
+// Normalize validates an ISBN-10 or ISBN-13, written with or without hyphens,
+// spaces or a leading "ISBN-13:" label, and returns it as an ISBN-13 of
+// digits only
+func Normalize(input string) (string, error) {
+	input = label.ReplaceAllString(strings.ToUpper(strings.TrimSpace(input)), "")
+	isbn := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == ':' {
+			return -1
+		}
+		return r
+	}, input)
+
+	switch len(isbn) {
+	case 10:
+		if !digits(isbn[:9]) || !(digits(isbn[9:]) || isbn[9] == 'X') {
+			return "", ErrLength
+		}
+		if checkDigit10(isbn[:9]) != isbn[9] {
+			return "", ErrChecksum
+		}
+		isbn13 := "978" + isbn[:9]
+		return isbn13 + string(checkDigit13(isbn13)), nil
+	case 13:
+		if !digits(isbn) {
+			return "", ErrLength
+		}
+		if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+			return "", ErrPrefix
+		}
+		if checkDigit13(isbn[:12]) != isbn[12] {
+			return "", ErrChecksum
+		}
+		return isbn, nil
+	}
+	return "", ErrLength
+}
+
+// To10 converts a normalized ISBN-13 to ISBN-10, which only exists for the
+// 978 prefix
+func To10(isbn13 string) (string, bool) {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+	return isbn13[3:12] + string(checkDigit10(isbn13[3:12])), true
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDigit10 computes the ISBN-10 check digit of the first 9 digits:
+// weights 10 down to 2, modulo 11, with X standing for 10
+func checkDigit10(first9 string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(first9[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 computes the ISBN-13 check digit of the first 12 digits:
+// alternating weights 1 and 3, modulo 10
+func checkDigit13(first12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(first12[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
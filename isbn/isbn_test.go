@@ -0,0 +1,91 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "ISBN-13", input: "9780261103573", expected: "9780261103573"},
+		{name: "ISBN-13 with hyphens", input: "978-0-261-10357-3", expected: "9780261103573"},
+		{name: "ISBN-13 with spaces", input: " 978 0 261 10357 3 ", expected: "9780261103573"},
+		{name: "979 prefix", input: "979-10-90636-07-1", expected: "9791090636071"},
+		{name: "ISBN-10", input: "0-261-10357-1", expected: "9780261103573"},
+		{name: "ISBN-10 with X check digit", input: "0-8044-2957-X", expected: "9780804429573"},
+		{name: "lowercase x", input: "080442957x", expected: "9780804429573"},
+		{name: "ISBN label", input: "ISBN 978-0-261-10357-3", expected: "9780261103573"},
+		{name: "ISBN label with a colon", input: "ISBN: 0-261-10357-1", expected: "9780261103573"},
+		{name: "ISBN-10 label", input: "ISBN-10: 0-261-10357-1", expected: "9780261103573"},
+		{name: "ISBN-13 label", input: "ISBN-13: 978-0-261-10357-3", expected: "9780261103573"},
+		{name: "lowercase label without a space", input: "isbn-13:9780261103573", expected: "9780261103573"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Normalize(tt.input)
+			if err != nil {
+				t.Fatalf("Normalize(%q) error = %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected error
+	}{
+		{name: "empty", input: "", expected: ErrLength},
+		{name: "too short", input: "978026110357", expected: ErrLength},
+		{name: "too long", input: "97802611035731", expected: ErrLength},
+		{name: "letters", input: "978026110357A", expected: ErrLength},
+		{name: "X inside an ISBN-10", input: "08044X9573", expected: ErrLength},
+		{name: "X in an ISBN-13", input: "978080442957X", expected: ErrLength},
+		{name: "wrong ISBN-13 check digit", input: "978-0-261-10357-4", expected: ErrChecksum},
+		{name: "wrong ISBN-10 check digit", input: "0-261-10357-2", expected: ErrChecksum},
+		{name: "ISBN-10 with X where a digit belongs", input: "0-261-10357-X", expected: ErrChecksum},
+		{name: "wrong checksum behind a label", input: "ISBN-13: 978-0-261-10357-4", expected: ErrChecksum},
+		{name: "unknown prefix", input: "9770261103573", expected: ErrPrefix},
+		{name: "unknown label", input: "ISBN-12: 978-0-261-10357-3", expected: ErrLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Normalize(tt.input); !errors.Is(err, tt.expected) {
+				t.Errorf("Normalize(%q) error = %v, want %v", tt.input, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		name     string
+		isbn13   string
+		expected string
+		ok       bool
+	}{
+		{name: "978 prefix", isbn13: "9780261103573", expected: "0261103571", ok: true},
+		{name: "X check digit", isbn13: "9780804429573", expected: "080442957X", ok: true},
+		{name: "979 prefix", isbn13: "9791090636071", ok: false},
+		{name: "not normalized", isbn13: "978-0-261-10357-3", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := To10(tt.isbn13)
+			if ok != tt.ok || result != tt.expected {
+				t.Errorf("To10(%q) = %q, %v, want %q, %v", tt.isbn13, result, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"authSystem/audit"
+	"authSystem/initializers"
+	"authSystem/middleware"
+	"authSystem/models"
+	"authSystem/types"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errLastOwner keeps an account whose removal would leave an organization
+// without an owner
+var errLastOwner = errors.New("user is the last owner of an organization")
+
+// AccountDeletion anonymizes accounts whose deletion grace period has ended
+func AccountDeletion() Job {
+	return Job{
+		Name:     "account-deletion",
+		Interval: time.Hour,
+		Run:      deleteScheduledAccounts,
+	}
+}
+
+func deleteScheduledAccounts(ctx context.Context) error {
+	var users []models.User
+	if err := initializers.DB.WithContext(ctx).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).
+		Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := anonymizeUser(ctx, user); errors.Is(err, errLastOwner) {
+			// Another owner left during the grace period. The deletion stays
+			// scheduled and runs once the ownership has been transferred.
+			middleware.GetLogger().Warn("Account deletion postponed",
+				zap.Uint("user_id", user.ID), zap.Error(err))
+			continue
+		} else if err != nil {
+			return fmt.Errorf("anonymize user %d: %w", user.ID, err)
+		}
+		audit.Record(nil, audit.Event{
+			Action:     audit.ActionAccountDeleted,
+			TargetType: "user",
+			TargetID:   user.ID,
+		})
+	}
+	return nil
+}
+
+// anonymizeUser removes personal data while keeping IDs so books and the
+// audit trail stay consistent
+func anonymizeUser(ctx context.Context, user models.User) error {
+	return initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"email":                 fmt.Sprintf("deleted-user-%d@deleted.invalid", user.ID),
+			"password":              "",
+			"role":                  "user",
+			"deletion_scheduled_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := checkOwnersRemain(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Membership{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.BookCollaborator{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.BookRevision{}).Where("editor_type = ? AND editor_id = ?", types.PrincipalUser, user.ID).
+			Update("editor_name", "").Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.AuditEvent{}).Where("actor_id = ?", user.ID).
+			Updates(map[string]interface{}{"actor_email": "", "ip": ""}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AuditEvent{}).Where("actor_email = ?", user.Email).
+			Updates(map[string]interface{}{"actor_email": "", "ip": ""}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Invitation{}).Where("LOWER(email) = LOWER(?)", user.Email).Update("email", "").Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&models.User{}, user.ID).Error
+	})
+}
+
+// checkOwnersRemain fails with errLastOwner when the user is the only owner
+// of one of their organizations. The owners stay locked until tx ends so
+// they can't leave while the account is being removed.
+func checkOwnersRemain(tx *gorm.DB, userID uint) error {
+	var owners []models.Membership
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("role = ? AND organization_id IN (?)", models.OrgRoleOwner,
+			tx.Model(&models.Membership{}).Select("organization_id").
+				Where("user_id = ? AND role = ?", userID, models.OrgRoleOwner)).
+		Find(&owners).Error; err != nil {
+		return err
+	}
+	others := make(map[uint]bool)
+	for _, owner := range owners {
+		others[owner.OrganizationID] = others[owner.OrganizationID] || owner.UserID != userID
+	}
+	for organizationID, remain := range others {
+		if !remain {
+			return fmt.Errorf("%w %d", errLastOwner, organizationID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"authSystem/initializers"
+	"authSystem/models"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultExportRetentionHours = 24
+
+	// exportTimeout is how long an export may run before it is considered
+	// interrupted, e.g. by a restart
+	exportTimeout = time.Hour
+)
+
+// BookExporter writes the books an export job selects to w and returns the
+// number of rows written
+type BookExporter func(ctx context.Context, job models.ExportJob, w io.Writer) (int64, error)
+
+// ExportDir is where finished exports are kept, configured with EXPORT_DIR
+func ExportDir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "book-exports")
+}
+
+// ExportPath is the file of an export job
+func ExportPath(job models.ExportJob) string {
+	return filepath.Join(ExportDir(), fmt.Sprintf("export-%d", job.ID))
+}
+
+// ExportRetention is how long finished exports can be downloaded, configured
+// with EXPORT_RETENTION_HOURS
+func ExportRetention() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("EXPORT_RETENTION_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = defaultExportRetentionHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// BookExports runs pending export jobs one after another with export and
+// removes the files of expired ones
+func BookExports(export BookExporter) Job {
+	return Job{
+		Name:     "book-exports",
+		Interval: 10 * time.Second,
+		Run: func(ctx context.Context) error {
+			if err := expireExports(ctx); err != nil {
+				return err
+			}
+			for {
+				job, ok, err := claimExport(ctx)
+				if err != nil || !ok {
+					return err
+				}
+				if err := runExport(ctx, job, export); err != nil {
+					return err
+				}
+			}
+		},
+	}
+}
+
+// claimExport marks the oldest pending export as running and returns it.
+// The files are written to the local EXPORT_DIR, so instances running the
+// job have to share that directory with those serving the downloads.
+func claimExport(ctx context.Context) (models.ExportJob, bool, error) {
+	var job models.ExportJob
+	err := initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", models.ExportPending).
+			Order("id").First(&job).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		job.Status, job.StartedAt = models.ExportRunning, &now
+		return tx.Model(&job).Updates(map[string]interface{}{"status": job.Status, "started_at": job.StartedAt}).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		return job, false, nil
+	}
+	return job, err == nil, err
+}
+
+// runExport writes the file of an export job and records the outcome,
+// unless expireExports gave up on the job in the meantime
+func runExport(ctx context.Context, job models.ExportJob, export BookExporter) error {
+	if err := os.MkdirAll(ExportDir(), 0o700); err != nil {
+		return err
+	}
+
+	path := ExportPath(job)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	rows, err := export(ctx, job, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"finished_at": now, "rows": rows}
+	if err != nil {
+		os.Remove(path)
+		updates["status"], updates["error"] = models.ExportFailed, err.Error()
+	} else {
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			return statErr
+		}
+		updates["status"], updates["size"], updates["expires_at"] = models.ExportDone, info.Size(), now.Add(ExportRetention())
+	}
+	result := initializers.DB.WithContext(ctx).Model(&job).
+		Where("status = ?", models.ExportRunning).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 && err == nil {
+		// The job was failed as interrupted, nothing refers to the file
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireExports deletes the files of exports past their retention and fails
+// exports that have been running for too long
+func expireExports(ctx context.Context) error {
+	db := initializers.DB.WithContext(ctx)
+	if err := db.Model(&models.ExportJob{}).
+		Where("status = ? AND started_at < ?", models.ExportRunning, time.Now().Add(-exportTimeout)).
+		Updates(map[string]interface{}{"status": models.ExportFailed, "error": "export was interrupted"}).Error; err != nil {
+		return err
+	}
+
+	var expired []models.ExportJob
+	if err := db.Where("status = ? AND expires_at <= ?", models.ExportDone, time.Now()).Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, job := range expired {
+		if err := os.Remove(ExportPath(job)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := db.Model(&job).Update("status", models.ExportExpired).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
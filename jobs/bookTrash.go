@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"authSystem/audit"
+	"authSystem/covers"
+	"authSystem/initializers"
+	"authSystem/models"
+	"authSystem/storage"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultTrashRetentionDays = 30
+
+// TrashRetention is how long deleted books stay in the trash before they are
+// purged, configured with TRASH_RETENTION_DAYS. Zero keeps them until an
+// admin purges them.
+func TrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days < 0 {
+		days = defaultTrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// BookTrash purges books that have been in the trash longer than the
+// retention period
+func BookTrash() Job {
+	return Job{
+		Name:     "book-trash",
+		Interval: time.Hour,
+		Run:      purgeExpiredBooks,
+	}
+}
+
+func purgeExpiredBooks(ctx context.Context) error {
+	retention := TrashRetention()
+	if retention == 0 {
+		return nil
+	}
+
+	var bookIDs []uint
+	if err := initializers.DB.WithContext(ctx).Unscoped().Model(&models.Book{}).
+		Where("deleted_at IS NOT NULL AND deleted_at <= ?", time.Now().Add(-retention)).
+		Pluck("id", &bookIDs).Error; err != nil {
+		return err
+	}
+
+	for _, bookID := range bookIDs {
+		var cover *models.BookCover
+		if err := initializers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) (err error) {
+			cover, err = PurgeBook(tx, bookID)
+			return err
+		}); err != nil {
+			return fmt.Errorf("purge book %d: %w", bookID, err)
+		}
+		if cover != nil {
+			covers.Discard(ctx, storage.Default(), *cover)
+		}
+		audit.Record(nil, audit.Event{
+			Action:     audit.ActionBookPurged,
+			TargetType: "book",
+			TargetID:   bookID,
+		})
+	}
+	return nil
+}
+
+// PurgeBook permanently deletes a book along with its collaborators,
+// revisions, author credits, tags and cover. The files of the cover aren't
+// part of the transaction, so the deleted cover is returned for the caller
+// to discard once it is committed.
+func PurgeBook(tx *gorm.DB, bookID uint) (*models.BookCover, error) {
+	var cover *models.BookCover
+	var found models.BookCover
+	if err := tx.Where("book_id = ?", bookID).Limit(1).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	if found.ID != 0 {
+		if err := tx.Delete(&found).Error; err != nil {
+			return nil, err
+		}
+		cover = &found
+	}
+
+	if err := tx.Where("book_id = ?", bookID).Delete(&models.BookCollaborator{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("book_id = ?", bookID).Delete(&models.BookRevision{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("book_id = ?", bookID).Delete(&models.BookAuthor{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("book_id = ?", bookID).Delete(&models.BookTag{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Delete(&models.Book{}, bookID).Error; err != nil {
+		return nil, err
+	}
+	return cover, nil
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"authSystem/middleware"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Job is a background task run periodically until the context is canceled
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Start runs every job in its own goroutine: once right away, then on each interval
+func Start(ctx context.Context, jobs ...Job) {
+	for _, job := range jobs {
+		go run(ctx, job)
+	}
+}
+
+func run(ctx context.Context, job Job) {
+	log := middleware.GetLogger()
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := job.Run(ctx); err != nil {
+			log.Error("Background job failed", zap.String("job", job.Name), zap.Error(err))
+		} else {
+			log.Debug("Background job finished", zap.String("job", job.Name), zap.Duration("duration", time.Since(start)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -3,7 +3,13 @@ package main
 import (
 	"authSystem/controllers"
 	"authSystem/initializers"
+	"authSystem/jobs"
+	"authSystem/metadata"
 	"authSystem/middleware"
+	"authSystem/models"
+	"authSystem/opds"
+	"authSystem/policy"
+	"authSystem/storage"
 	"context"
 	"fmt"
 	"log"
@@ -33,6 +39,25 @@ func init() {
 	}
 	defer middleware.CloseLogger()
 
+	// Load book access policies
+	policyFile := os.Getenv("POLICY_FILE")
+	if policyFile == "" {
+		policyFile = "policies.json"
+	}
+	if err := policy.Init(policyFile); err != nil {
+		logger.Fatal("Failed to load policies", zap.Error(err))
+	}
+
+	// Configure the catalogs book metadata is looked up in
+	if err := metadata.Init(); err != nil {
+		logger.Fatal("Failed to configure metadata providers", zap.Error(err))
+	}
+
+	// Configure where cover images are stored
+	if err := storage.Init(); err != nil {
+		logger.Fatal("Failed to configure blob store", zap.Error(err))
+	}
+
 	// Initialize database connection
 	if err := initializers.ConnectToDB(); err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
@@ -70,8 +95,8 @@ func main() {
 		cors.New(cors.Config{
 			AllowOrigins:     []string{"http://localhost:3000", os.Getenv("FRONTEND_URL")},
 			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-			ExposeHeaders:    []string{"Content-Length"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "If-Match", "If-None-Match"},
+			ExposeHeaders:    []string{"Content-Length", "ETag", "Link"},
 			AllowCredentials: true,
 			MaxAge:           12 * time.Hour,
 		}),
@@ -93,28 +118,150 @@ func main() {
 		authGroup.POST("/login", controllers.Login)
 		authGroup.GET("/validate", middleware.RequireAuth, controllers.Validate)
 		authGroup.GET("/logout", middleware.RequireAuth, controllers.Logout)
+		authGroup.POST("/password", middleware.RequireAuth, middleware.RequireHuman, middleware.DenyImpersonation, controllers.ChangePassword)
+		authGroup.POST("/impersonate/end", middleware.RequireAuth, controllers.EndImpersonation)
+		authGroup.POST("/org/switch", middleware.RequireAuth, middleware.RequireHuman, controllers.SwitchOrganization)
+		authGroup.POST("/token", controllers.IssueServiceToken)
 	}
 
-	// Book routes with authentication
+	// Book routes with authentication, scoped to the caller's active organization
 	bookController := controllers.NewBookController()
+	authorController := controllers.NewAuthorController()
+	categoryController := controllers.NewCategoryController()
+	tagController := controllers.NewTagController()
+	organizationController := controllers.NewOrganizationController()
+	// Per-book authorization is decided by the policies in POLICY_FILE
+	canRead := middleware.RequireScope(models.ScopeBooksRead)
+	canWrite := middleware.RequireScope(models.ScopeBooksWrite)
 	apiGroup := r.Group("/api")
 	apiGroup.Use(middleware.RequireAuth)
 	{
-		apiGroup.GET("/book/:id", bookController.GetBookByID)
-		apiGroup.POST("/book", bookController.CreateBook)
-		apiGroup.PATCH("/book/:id", bookController.UpdateBook)
-		apiGroup.DELETE("/book/:id", bookController.DeleteBook)
+		apiGroup.GET("/books", canRead, bookController.SearchBooks)
+		apiGroup.GET("/books/suggest", canRead, bookController.SuggestBooks)
+		apiGroup.GET("/books/lookup", canRead, bookController.LookupBook)
+		apiGroup.GET("/books/trash", canRead, bookController.GetTrash)
+		apiGroup.POST("/books/import", canWrite, bookController.ImportBooks)
+		apiGroup.GET("/books/export/:format", canRead, bookController.ExportBookRecords)
+		apiGroup.GET("/book/:id", canRead, bookController.GetBookByID)
+		apiGroup.POST("/book", canWrite, bookController.CreateBook)
+		apiGroup.PATCH("/book/:id", canWrite, bookController.UpdateBook)
+		apiGroup.PUT("/book/:id", canWrite, bookController.ReplaceBook)
+		apiGroup.DELETE("/book/:id", canWrite, bookController.DeleteBook)
+		apiGroup.POST("/book/:id/restore", canWrite, bookController.RestoreBook)
+		apiGroup.GET("/book/:id/revisions", canRead, bookController.GetRevisions)
+		apiGroup.GET("/book/:id/revisions/:revisionId", canRead, bookController.GetRevision)
+		apiGroup.GET("/book/:id/revisions/:revisionId/diff", canRead, bookController.DiffRevisions)
+		apiGroup.POST("/book/:id/revisions/:revisionId/rollback", canWrite, bookController.RollbackBook)
+		apiGroup.GET("/book/:id/export/:format", canRead, bookController.ExportBookRecord)
+		apiGroup.GET("/book/:id/cover", canRead, bookController.GetCover)
+		apiGroup.GET("/book/:id/cover/:size", canRead, bookController.GetCoverImage)
+		apiGroup.PUT("/book/:id/cover", canWrite, bookController.PutCover)
+		apiGroup.DELETE("/book/:id/cover", canWrite, bookController.DeleteCover)
+		apiGroup.GET("/book/:id/authors", canRead, bookController.GetBookAuthors)
+		apiGroup.PUT("/book/:id/authors", canWrite, bookController.SetBookAuthors)
+		apiGroup.GET("/authors", canRead, authorController.GetAuthors)
+		apiGroup.POST("/authors", canWrite, authorController.CreateAuthor)
+		apiGroup.GET("/authors/:id", canRead, authorController.GetAuthor)
+		apiGroup.PATCH("/authors/:id", canWrite, authorController.UpdateAuthor)
+		apiGroup.DELETE("/authors/:id", canWrite, authorController.DeleteAuthor)
+		apiGroup.POST("/authors/:id/merge", canWrite, authorController.MergeAuthor)
+		apiGroup.GET("/authors/:id/books", canRead, authorController.GetAuthorBooks)
+		apiGroup.GET("/book/:id/tags", canRead, bookController.GetBookTags)
+		apiGroup.POST("/book/:id/tags", canWrite, bookController.AddBookTags)
+		apiGroup.DELETE("/book/:id/tags/:tag", canWrite, bookController.RemoveBookTag)
+		apiGroup.GET("/tags", canRead, tagController.GetTags)
+		apiGroup.GET("/categories", canRead, categoryController.GetCategories)
+		apiGroup.POST("/categories", canWrite, categoryController.CreateCategory)
+		apiGroup.GET("/categories/:id", canRead, categoryController.GetCategory)
+		apiGroup.PATCH("/categories/:id", canWrite, categoryController.UpdateCategory)
+		apiGroup.DELETE("/categories/:id", canWrite, categoryController.DeleteCategory)
+		apiGroup.GET("/book/:id/collaborators", canRead, bookController.GetCollaborators)
+		apiGroup.POST("/book/:id/collaborators", middleware.RequireHuman, bookController.AddCollaborator)
+		apiGroup.DELETE("/book/:id/collaborators/:userId", middleware.RequireHuman, bookController.RemoveCollaborator)
+		apiGroup.GET("/me/books", middleware.RequireHuman, bookController.GetMyBooks)
+	}
+
+	// OPDS catalogs for e-reader apps, which may only support HTTP Basic
+	opds1Controller := controllers.NewOPDSController(opds.Version1)
+	opds2Controller := controllers.NewOPDSController(opds.Version2)
+	opdsGroup := r.Group("/opds")
+	opdsGroup.Use(controllers.OPDSAuth, canRead)
+	{
+		opdsGroup.GET("", opds1Controller.GetRoot)
+		opdsGroup.GET("/search.xml", opds1Controller.GetSearchDescription)
+		opdsGroup.GET("/books", opds1Controller.GetBooks)
+		opdsGroup.GET("/categories", opds1Controller.GetCategories)
+		opdsGroup.GET("/authors", opds1Controller.GetAuthors)
+		opdsGroup.GET("/books/:id/export/:format", bookController.ExportBookRecord)
+		opdsGroup.GET("/books/:id/cover/:size", bookController.GetCoverImage)
+		opdsGroup.GET("/v2", opds2Controller.GetRoot)
+		opdsGroup.GET("/v2/books", opds2Controller.GetBooks)
+		opdsGroup.GET("/v2/categories", opds2Controller.GetCategories)
+		opdsGroup.GET("/v2/authors", opds2Controller.GetAuthors)
+	}
+
+	// Organization routes, for human users only
+	orgGroup := r.Group("/api/orgs")
+	orgGroup.Use(middleware.RequireAuth, middleware.RequireHuman)
+	{
+		orgGroup.GET("", organizationController.GetMyOrganizations)
+		orgGroup.POST("", organizationController.CreateOrganization)
+		orgGroup.GET("/:id/members", organizationController.GetMembers)
+		orgGroup.POST("/:id/members", organizationController.AddMember)
+		orgGroup.PATCH("/:id/members/:userId", organizationController.UpdateMember)
+		orgGroup.DELETE("/:id/members/:userId", organizationController.RemoveMember)
+	}
+
+	// Personal data routes
+	privacyController := controllers.NewPrivacyController()
+	meGroup := r.Group("/me")
+	meGroup.Use(middleware.RequireAuth, middleware.RequireHuman, middleware.DenyImpersonation)
+	{
+		meGroup.GET("/export", privacyController.ExportMyData)
+		meGroup.POST("/delete", privacyController.DeleteMyAccount)
+		meGroup.DELETE("/delete", privacyController.CancelMyAccountDeletion)
 	}
 
 	// Admin routes 
 	adminGroup := r.Group("/admin")
 	UserController := controllers.NewUserController()
+	auditController := controllers.NewAuditController()
+	invitationController := controllers.NewInvitationController()
+	serviceAccountController := controllers.NewServiceAccountController()
+	policyController := controllers.NewPolicyController()
 	adminGroup.Use(middleware.RequireAuth, middleware.RequireAdmin)
 	{
 		adminGroup.GET("/users", UserController.GetAllUsers)
+		adminGroup.POST("/users/:id/impersonate", UserController.ImpersonateUser)
+		adminGroup.PATCH("/users/:id/role", UserController.UpdateUserRole)
+		adminGroup.GET("/users/:id/export", privacyController.ExportUserData)
+		adminGroup.POST("/users/:id/delete", privacyController.DeleteUserAccount)
 		adminGroup.GET("/books", bookController.GetAllBooks)
+		adminGroup.GET("/books/export", bookController.ExportBooks)
+		adminGroup.POST("/books/exports", bookController.CreateBookExport)
+		adminGroup.GET("/books/exports", bookController.GetBookExports)
+		adminGroup.GET("/books/exports/:id", bookController.GetBookExport)
+		adminGroup.GET("/books/exports/:id/download", bookController.DownloadBookExport)
+		adminGroup.DELETE("/books/:id", bookController.PurgeBook)
+		adminGroup.GET("/policies", policyController.GetPolicies)
+		adminGroup.POST("/policies/test", policyController.TestPolicy)
+		adminGroup.GET("/service-accounts", serviceAccountController.GetAllServiceAccounts)
+		adminGroup.POST("/service-accounts", serviceAccountController.CreateServiceAccount)
+		adminGroup.PATCH("/service-accounts/:id", serviceAccountController.UpdateServiceAccount)
+		adminGroup.POST("/service-accounts/:id/rotate", serviceAccountController.RotateServiceAccountSecret)
+		adminGroup.DELETE("/service-accounts/:id", serviceAccountController.DeleteServiceAccount)
+		adminGroup.GET("/audit", auditController.GetAuditEvents)
+		adminGroup.GET("/audit/export", auditController.ExportAuditEvents)
+		adminGroup.GET("/settings/signup", invitationController.GetSignupSettings)
+		adminGroup.PUT("/settings/signup", invitationController.UpdateSignupSettings)
+		adminGroup.GET("/invitations", invitationController.GetAllInvitations)
+		adminGroup.POST("/invitations", invitationController.CreateInvitation)
+		adminGroup.DELETE("/invitations/:id", invitationController.RevokeInvitation)
 	}
 
+	// Background jobs stop with the server
+	jobs.Start(ctx, jobs.AccountDeletion(), jobs.BookTrash(), jobs.BookExports(controllers.RunBookExport))
+
 	// Start server with graceful shutdown
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,109 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// maxCacheEntries bounds the memory the cache takes
+	maxCacheEntries = 10000
+
+	// missTTL is how long it is remembered that no provider knows a book,
+	// shorter than for found books as catalogs keep growing
+	missTTL = time.Hour
+
+	// partialTTL is how long the candidates of a lookup some providers
+	// failed are kept, so the failed ones are asked again soon
+	partialTTL = 5 * time.Minute
+)
+
+type cacheEntry struct {
+	candidates []Metadata
+	partial    *PartialError
+	expires    time.Time
+}
+
+// Cache keeps the results of a provider in memory. Failed lookups are not
+// cached, so they are retried on the next request; partial results are
+// kept only briefly and returned with their *PartialError.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+
+	// now is the clock entries expire by
+	now func() time.Time
+}
+
+func NewCache(provider Provider, ttl time.Duration) *Cache {
+	return &Cache{provider: provider, ttl: ttl, entries: map[string]cacheEntry{}, now: time.Now}
+}
+
+func (c *Cache) Name() string {
+	return c.provider.Name()
+}
+
+func (c *Cache) Lookup(ctx context.Context, isbn string) ([]Metadata, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[isbn]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.result()
+	}
+
+	candidates, err := c.provider.Lookup(ctx, isbn)
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, err
+	}
+
+	ttl := c.ttl
+	if len(candidates) == 0 && missTTL < ttl {
+		ttl = missTTL
+	}
+	if partial != nil && partialTTL < ttl {
+		ttl = partialTTL
+	}
+	entry = cacheEntry{candidates: candidates, partial: partial, expires: now.Add(ttl)}
+	c.mu.Lock()
+	if len(c.entries) >= maxCacheEntries {
+		c.evict(now)
+	}
+	c.entries[isbn] = entry
+	c.mu.Unlock()
+	return entry.result()
+}
+
+// result returns a copy of the candidates, with the partial error of the
+// lookup if there was one
+func (e cacheEntry) result() ([]Metadata, error) {
+	candidates := append([]Metadata{}, e.candidates...)
+	if e.partial != nil {
+		return candidates, e.partial
+	}
+	return candidates, nil
+}
+
+// evict drops expired entries, or if there are none the entry closest to
+// expiring. It must be called with mu held.
+func (c *Cache) evict(now time.Time) {
+	var oldest string
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		delete(c.entries, oldest)
+	}
+}
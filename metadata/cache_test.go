@@ -0,0 +1,147 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingProvider answers with fixed results and counts the lookups
+type countingProvider struct {
+	name       string
+	candidates []Metadata
+	err        error
+	lookups    int
+}
+
+func (p *countingProvider) Name() string {
+	return p.name
+}
+
+func (p *countingProvider) Lookup(ctx context.Context, isbn string) ([]Metadata, error) {
+	p.lookups++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return append([]Metadata{}, p.candidates...), nil
+}
+
+// testCache returns a cache of provider with a clock that advance moves
+func testCache(provider Provider, ttl time.Duration) (*Cache, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCache(provider, ttl)
+	cache.now = func() time.Time { return now }
+	return cache, func(d time.Duration) { now = now.Add(d) }
+}
+
+const testISBN = "9780261103573"
+
+func TestCacheKeepsResultsForTTL(t *testing.T) {
+	provider := &countingProvider{name: "test", candidates: []Metadata{{Title: "The Hobbit"}}}
+	cache, advance := testCache(provider, 24*time.Hour)
+
+	for i := 0; i < 2; i++ {
+		found, err := cache.Lookup(context.Background(), testISBN)
+		if err != nil || len(found) != 1 || found[0].Title != "The Hobbit" {
+			t.Fatalf("Lookup() = %+v, %v, want The Hobbit", found, err)
+		}
+		found[0].Title = "Changed"
+	}
+	if provider.lookups != 1 {
+		t.Errorf("provider asked %d times, want 1", provider.lookups)
+	}
+
+	advance(24*time.Hour - time.Second)
+	cache.Lookup(context.Background(), testISBN)
+	if provider.lookups != 1 {
+		t.Errorf("provider asked %d times before the TTL, want 1", provider.lookups)
+	}
+
+	advance(time.Second)
+	cache.Lookup(context.Background(), testISBN)
+	if provider.lookups != 2 {
+		t.Errorf("provider asked %d times after the TTL, want 2", provider.lookups)
+	}
+}
+
+func TestCacheExpiresMissesSooner(t *testing.T) {
+	provider := &countingProvider{name: "test"}
+	cache, advance := testCache(provider, 24*time.Hour)
+
+	cache.Lookup(context.Background(), testISBN)
+	advance(missTTL - time.Second)
+	cache.Lookup(context.Background(), testISBN)
+	if provider.lookups != 1 {
+		t.Errorf("provider asked %d times before missTTL, want 1", provider.lookups)
+	}
+
+	provider.candidates = []Metadata{{Title: "The Hobbit"}}
+	advance(time.Second)
+	found, _ := cache.Lookup(context.Background(), testISBN)
+	if provider.lookups != 2 || len(found) != 1 {
+		t.Errorf("Lookup() after missTTL = %+v with %d lookups, want the new candidate", found, provider.lookups)
+	}
+}
+
+func TestCacheDoesNotKeepFailures(t *testing.T) {
+	provider := &countingProvider{name: "test", err: errors.New("unavailable")}
+	cache, _ := testCache(provider, 24*time.Hour)
+
+	if _, err := cache.Lookup(context.Background(), testISBN); err == nil {
+		t.Fatal("Lookup() error = nil, want the provider's error")
+	}
+	provider.err = nil
+	if _, err := cache.Lookup(context.Background(), testISBN); err != nil || provider.lookups != 2 {
+		t.Errorf("Lookup() error = %v with %d lookups, want a new lookup", err, provider.lookups)
+	}
+}
+
+func TestCacheKeepsPartialResultsBriefly(t *testing.T) {
+	working := &countingProvider{name: "working", candidates: []Metadata{{Title: "The Hobbit"}}}
+	failing := &countingProvider{name: "failing", err: errors.New("unavailable")}
+	cache, advance := testCache(Multi(working, failing), 24*time.Hour)
+
+	for i := 0; i < 2; i++ {
+		found, err := cache.Lookup(context.Background(), testISBN)
+		var partial *PartialError
+		if !errors.As(err, &partial) || len(found) != 1 {
+			t.Fatalf("Lookup() = %+v, %v, want the candidate with a partial error", found, err)
+		}
+		if len(partial.Failures) != 1 {
+			t.Errorf("failures = %v, want the failing provider", partial.Failures)
+		}
+	}
+	if working.lookups != 1 {
+		t.Errorf("provider asked %d times, want 1", working.lookups)
+	}
+
+	failing.err = nil
+	failing.candidates = []Metadata{{Title: "The Hobbit, or There and Back Again"}}
+	advance(partialTTL)
+	found, err := cache.Lookup(context.Background(), testISBN)
+	if err != nil || len(found) != 2 {
+		t.Errorf("Lookup() after partialTTL = %+v, %v, want both candidates", found, err)
+	}
+}
+
+func TestMultiLookup(t *testing.T) {
+	hobbit := &countingProvider{name: "a", candidates: []Metadata{{Title: "The Hobbit"}}}
+	failing := &countingProvider{name: "b", err: errors.New("unavailable")}
+
+	found, err := Multi(hobbit, hobbit).Lookup(context.Background(), testISBN)
+	if err != nil || len(found) != 2 {
+		t.Errorf("Lookup() = %+v, %v, want the candidates of both providers", found, err)
+	}
+
+	found, err = Multi(failing, failing).Lookup(context.Background(), testISBN)
+	var partial *PartialError
+	if err == nil || errors.As(err, &partial) || found != nil {
+		t.Errorf("Lookup() = %+v, %v, want a complete failure", found, err)
+	}
+
+	found, err = Multi().Lookup(context.Background(), testISBN)
+	if err != nil || len(found) != 0 {
+		t.Errorf("Lookup() without providers = %+v, %v, want no candidates", found, err)
+	}
+}
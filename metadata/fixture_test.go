@@ -0,0 +1,99 @@
+package metadata
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFixtureLookup(t *testing.T) {
+	fixture, err := NewFixture([]Metadata{{
+		ISBN:            "0-261-10357-1",
+		Title:           "The Hobbit",
+		Authors:         []string{"J. R. R. Tolkien"},
+		PublicationDate: "September 21, 1937",
+		Language:        "eng",
+	}, {
+		ISBN:  "9780261102385",
+		Title: "The Lord of the Rings",
+	}})
+	if err != nil {
+		t.Fatalf("NewFixture() error = %v", err)
+	}
+
+	found, err := fixture.Lookup(context.Background(), "9780261103573")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	want := []Metadata{{
+		Source:          "fixture",
+		ISBN:            "9780261103573",
+		Title:           "The Hobbit",
+		Authors:         []string{"J. R. R. Tolkien"},
+		PublicationDate: "1937-09-21",
+		Language:        "en",
+	}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Lookup() = %+v, want %+v", found, want)
+	}
+
+	found, err = fixture.Lookup(context.Background(), "9780261102385")
+	if err != nil || len(found) != 1 || found[0].Authors == nil {
+		t.Errorf("Lookup() = %+v, %v, want one book with an empty author list", found, err)
+	}
+
+	found, err = fixture.Lookup(context.Background(), "9780000000002")
+	if err != nil || found == nil || len(found) != 0 {
+		t.Errorf("Lookup() of an unknown ISBN = %#v, %v, want no candidates", found, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fixture.Lookup(ctx, "9780261103573"); err == nil {
+		t.Error("Lookup() with a canceled context error = nil, want an error")
+	}
+}
+
+func TestFixtureResultsAreCopies(t *testing.T) {
+	fixture, err := NewFixture([]Metadata{{ISBN: "9780261103573", Title: "The Hobbit"}})
+	if err != nil {
+		t.Fatalf("NewFixture() error = %v", err)
+	}
+	found, _ := fixture.Lookup(context.Background(), "9780261103573")
+	found[0].Title = "Changed"
+	if again, _ := fixture.Lookup(context.Background(), "9780261103573"); again[0].Title != "The Hobbit" {
+		t.Errorf("Lookup() title = %q after changing a result, want The Hobbit", again[0].Title)
+	}
+}
+
+func TestNewFixtureRejectsInvalidISBN(t *testing.T) {
+	if _, err := NewFixture([]Metadata{{ISBN: "12345", Title: "Nothing"}}); err == nil {
+		t.Error("NewFixture() error = nil, want an error")
+	}
+}
+
+func TestLoadFixture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	if err := os.WriteFile(path, []byte(`[{"isbn": "0261103571", "title": "The Hobbit"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := LoadFixture(path)
+	if err != nil {
+		t.Fatalf("LoadFixture() error = %v", err)
+	}
+	if found, _ := fixture.Lookup(context.Background(), "9780261103573"); len(found) != 1 {
+		t.Errorf("Lookup() = %+v, want the book of the file", found)
+	}
+
+	if _, err := LoadFixture(""); err == nil {
+		t.Error("LoadFixture(\"\") error = nil, want an error")
+	}
+	if err := os.WriteFile(path, []byte(`{`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFixture(path); err == nil {
+		t.Error("LoadFixture() of invalid JSON error = nil, want an error")
+	}
+}
@@ -0,0 +1,214 @@
+// Package metadata looks up the bibliographic metadata of books by ISBN in
+// external catalogs, so that it doesn't have to be entered by hand.
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	defaultCacheHours     = 24
+	defaultTimeoutSeconds = 5
+)
+
+// Metadata is what a provider knows about a book; fields it doesn't know
+// are empty. PublicationDate is YYYY, YYYY-MM or YYYY-MM-DD and Language a
+// BCP 47 tag.
+type Metadata struct {
+	Source          string   `json:"source"`
+	ISBN            string   `json:"isbn"`
+	Title           string   `json:"title"`
+	Subtitle        string   `json:"subtitle,omitempty"`
+	Authors         []string `json:"authors"`
+	Publisher       string   `json:"publisher,omitempty"`
+	PublicationDate string   `json:"publication_date,omitempty"`
+	Language        string   `json:"language,omitempty"`
+	PageCount       int      `json:"page_count,omitempty"`
+	Description     string   `json:"description,omitempty"`
+	Subjects        []string `json:"subjects,omitempty"`
+	CoverURL        string   `json:"cover_url,omitempty"`
+}
+
+// Provider looks up books in a catalog by ISBN-13. A book the catalog
+// doesn't know is not an error: Lookup returns no candidates.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, isbn string) ([]Metadata, error)
+}
+
+// PartialError is returned along with the candidates of a lookup when some
+// of the providers asked failed, so the candidates may be incomplete
+type PartialError struct {
+	Failures []string
+}
+
+func (e *PartialError) Error() string {
+	return strings.Join(e.Failures, "; ")
+}
+
+// multi asks several providers and returns the candidates of all of them
+type multi []Provider
+
+// Multi combines providers. A failing provider doesn't hide the candidates
+// of the others: Lookup returns them with a *PartialError, and fails with
+// no candidates only when every provider fails.
+func Multi(providers ...Provider) Provider {
+	return multi(providers)
+}
+
+func (m multi) Name() string {
+	names := make([]string, len(m))
+	for i, provider := range m {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (m multi) Lookup(ctx context.Context, isbn string) ([]Metadata, error) {
+	candidates := []Metadata{}
+	var failures []string
+	for _, provider := range m {
+		found, err := provider.Lookup(ctx, isbn)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", provider.Name(), err))
+			continue
+		}
+		candidates = append(candidates, found...)
+	}
+	if len(failures) == 0 {
+		return candidates, nil
+	}
+	if len(failures) == len(m) {
+		return nil, errors.New(strings.Join(failures, "; "))
+	}
+	return candidates, &PartialError{Failures: failures}
+}
+
+var (
+	provider   Provider = Multi()
+	providerMu sync.RWMutex
+)
+
+// Init configures the providers Lookup uses from the environment:
+// METADATA_PROVIDERS lists them (openlibrary, fixture, or none; openlibrary
+// by default), OPENLIBRARY_URL points to an Open Library compatible
+// catalog, METADATA_FIXTURE_FILE is the file of the fixture provider,
+// METADATA_TIMEOUT_SECONDS limits requests and METADATA_CACHE_HOURS is how
+// long results are cached.
+func Init() error {
+	names := strings.TrimSpace(os.Getenv("METADATA_PROVIDERS"))
+	if names == "" {
+		names = "openlibrary"
+	}
+
+	timeout := time.Duration(envInt("METADATA_TIMEOUT_SECONDS", defaultTimeoutSeconds)) * time.Second
+	var providers []Provider
+	for _, name := range strings.Split(names, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "none", "":
+		case "openlibrary":
+			providers = append(providers, NewOpenLibrary(os.Getenv("OPENLIBRARY_URL"), timeout))
+		case "fixture":
+			fixture, err := LoadFixture(os.Getenv("METADATA_FIXTURE_FILE"))
+			if err != nil {
+				return err
+			}
+			providers = append(providers, fixture)
+		default:
+			return fmt.Errorf("unknown metadata provider %q", name)
+		}
+	}
+
+	cacheTTL := time.Duration(envInt("METADATA_CACHE_HOURS", defaultCacheHours)) * time.Hour
+	providerMu.Lock()
+	provider = NewCache(Multi(providers...), cacheTTL)
+	providerMu.Unlock()
+	return nil
+}
+
+// Lookup looks up a book with the providers configured by Init
+func Lookup(ctx context.Context, isbn string) ([]Metadata, error) {
+	providerMu.RLock()
+	p := provider
+	providerMu.RUnlock()
+	return p.Lookup(ctx, isbn)
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+var yearPattern = regexp.MustCompile(`(?:^|\D)(1\d{3}|20\d{2})(?:\D|$)`)
+
+// dateLayouts are the date notations of catalogs with the precision they
+// are kept in
+var dateLayouts = []struct {
+	layout string
+	kept   string
+}{
+	{"2006-01-02", "2006-01-02"},
+	{"January 2, 2006", "2006-01-02"},
+	{"Jan 2, 2006", "2006-01-02"},
+	{"2 January 2006", "2006-01-02"},
+	{"2006-01", "2006-01"},
+	{"January 2006", "2006-01"},
+	{"January, 2006", "2006-01"},
+	{"Jan 2006", "2006-01"},
+	{"2006", "2006"},
+}
+
+// normalizeDate turns the free-form dates of catalogs ("July 29, 1954",
+// "1954-07", "c1954") into YYYY, YYYY-MM or YYYY-MM-DD, "" if there's no
+// year in it
+func normalizeDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, date := range dateLayouts {
+		if t, err := time.Parse(date.layout, value); err == nil {
+			return t.Format(date.kept)
+		}
+	}
+	if match := yearPattern.FindStringSubmatch(value); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// normalizeLanguage turns a language code (en, eng, fre) into a BCP 47 tag,
+// "" if it isn't one
+func normalizeLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return ""
+	}
+	// Some catalogs use the bibliographic ISO 639-2 codes
+	if terminology, ok := terminologyCodes[code]; ok {
+		code = terminology
+	}
+	if base, err := language.ParseBase(code); err == nil {
+		return base.String()
+	}
+	return ""
+}
+
+// terminologyCodes maps the ISO 639-2 bibliographic codes that differ from
+// the terminology ones
+var terminologyCodes = map[string]string{
+	"tib": "bod", "cze": "ces", "wel": "cym", "ger": "deu", "gre": "ell",
+	"baq": "eus", "per": "fas", "fre": "fra", "arm": "hye", "ice": "isl",
+	"geo": "kat", "mac": "mkd", "mao": "mri", "may": "msa", "bur": "mya",
+	"dut": "nld", "rum": "ron", "slo": "slk", "alb": "sqi", "chi": "zho",
+}
@@ -0,0 +1,148 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOpenLibraryURL = "https://openlibrary.org"
+
+	// maxResponseBytes caps what is read of a catalog's response
+	maxResponseBytes = 1 << 20
+)
+
+// OpenLibrary looks books up with the Books API of Open Library, or of a
+// catalog serving the same API at BaseURL
+type OpenLibrary struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewOpenLibrary returns an Open Library provider; baseURL defaults to
+// openlibrary.org
+func NewOpenLibrary(baseURL string, timeout time.Duration) *OpenLibrary {
+	if baseURL == "" {
+		baseURL = defaultOpenLibraryURL
+	}
+	return &OpenLibrary{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (ol *OpenLibrary) Name() string {
+	return "openlibrary"
+}
+
+// openLibraryBook is the part of a Books API record (jscmd=data) that maps
+// to book fields
+type openLibraryBook struct {
+	Title         string `json:"title"`
+	Subtitle      string `json:"subtitle"`
+	NumberOfPages int    `json:"number_of_pages"`
+	PublishDate   string `json:"publish_date"`
+	Authors       []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Publishers []struct {
+		Name string `json:"name"`
+	} `json:"publishers"`
+	Subjects []struct {
+		Name string `json:"name"`
+	} `json:"subjects"`
+	Languages []struct {
+		Key string `json:"key"`
+	} `json:"languages"`
+	// Notes is a string or {"type": ..., "value": ...}
+	Notes json.RawMessage `json:"notes"`
+	Cover struct {
+		Large  string `json:"large"`
+		Medium string `json:"medium"`
+	} `json:"cover"`
+}
+
+func (ol *OpenLibrary) Lookup(ctx context.Context, isbn string) ([]Metadata, error) {
+	query := url.Values{
+		"bibkeys": {"ISBN:" + isbn},
+		"format":  {"json"},
+		"jscmd":   {"data"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ol.BaseURL+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := ol.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return []Metadata{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var records map[string]openLibraryBook
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&records); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	record, ok := records["ISBN:"+isbn]
+	if !ok {
+		return []Metadata{}, nil
+	}
+
+	book := Metadata{
+		Source:          ol.Name(),
+		ISBN:            isbn,
+		Title:           strings.TrimSpace(record.Title),
+		Subtitle:        strings.TrimSpace(record.Subtitle),
+		Authors:         []string{},
+		PublicationDate: normalizeDate(record.PublishDate),
+		PageCount:       record.NumberOfPages,
+		Description:     openLibraryNotes(record.Notes),
+		CoverURL:        record.Cover.Large,
+	}
+	if book.CoverURL == "" {
+		book.CoverURL = record.Cover.Medium
+	}
+	for _, author := range record.Authors {
+		if name := strings.TrimSpace(author.Name); name != "" {
+			book.Authors = append(book.Authors, name)
+		}
+	}
+	if len(record.Publishers) > 0 {
+		book.Publisher = strings.TrimSpace(record.Publishers[0].Name)
+	}
+	for _, subject := range record.Subjects {
+		book.Subjects = append(book.Subjects, subject.Name)
+	}
+	// Languages are keys like /languages/eng
+	if len(record.Languages) > 0 {
+		book.Language = normalizeLanguage(strings.TrimPrefix(record.Languages[0].Key, "/languages/"))
+	}
+	return []Metadata{book}, nil
+}
+
+func openLibraryNotes(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return strings.TrimSpace(text)
+	}
+	var typed struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(raw, &typed) == nil {
+		return strings.TrimSpace(typed.Value)
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"authSystem/audit"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DenyImpersonation blocks sensitive actions (password change, account
+// management, ...) while an admin is impersonating a user. It must run after RequireAuth.
+func DenyImpersonation(c *gin.Context) {
+	if _, ok := c.Get("impersonator"); !ok {
+		c.Next()
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionImpersonationDenied,
+		TargetType: "route",
+		TargetID:   c.Request.Method + " " + c.FullPath(),
+	})
+
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden - action not allowed while impersonating"})
+}
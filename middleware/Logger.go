@@ -1,11 +1,14 @@
 package middleware
 
 import (
+	"authSystem/types"
 	"bytes"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -118,6 +121,61 @@ func GetLogger() *zap.Logger {
 	return logger
 }
 
+// maxLoggedBodyBytes caps how much of a request body is logged
+const maxLoggedBodyBytes = 4 << 10
+
+// redactedFields are the body fields holding credentials, whose values are
+// never logged
+var redactedFields = []string{
+	"password", "current_password", "new_password",
+	"client_secret", "client_assertion", "invite_token",
+}
+
+var (
+	redactedJSON = regexp.MustCompile(`("(?:` + strings.Join(redactedFields, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+	redactedForm = regexp.MustCompile(`((?:^|&)(?:` + strings.Join(redactedFields, "|") + `)=)[^&]*`)
+)
+
+// redactBody replaces the values of credential fields in a logged body,
+// which may be cut off anywhere
+func redactBody(contentType string, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/x-www-form-urlencoded" {
+		return redactedForm.ReplaceAll(body, []byte("${1}[REDACTED]"))
+	}
+	return redactedJSON.ReplaceAll(body, []byte(`${1}"[REDACTED]"`))
+}
+
+// loggedBody reports whether the body of a request is worth logging: JSON
+// and form fields are, uploads like cover images, multipart forms and
+// imported catalogs are not
+func loggedBody(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" ||
+		mediaType == "application/x-www-form-urlencoded" ||
+		strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")
+}
+
+// bodyCapture keeps the first maxLoggedBodyBytes of a request body as the
+// handler reads it, so bodies are still streamed to the handler
+type bodyCapture struct {
+	io.ReadCloser
+	prefix    bytes.Buffer
+	truncated bool
+}
+
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	room := maxLoggedBodyBytes - b.prefix.Len()
+	if n > room {
+		b.truncated = true
+		b.prefix.Write(p[:room])
+	} else {
+		b.prefix.Write(p[:n])
+	}
+	return n, err
+}
+
 // Logger returns a gin.HandlerFunc that logs requests
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -132,11 +190,11 @@ func Logger() gin.HandlerFunc {
 		method := c.Request.Method
 		userAgent := c.Request.UserAgent()
 
-		// Read request body
-		var requestBody []byte
-		if c.Request.Body != nil {
-			requestBody, _ = io.ReadAll(c.Request.Body)
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		// Capture the start of the request body while the handler reads it
+		var body *bodyCapture
+		if c.Request.Body != nil && loggedBody(c.GetHeader("Content-Type")) {
+			body = &bodyCapture{ReadCloser: c.Request.Body}
+			c.Request.Body = body
 		}
 
 		// Process request
@@ -149,7 +207,7 @@ func Logger() gin.HandlerFunc {
 		errorMessage := c.Errors.ByType(gin.ErrorTypePrivate).String()
 
 		// Log the request
-		log.Info("HTTP Request",
+		fields := []zap.Field{
 			zap.String("method", method),
 			zap.String("path", path),
 			zap.String("query", query),
@@ -159,8 +217,28 @@ func Logger() gin.HandlerFunc {
 			zap.Duration("latency", latency),
 			zap.Int("status", statusCode),
 			zap.String("error", errorMessage),
-			zap.ByteString("body", requestBody),
-		)
+		}
+		if body != nil {
+			fields = append(fields, zap.ByteString("body", redactBody(c.GetHeader("Content-Type"), body.prefix.Bytes())))
+			if body.truncated {
+				fields = append(fields, zap.Bool("body_truncated", true))
+			}
+		}
+
+		// Tell humans and service accounts apart
+		if principal, ok := c.Get("principal"); ok {
+			fields = append(fields,
+				zap.String("principal_type", principal.(types.Principal).Type),
+				zap.Uint("principal_id", principal.(types.Principal).ID),
+			)
+		}
+
+		// Flag requests made by an admin impersonating another user
+		if impersonator, ok := c.Get("impersonator"); ok {
+			fields = append(fields, zap.Uint("impersonator_id", impersonator.(types.User).ID))
+		}
+
+		log.Info("HTTP Request", fields...)
 
 		// Additional slow request warning
 		if latency > time.Second {
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// logRequest sends a request through Logger to a handler reading the whole
+// body and returns what was logged of it and what the handler read
+func logRequest(t *testing.T, contentType, body string) (map[string]interface{}, string) {
+	t.Helper()
+	core, logs := observer.New(zap.InfoLevel)
+	previous := logger
+	logger = zap.New(core)
+	t.Cleanup(func() { logger = previous })
+
+	var read []byte
+	router := gin.New()
+	router.Use(Logger())
+	router.POST("/", func(c *gin.Context) {
+		read, _ = io.ReadAll(c.Request.Body)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.FilterMessage("HTTP Request").All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d requests, want 1", len(entries))
+	}
+	return entries[0].ContextMap(), string(read)
+}
+
+func TestLoggerCapsBody(t *testing.T) {
+	body := `{"title": "` + strings.Repeat("x", 2*maxLoggedBodyBytes) + `"}`
+	fields, read := logRequest(t, "application/json", body)
+
+	if read != body {
+		t.Errorf("handler read %d bytes, want the whole body of %d", len(read), len(body))
+	}
+	if logged, _ := fields["body"].(string); logged != body[:maxLoggedBodyBytes] {
+		t.Errorf("logged %d bytes of the body, want the first %d", len(logged), maxLoggedBodyBytes)
+	}
+	if fields["body_truncated"] != true {
+		t.Error("body_truncated not logged")
+	}
+}
+
+func TestLoggerLogsSmallBody(t *testing.T) {
+	fields, _ := logRequest(t, "application/json", `{"title": "The Hobbit"}`)
+	if fields["body"] != `{"title": "The Hobbit"}` {
+		t.Errorf("logged body %q", fields["body"])
+	}
+	if _, ok := fields["body_truncated"]; ok {
+		t.Error("body_truncated logged for a complete body")
+	}
+}
+
+func TestLoggerSkipsUploads(t *testing.T) {
+	for _, contentType := range []string{
+		"image/jpeg",
+		"application/octet-stream",
+		"multipart/form-data; boundary=x",
+		"text/csv",
+		"application/x-ndjson",
+		"application/marc",
+		"",
+	} {
+		fields, read := logRequest(t, contentType, "\xff\xd8\xff\xe0 not logged")
+		if _, ok := fields["body"]; ok {
+			t.Errorf("%q: logged the body %q", contentType, fields["body"])
+		}
+		if read != "\xff\xd8\xff\xe0 not logged" {
+			t.Errorf("%q: handler read %q", contentType, read)
+		}
+	}
+}
+
+func TestLoggerLogsPatches(t *testing.T) {
+	fields, _ := logRequest(t, "application/merge-patch+json; charset=utf-8", `{"title": "The Hobbit"}`)
+	if fields["body"] != `{"title": "The Hobbit"}` {
+		t.Errorf("logged body %q", fields["body"])
+	}
+}
+
+func TestLoggerRedactsCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		logged      string
+	}{
+		{
+			name:        "client secret form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "grant_type=client_credentials&client_id=sa_1&client_secret=s3cr%26t&scope=books",
+			logged:      "grant_type=client_credentials&client_id=sa_1&client_secret=[REDACTED]&scope=books",
+		},
+		{
+			name:        "client assertion form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "client_assertion=eyJ.eyJ.sig&client_assertion_type=urn%3Ajwt",
+			logged:      "client_assertion=[REDACTED]&client_assertion_type=urn%3Ajwt",
+		},
+		{
+			name:        "password change",
+			contentType: "application/json",
+			body:        `{"current_password": "old \"one\"", "new_password":"new"}`,
+			logged:      `{"current_password": "[REDACTED]", "new_password":"[REDACTED]"}`,
+		},
+		{
+			name:        "login",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"email": "a@example.com", "password": "hunter2"}`,
+			logged:      `{"email": "a@example.com", "password": "[REDACTED]"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, _ := logRequest(t, tt.contentType, tt.body)
+			if fields["body"] != tt.logged {
+				t.Errorf("logged body %q, want %q", fields["body"], tt.logged)
+			}
+		})
+	}
+}
+
+func TestLoggerRedactsTruncatedCredentials(t *testing.T) {
+	body := `{"title": "` + strings.Repeat("x", maxLoggedBodyBytes-40) + `", "password": "` + strings.Repeat("p", 100) + `"}`
+	fields, _ := logRequest(t, "application/json", body)
+	if logged, _ := fields["body"].(string); strings.Contains(logged, "ppp") || !strings.HasSuffix(logged, `"password": "[REDACTED]"`) {
+		t.Errorf("logged body ends with %q", logged[len(logged)-40:])
+	}
+}
@@ -2,56 +2,67 @@ package middleware
 
 import (
 	"authSystem/initializers"
+	"authSystem/models"
 	"authSystem/types"
 	"fmt"
 	"net/http"
-	"os"
+	"strings"
 	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// RequireAuth is a middleware function that checks if the user is authenticated
+// tokenFromRequest reads the access token from the Authorization cookie or,
+// for API clients, from an "Authorization: Bearer" header
+func tokenFromRequest(c *gin.Context) (string, bool) {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")), true
+	}
+	if tokenString, err := c.Cookie("Authorization"); err == nil {
+		return tokenString, true
+	}
+	return "", false
+}
+
+// RequireAuth is a middleware function that checks if the caller is authenticated.
+// It sets "principal" (types.Principal) for every caller, plus "user" for humans
+// and "serviceAccount" for service accounts.
 func RequireAuth(c *gin.Context) {
 	fmt.Print("RequireAuth middleware called\n")
-	
-	// Get the cookie from the request
-	tokenString, err := c.Cookie("Authorization")
-	if err != nil {
+
+	// Get the token from the request
+	tokenString, ok := tokenFromRequest(c)
+	if !ok {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - no token provided"})
 		return
 	}
 
 	// Parse and validate the token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
-
+	claims, err := ParseToken(tokenString)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - invalid token"})
-		return
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - invalid claims"})
+		if err == ErrTokenExpired {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - token expired"})
+		} else {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - invalid token"})
+		}
 		return
 	}
+	c.Set("claims", claims)
 
-	// Check token expiration
-	exp, ok := claims["exp"].(float64)
-	if !ok || time.Unix(int64(exp), 0).Before(time.Now()) {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - token expired"})
+	if claims["principal"] == types.PrincipalService {
+		authenticateService(c, claims)
 		return
 	}
+	authenticateUser(c, claims)
+}
 
+// authenticateUser attaches the human user identified by the token
+func authenticateUser(c *gin.Context, claims jwt.MapClaims) {
 	// Get user ID from claims
-	userID, ok := claims["sub"]
+	userID, ok := claims["sub"].(float64)
 	fmt.Println("User ID from claims:", userID)
-	if !ok || userID == "" {
+	if !ok || userID == 0 {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - invalid user ID"})
 		return
 	}
@@ -63,7 +74,57 @@ func RequireAuth(c *gin.Context) {
 		return
 	}
 
+	// Impersonation tokens carry the admin's identity in the "act" claim
+	if actorID, ok := ActorID(claims); ok {
+		var impersonator types.User
+		if err := initializers.DB.First(&impersonator, "id = ?", actorID).Error; err != nil || impersonator.Role != "admin" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - invalid impersonation token"})
+			return
+		}
+		c.Set("impersonator", impersonator)
+		c.Set("impersonationExpiresAt", time.Unix(int64(claims["exp"].(float64)), 0))
+	}
+
+	// Resolve the active organization from the "org" claim; tokens issued
+	// before organizations existed fall back to the user's first membership
+	membershipQuery := initializers.DB.Where("user_id = ?", user.ID)
+	if orgID, ok := claims["org"].(float64); ok {
+		membershipQuery = membershipQuery.Where("organization_id = ?", orgID)
+	}
+	var membership models.Membership
+	if err := membershipQuery.Order("id").First(&membership).Error; err == nil {
+		c.Set("membership", membership)
+		c.Set("organizationID", membership.OrganizationID)
+	}
+
 	// Attach user to context and continue
 	c.Set("user", user)
+	c.Set("principal", types.Principal{Type: types.PrincipalUser, ID: user.ID, Name: user.Email})
+	c.Next()
+}
+
+// authenticateService attaches the service account identified by the token
+func authenticateService(c *gin.Context, claims jwt.MapClaims) {
+	clientID, _ := claims["sub"].(string)
+
+	var account models.ServiceAccount
+	if err := initializers.DB.Where("client_id = ?", clientID).First(&account).Error; err != nil || account.Disabled {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized - service account not found"})
+		return
+	}
+
+	// Only keep the token scopes that are still granted to the account
+	granted := []string{}
+	tokenScope, _ := claims["scope"].(string)
+	for _, scope := range strings.Fields(tokenScope) {
+		if account.HasScope(scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	c.Set("serviceAccount", account)
+	c.Set("scopes", granted)
+	c.Set("organizationID", account.OrganizationID)
+	c.Set("principal", types.Principal{Type: types.PrincipalService, ID: account.ID, Name: account.ClientID})
 	c.Next()
-}
\ No newline at end of file
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"authSystem/types"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireHuman rejects service accounts on routes that only make sense for
+// people (password change, personal data, organization management, ...).
+// It must run after RequireAuth.
+func RequireHuman(c *gin.Context) {
+	if principal, ok := c.Get("principal"); ok && principal.(types.Principal).IsService() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden - not available to service accounts"})
+		return
+	}
+	c.Next()
+}
+
+// RequireScope requires service accounts to hold scope. Human users are
+// authorized by their roles instead and pass through. It must run after RequireAuth.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := c.Get("principal")
+		if !ok || !principal.(types.Principal).IsService() {
+			c.Next()
+			return
+		}
+
+		scopes, _ := c.Get("scopes")
+		for _, granted := range scopes.([]string) {
+			if granted == scope {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden - missing scope " + scope})
+	}
+}
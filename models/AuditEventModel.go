@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditEvent records a security relevant or data changing action
+type AuditEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+	ActorType      string    `json:"actor_type" gorm:"not null;default:'user'"`
+	ActorID        *uint     `json:"actor_id" gorm:"index"`
+	ActorEmail     string    `json:"actor_email"`
+	ImpersonatorID *uint     `json:"impersonator_id,omitempty"`
+	Action         string    `json:"action" gorm:"not null;index"`
+	TargetType     string    `json:"target_type" gorm:"index:idx_audit_events_target"`
+	TargetID       string    `json:"target_id" gorm:"index:idx_audit_events_target"`
+	Changes        JSON      `json:"changes,omitempty"`
+	IP             string    `json:"ip"`
+	RequestID      string    `json:"request_id"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// Roles an author can be credited with on a book
+const (
+	AuthorRoleAuthor     = "author"
+	AuthorRoleEditor     = "editor"
+	AuthorRoleTranslator = "translator"
+)
+
+// Author identifier schemes accepted in Author.Identifiers
+var AuthorIdentifierSchemes = []string{"isni", "orcid", "viaf", "wikidata", "openlibrary"}
+
+// Author is a person credited on books of an organization. Names are unique
+// per organization ignoring case (idx_authors_org_lower_name, created by
+// SyncDatabase).
+type Author struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	OrganizationID uint   `json:"organization_id" gorm:"not null;index"`
+	Name           string `json:"name" gorm:"not null"`
+	SortName       string `json:"sort_name" gorm:"not null;default:''"`
+	Bio            string `json:"bio" gorm:"type:text;not null;default:''"`
+
+	// Identifiers maps schemes to the author's external identifiers, e.g.
+	// {"viaf": "95218067", "wikidata": "Q892"}
+	Identifiers JSON `json:"identifiers"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BookAuthor credits an author on a book in a role. The author credits of a
+// book follow its author text; Position orders the credits of a book.
+type BookAuthor struct {
+	ID       uint    `json:"id" gorm:"primaryKey"`
+	BookID   uint    `json:"book_id" gorm:"not null;uniqueIndex:idx_book_authors_book_author_role"`
+	AuthorID uint    `json:"author_id" gorm:"not null;uniqueIndex:idx_book_authors_book_author_role;index"`
+	Role     string  `json:"role" gorm:"not null;default:'author';uniqueIndex:idx_book_authors_book_author_role"`
+	Position int     `json:"position" gorm:"not null;default:0"`
+	Author   *Author `json:"author,omitempty"`
+}
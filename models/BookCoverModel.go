@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// BookCover is the cover image of a book. Its variants (the original and
+// thumbnails) are kept in the blob store under keys derived from Hash, so a
+// new cover gets new keys and URLs. Variants lists them as JSON.
+type BookCover struct {
+	ID             uint      `json:"-" gorm:"primaryKey"`
+	BookID         uint      `json:"book_id" gorm:"not null;uniqueIndex"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;index"`
+	Hash           string    `json:"hash" gorm:"not null"`
+	ContentType    string    `json:"content_type" gorm:"not null"`
+	Width          int       `json:"width"`
+	Height         int       `json:"height"`
+	Variants       JSON      `json:"variants"`
+	UploadedByID   *uint     `json:"uploaded_by_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
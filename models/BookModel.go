@@ -1,12 +1,50 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// Book collaborator roles
+const (
+	CollaboratorViewer = "viewer"
+	CollaboratorEditor = "editor"
+)
+
+// Book is soft deleted into the trash. Books with an ISBN are unique by ISBN
+// among the books that aren't trashed, so several editions of a title can
+// coexist; books without one are unique by title.
 type Book struct {
 	gorm.Model
-	Title    string `json:"title" gorm:"not null;unique"`
-	Author   string `json:"author"`
-	Category string `json:"category"`
+	OrganizationID  uint   `json:"organization_id" gorm:"index;uniqueIndex:idx_books_org_title_without_isbn,where:deleted_at IS NULL AND isbn = '';uniqueIndex:idx_books_org_isbn,where:deleted_at IS NULL AND isbn <> ''"`
+	Title           string `json:"title" gorm:"not null;uniqueIndex:idx_books_org_title_without_isbn,where:deleted_at IS NULL AND isbn = ''"`
+	Subtitle        string `json:"subtitle" gorm:"not null;default:''"`
+	Author          string `json:"author"`
+	Category        string `json:"category"`
+	CategoryID      *uint  `json:"category_id" gorm:"index"`
+	ISBN            string `json:"isbn" gorm:"column:isbn;not null;default:'';uniqueIndex:idx_books_org_isbn,where:deleted_at IS NULL AND isbn <> ''"`
+	Publisher       string `json:"publisher" gorm:"not null;default:''"`
+	PublicationDate string `json:"publication_date" gorm:"not null;default:''"`
+	Language        string `json:"language" gorm:"not null;default:''"`
+	PageCount       int    `json:"page_count" gorm:"not null;default:0"`
+	Edition         string `json:"edition" gorm:"not null;default:''"`
+	Description     string `json:"description" gorm:"type:text;not null;default:''"`
+	CreatedByID     *uint  `json:"created_by_id" gorm:"index"`
+	UpdatedByID     *uint  `json:"updated_by_id"`
+
+	// Version is incremented on every update for optimistic concurrency
+	Version uint `json:"version" gorm:"not null;default:1"`
+}
+
+// BookCollaborator shares a single book with a user, who may belong to
+// another organization
+type BookCollaborator struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	BookID    uint      `json:"book_id" gorm:"not null;uniqueIndex:idx_book_collaborators_book_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_book_collaborators_book_user;index"`
+	Role      string    `json:"role" gorm:"not null;default:'viewer'"`
+	AddedByID *uint     `json:"added_by_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// Book revision actions
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete"
+	RevisionRollback = "rollback"
+	RevisionRestore  = "restore"
+)
+
+// BookRevision records a change to a book: who made it, the book's editable
+// fields afterwards and the fields that changed
+type BookRevision struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at"`
+	BookID     uint      `json:"book_id" gorm:"not null;index"`
+	Version    uint      `json:"version"`
+	Action     string    `json:"action" gorm:"not null"`
+	EditorType string    `json:"editor_type"`
+	EditorID   *uint     `json:"editor_id"`
+	EditorName string    `json:"editor_name"`
+	Snapshot   JSON      `json:"snapshot"`
+	Changes    JSON      `json:"changes,omitempty"`
+
+	// RestoredFromID is the revision a rollback went back to
+	RestoredFromID *uint `json:"restored_from_id,omitempty"`
+}
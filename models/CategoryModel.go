@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// Category is a node of an organization's category tree, curated by the
+// organization's owners and admins. Books name their category by its name,
+// slug or path; CategoryID links them to it.
+type Category struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	OrganizationID uint   `json:"organization_id" gorm:"not null;uniqueIndex:idx_categories_org_slug"`
+	ParentID       *uint  `json:"parent_id" gorm:"index"`
+	Name           string `json:"name" gorm:"not null"`
+	Slug           string `json:"slug" gorm:"not null;uniqueIndex:idx_categories_org_slug"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tag is a free-form label users attach to the books of an organization
+type Tag struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;uniqueIndex:idx_tags_org_slug"`
+	Name           string    `json:"name" gorm:"not null"`
+	Slug           string    `json:"slug" gorm:"not null;uniqueIndex:idx_tags_org_slug"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// BookTag attaches a tag to a book
+type BookTag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	BookID    uint      `json:"book_id" gorm:"not null;uniqueIndex:idx_book_tags_book_tag"`
+	TagID     uint      `json:"tag_id" gorm:"not null;uniqueIndex:idx_book_tags_book_tag;index"`
+	AddedByID *uint     `json:"added_by_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Tag       *Tag      `json:"tag,omitempty"`
+}
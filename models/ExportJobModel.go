@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Export job states
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+// ExportJob is a catalog export run in the background. Query holds the
+// filters of the export as URL query parameters; the finished file is kept
+// until ExpiresAt.
+type ExportJob struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	OrganizationID uint       `json:"organization_id" gorm:"not null;index"`
+	RequestedByID  *uint      `json:"requested_by_id"`
+	Format         string     `json:"format" gorm:"not null"`
+	Gzip           bool       `json:"gzip" gorm:"not null;default:false"`
+	Query          string     `json:"query" gorm:"not null;default:''"`
+	Status         string     `json:"status" gorm:"not null;default:'pending';index"`
+	Error          string     `json:"error,omitempty" gorm:"not null;default:''"`
+	Rows           int64      `json:"rows"`
+	Size           int64      `json:"size"`
+	CreatedAt      time.Time  `json:"created_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
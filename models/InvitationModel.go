@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation lets an admin pre-approve a signup with a given role
+type Invitation struct {
+	gorm.Model
+	Email     string `json:"email"`
+	TokenHash string `json:"-" gorm:"uniqueIndex;not null"`
+	Role      string `json:"role" gorm:"not null;default:'user'"`
+
+	// OrganizationID, when set, makes the invitee join that organization
+	// instead of getting a personal one
+	OrganizationID   *uint  `json:"organization_id"`
+	OrganizationRole string `json:"organization_role"`
+
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	CreatedByID  uint       `json:"created_by_id"`
+	RedeemedAt   *time.Time `json:"redeemed_at"`
+	RedeemedByID *uint      `json:"redeemed_by_id"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+}
+
+// Status reports whether the invitation is pending, redeemed, revoked or expired
+func (i Invitation) Status() string {
+	switch {
+	case i.RevokedAt != nil:
+		return "revoked"
+	case i.RedeemedAt != nil:
+		return "redeemed"
+	case time.Now().After(i.ExpiresAt):
+		return "expired"
+	default:
+		return "pending"
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Organization roles, from most to least privileged
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleEditor = "editor"
+	OrgRoleMember = "member"
+)
+
+// Organization is a tenant owning its own book catalog
+type Organization struct {
+	gorm.Model
+	Name string `json:"name" gorm:"not null"`
+	Slug string `json:"slug" gorm:"uniqueIndex;not null"`
+}
+
+// Membership links a user to an organization with a per-organization role
+type Membership struct {
+	gorm.Model
+	UserID         uint         `json:"user_id" gorm:"not null;uniqueIndex:idx_memberships_user_org"`
+	OrganizationID uint         `json:"organization_id" gorm:"not null;uniqueIndex:idx_memberships_user_org;index"`
+	Role           string       `json:"role" gorm:"not null;default:'member'"`
+	Organization   Organization `json:"organization,omitempty"`
+
+	// Categories optionally restricts an editor to books in these
+	// categories (comma separated), see policies.json
+	Categories string `json:"categories"`
+}
+
+// CategoryList returns the categories the member is restricted to
+func (m Membership) CategoryList() []string {
+	categories := []string{}
+	for _, category := range strings.Split(m.Categories, ",") {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scopes that can be granted to service accounts
+const (
+	ScopeBooksRead  = "books:read"
+	ScopeBooksWrite = "books:write"
+)
+
+// ServiceAccount is a non-human principal used for machine-to-machine access.
+// It authenticates with a client secret or a client assertion signed with the
+// private key matching PublicKey, and acts within a single organization.
+type ServiceAccount struct {
+	gorm.Model
+	Name           string `json:"name" gorm:"not null"`
+	ClientID       string `json:"client_id" gorm:"uniqueIndex;not null"`
+	OwnerID        uint   `json:"owner_id" gorm:"not null;index"`
+	OrganizationID uint   `json:"organization_id" gorm:"not null;index"`
+	Scopes         string `json:"scopes"`
+	PublicKey      string `json:"public_key,omitempty"`
+	Disabled       bool   `json:"disabled" gorm:"not null;default:false"`
+
+	SecretHash              string     `json:"-"`
+	SecretRotatedAt         *time.Time `json:"secret_rotated_at"`
+	PreviousSecretHash      string     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at"`
+	LastUsedAt              *time.Time `json:"last_used_at"`
+}
+
+// ScopeList returns the granted scopes
+func (sa ServiceAccount) ScopeList() []string {
+	return strings.Fields(sa.Scopes)
+}
+
+// HasScope reports whether the service account was granted scope
+func (sa ServiceAccount) HasScope(scope string) bool {
+	for _, s := range sa.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// UsedClientAssertion remembers the jti of a client assertion until it
+// expires, so that the assertion can't be replayed
+type UsedClientAssertion struct {
+	ID        uint      `gorm:"primaryKey"`
+	ClientID  string    `gorm:"not null;uniqueIndex:idx_used_client_assertions_client_jti"`
+	JTI       string    `gorm:"column:jti;not null;uniqueIndex:idx_used_client_assertions_client_jti"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
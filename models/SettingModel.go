@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+// Setting is a runtime configuration value that admins can change without a restart
+type Setting struct {
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -9,4 +11,8 @@ type User struct {
 	Email    string `json:"email" gorm:"unique;not null"`
 	Password string `json:"password"`
 	Role     string `json:"role" gorm:"default:'user'"`
+
+	// DeletionScheduledAt is set when account deletion was requested; the
+	// account is anonymized once the grace period ends
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
 }
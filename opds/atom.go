@@ -0,0 +1,195 @@
+package opds
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count int    `xml:"thr:count,attr,omitempty"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomPerson   `xml:"author"`
+	Publisher  string         `xml:"dc:publisher,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Extent     string         `xml:"dc:extent,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomFeed struct {
+	XMLName         xml.Name    `xml:"feed"`
+	Namespace       string      `xml:"xmlns,attr"`
+	DCNamespace     string      `xml:"xmlns:dc,attr"`
+	OPDSNamespace   string      `xml:"xmlns:opds,attr"`
+	SearchNamespace string      `xml:"xmlns:opensearch,attr"`
+	ThrNamespace    string      `xml:"xmlns:thr,attr"`
+	ID              string      `xml:"id"`
+	Title           string      `xml:"title"`
+	Updated         string      `xml:"updated"`
+	Links           []atomLink  `xml:"link"`
+	TotalResults    int         `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage    int         `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex      int         `xml:"opensearch:startIndex,omitempty"`
+	Entries         []atomEntry `xml:"entry"`
+}
+
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func atomLinks(links []Link) []atomLink {
+	result := make([]atomLink, 0, len(links))
+	for _, link := range links {
+		// URI templates are for OPDS 2.0, Atom feeds use OpenSearch
+		if link.Templated {
+			continue
+		}
+		result = append(result, atomLink{Rel: link.Rel, Href: link.Href, Type: link.Type, Title: link.Title, Count: link.Count})
+	}
+	return result
+}
+
+// WriteAtom writes a feed as an OPDS 1.2 Atom document
+func WriteAtom(w io.Writer, feed Feed) error {
+	doc := atomFeed{
+		Namespace:       "http://www.w3.org/2005/Atom",
+		DCNamespace:     "http://purl.org/dc/terms/",
+		OPDSNamespace:   "http://opds-spec.org/2010/catalog",
+		SearchNamespace: "http://a9.com/-/spec/opensearch/1.1/",
+		ThrNamespace:    "http://purl.org/syndication/thread/1.0",
+		ID:              feed.ID,
+		Title:           feed.Title,
+		Updated:         atomTime(feed.Updated),
+		Links:           atomLinks(feed.Links),
+		TotalResults:    feed.TotalResults,
+		ItemsPerPage:    feed.ItemsPerPage,
+	}
+	if feed.CurrentPage > 0 && feed.ItemsPerPage > 0 {
+		doc.StartIndex = (feed.CurrentPage-1)*feed.ItemsPerPage + 1
+	}
+
+	for _, entry := range feed.Navigation {
+		atom := atomEntry{
+			Title:   entry.Title,
+			ID:      entry.ID,
+			Updated: atomTime(entry.Updated),
+			Links:   atomLinks([]Link{entry.Link}),
+		}
+		if entry.Summary != "" {
+			atom.Content = &atomText{Type: "text", Value: entry.Summary}
+		}
+		doc.Entries = append(doc.Entries, atom)
+	}
+
+	for _, publication := range feed.Publications {
+		title := publication.Title
+		if publication.Subtitle != "" {
+			title += ": " + publication.Subtitle
+		}
+		atom := atomEntry{
+			Title:     title,
+			ID:        publication.ID,
+			Updated:   atomTime(publication.Updated),
+			Publisher: publication.Publisher,
+			Issued:    publication.Published,
+			Language:  publication.Language,
+			Links:     atomLinks(append(append([]Link{}, publication.Images...), publication.Links...)),
+		}
+		for _, name := range publication.Authors {
+			atom.Authors = append(atom.Authors, atomPerson{Name: name})
+		}
+		if publication.ISBN != "" {
+			atom.Identifier = "urn:isbn:" + publication.ISBN
+		}
+		if publication.PageCount > 0 {
+			atom.Extent = pages(publication.PageCount)
+		}
+		for _, subject := range publication.Subjects {
+			term := subject.Code
+			if term == "" {
+				term = subject.Name
+			}
+			atom.Categories = append(atom.Categories, atomCategory{Term: term, Label: subject.Name})
+		}
+		if publication.Description != "" {
+			atom.Summary = &atomText{Type: "text", Value: publication.Description}
+		}
+		doc.Entries = append(doc.Entries, atom)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+type openSearchDescription struct {
+	XMLName        xml.Name      `xml:"OpenSearchDescription"`
+	Namespace      string        `xml:"xmlns,attr"`
+	ShortName      string        `xml:"ShortName"`
+	Description    string        `xml:"Description"`
+	InputEncoding  string        `xml:"InputEncoding"`
+	OutputEncoding string        `xml:"OutputEncoding"`
+	URL            openSearchURL `xml:"Url"`
+}
+
+// WriteOpenSearch writes the OpenSearch description of a catalog's search;
+// template is the URL of the results with {searchTerms} for the query. The
+// short name is cut to the 16 characters OpenSearch allows.
+func WriteOpenSearch(w io.Writer, shortName, description, template string) error {
+	if runes := []rune(shortName); len(runes) > 16 {
+		shortName = string(runes[:16])
+	}
+	doc := openSearchDescription{
+		Namespace:      "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:      shortName,
+		Description:    description,
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URL:            openSearchURL{Type: AtomAcquisitionType, Template: template},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
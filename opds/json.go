@@ -0,0 +1,147 @@
+package opds
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+type jsonLink struct {
+	Rel        string          `json:"rel,omitempty"`
+	Href       string          `json:"href"`
+	Type       string          `json:"type,omitempty"`
+	Title      string          `json:"title,omitempty"`
+	Templated  bool            `json:"templated,omitempty"`
+	Properties *jsonProperties `json:"properties,omitempty"`
+}
+
+type jsonProperties struct {
+	NumberOfItems int `json:"numberOfItems"`
+}
+
+type jsonContributor struct {
+	Name string `json:"name"`
+}
+
+type jsonSubject struct {
+	Name string `json:"name"`
+	Code string `json:"code,omitempty"`
+}
+
+type jsonPublicationMetadata struct {
+	Type          string            `json:"@type"`
+	Identifier    string            `json:"identifier,omitempty"`
+	Title         string            `json:"title"`
+	Subtitle      string            `json:"subtitle,omitempty"`
+	Author        []jsonContributor `json:"author,omitempty"`
+	Publisher     string            `json:"publisher,omitempty"`
+	Published     string            `json:"published,omitempty"`
+	Language      string            `json:"language,omitempty"`
+	Description   string            `json:"description,omitempty"`
+	Subject       []jsonSubject     `json:"subject,omitempty"`
+	NumberOfPages int               `json:"numberOfPages,omitempty"`
+	Modified      string            `json:"modified"`
+}
+
+type jsonPublication struct {
+	Metadata jsonPublicationMetadata `json:"metadata"`
+	Links    []jsonLink              `json:"links"`
+	Images   []jsonLink              `json:"images,omitempty"`
+}
+
+type jsonFeedMetadata struct {
+	Title         string `json:"title"`
+	Modified      string `json:"modified"`
+	NumberOfItems int    `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int    `json:"itemsPerPage,omitempty"`
+	CurrentPage   int    `json:"currentPage,omitempty"`
+}
+
+type jsonFeed struct {
+	Metadata     jsonFeedMetadata  `json:"metadata"`
+	Links        []jsonLink        `json:"links"`
+	Navigation   []jsonLink        `json:"navigation,omitempty"`
+	Publications []jsonPublication `json:"publications,omitempty"`
+}
+
+func jsonTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func jsonLinks(links []Link) []jsonLink {
+	result := make([]jsonLink, 0, len(links))
+	for _, link := range links {
+		converted := jsonLink{Rel: link.Rel, Href: link.Href, Type: link.Type, Title: link.Title, Templated: link.Templated}
+		if link.Count > 0 {
+			converted.Properties = &jsonProperties{NumberOfItems: link.Count}
+		}
+		result = append(result, converted)
+	}
+	return result
+}
+
+// WriteJSON writes a feed as an OPDS 2.0 document
+func WriteJSON(w io.Writer, feed Feed) error {
+	doc := jsonFeed{
+		Metadata: jsonFeedMetadata{
+			Title:         feed.Title,
+			Modified:      jsonTime(feed.Updated),
+			NumberOfItems: feed.TotalResults,
+			ItemsPerPage:  feed.ItemsPerPage,
+			CurrentPage:   feed.CurrentPage,
+		},
+		Links: jsonLinks(feed.Links),
+	}
+
+	for _, entry := range feed.Navigation {
+		link := jsonLinks([]Link{entry.Link})[0]
+		link.Title = entry.Title
+		doc.Navigation = append(doc.Navigation, link)
+	}
+
+	if feed.Acquisition {
+		// An empty page still lists its (no) publications
+		doc.Publications = []jsonPublication{}
+	}
+	for _, publication := range feed.Publications {
+		metadata := jsonPublicationMetadata{
+			Type:          "http://schema.org/Book",
+			Title:         publication.Title,
+			Subtitle:      publication.Subtitle,
+			Publisher:     publication.Publisher,
+			Published:     publication.Published,
+			Language:      publication.Language,
+			Description:   publication.Description,
+			NumberOfPages: publication.PageCount,
+			Modified:      jsonTime(publication.Updated),
+		}
+		if publication.ISBN != "" {
+			metadata.Identifier = "urn:isbn:" + publication.ISBN
+		}
+		for _, name := range publication.Authors {
+			metadata.Author = append(metadata.Author, jsonContributor{Name: name})
+		}
+		for _, subject := range publication.Subjects {
+			metadata.Subject = append(metadata.Subject, jsonSubject{Name: subject.Name, Code: subject.Code})
+		}
+
+		converted := jsonPublication{Metadata: metadata, Links: jsonLinks(publication.Links)}
+		if len(publication.Images) > 0 {
+			converted.Images = jsonLinks(publication.Images)
+		}
+		doc.Publications = append(doc.Publications, converted)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(doc)
+}
+
+// pages describes the extent of a book
+func pages(count int) string {
+	return strconv.Itoa(count) + " pages"
+}
@@ -0,0 +1,112 @@
+// Package opds renders catalog feeds for e-reader apps as OPDS 1.2 (Atom)
+// or OPDS 2.0 (JSON), along with the OpenSearch description OPDS 1.2
+// clients search with.
+package opds
+
+import (
+	"time"
+)
+
+// Versions of the catalog
+const (
+	Version1 = 1
+	Version2 = 2
+)
+
+// Media types of feeds and search descriptions
+const (
+	AtomNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AtomAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	JSONType            = "application/opds+json"
+	OpenSearchType      = "application/opensearchdescription+xml"
+)
+
+// Link relations with a meaning in OPDS
+const (
+	RelSelf        = "self"
+	RelStart       = "start"
+	RelUp          = "up"
+	RelSearch      = "search"
+	RelSubsection  = "subsection"
+	RelNext        = "next"
+	RelPrevious    = "previous"
+	RelFirst       = "first"
+	RelLast        = "last"
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelImage       = "http://opds-spec.org/image"
+	RelThumbnail   = "http://opds-spec.org/image/thumbnail"
+	RelSortNew     = "http://opds-spec.org/sort/new"
+)
+
+// FeedType is the media type of a navigation or acquisition feed in a
+// version of the catalog
+func FeedType(version int, acquisition bool) string {
+	switch {
+	case version == Version2:
+		return JSONType
+	case acquisition:
+		return AtomAcquisitionType
+	}
+	return AtomNavigationType
+}
+
+// Link points from a feed or entry to another resource. Templated links
+// (OPDS 2.0 only) are URI templates; Count is the number of items behind
+// the link, if known.
+type Link struct {
+	Rel       string
+	Href      string
+	Type      string
+	Title     string
+	Templated bool
+	Count     int
+}
+
+// Entry is an entry of a navigation feed, leading to another feed
+type Entry struct {
+	ID      string
+	Title   string
+	Summary string
+	Updated time.Time
+	Link    Link
+}
+
+// Subject is a category of a publication; Code is its slug
+type Subject struct {
+	Name string
+	Code string
+}
+
+// Publication is a book in an acquisition feed
+type Publication struct {
+	ID          string
+	Title       string
+	Subtitle    string
+	Authors     []string
+	Publisher   string
+	Published   string
+	Language    string
+	ISBN        string
+	Description string
+	Subjects    []Subject
+	PageCount   int
+	Updated     time.Time
+	Links       []Link
+	Images      []Link
+}
+
+// Feed is a navigation feed (Navigation set) or an acquisition feed
+// (Acquisition true, Publications set). TotalResults, ItemsPerPage and
+// CurrentPage describe the page of a paginated feed.
+type Feed struct {
+	ID           string
+	Title        string
+	Updated      time.Time
+	Acquisition  bool
+	Links        []Link
+	Navigation   []Entry
+	Publications []Publication
+	TotalResults int
+	ItemsPerPage int
+	CurrentPage  int
+}
@@ -0,0 +1,257 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, document string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		t.Fatalf("invalid JSON %s: %v", document, err)
+	}
+	return value
+}
+
+// The examples of RFC 6902, appendix A
+func TestApplyJSONPatchRFCExamples(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		patch    string
+		expected string
+	}{
+		{
+			name:     "A.1 adding an object member",
+			target:   `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			expected: `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:     "A.2 adding an array element",
+			target:   `{"foo": ["bar", "baz"]}`,
+			patch:    `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			expected: `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:     "A.3 removing an object member",
+			target:   `{"baz": "qux", "foo": "bar"}`,
+			patch:    `[{"op": "remove", "path": "/baz"}]`,
+			expected: `{"foo": "bar"}`,
+		},
+		{
+			name:     "A.4 removing an array element",
+			target:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch:    `[{"op": "remove", "path": "/foo/1"}]`,
+			expected: `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:     "A.5 replacing a value",
+			target:   `{"baz": "qux", "foo": "bar"}`,
+			patch:    `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			expected: `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:     "A.6 moving a value",
+			target:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch:    `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			expected: `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:     "A.7 moving an array element",
+			target:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch:    `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			expected: `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:   "A.8 testing a value: success",
+			target: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[
+				{"op": "test", "path": "/baz", "value": "qux"},
+				{"op": "test", "path": "/foo/1", "value": 2}
+			]`,
+			expected: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:     "A.10 adding a nested member object",
+			target:   `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			expected: `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:     "A.11 ignoring unrecognized elements",
+			target:   `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			expected: `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:     "A.14 ~ escape ordering",
+			target:   `{"/": 9, "~1": 10}`,
+			patch:    `[{"op": "test", "path": "/~01", "value": 10}]`,
+			expected: `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:     "A.16 adding an array value",
+			target:   `{"foo": ["bar"]}`,
+			patch:    `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			expected: `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+		{
+			name:     "appending to an array with -",
+			target:   `{"foo": [1, 2]}`,
+			patch:    `[{"op": "add", "path": "/foo/-", "value": 3}]`,
+			expected: `{"foo": [1, 2, 3]}`,
+		},
+		{
+			name:     "inserting at the end of an array by index",
+			target:   `{"foo": [1, 2]}`,
+			patch:    `[{"op": "add", "path": "/foo/2", "value": 3}]`,
+			expected: `{"foo": [1, 2, 3]}`,
+		},
+		{
+			name:     "~0 and ~1 escapes",
+			target:   `{"a/b": 1, "m~n": 2}`,
+			patch:    `[{"op": "replace", "path": "/a~1b", "value": 3}, {"op": "remove", "path": "/m~0n"}]`,
+			expected: `{"a/b": 3}`,
+		},
+		{
+			name:     "copying a value",
+			target:   `{"foo": {"bar": [1]}}`,
+			patch:    `[{"op": "copy", "from": "/foo", "path": "/baz"}, {"op": "add", "path": "/baz/bar/-", "value": 2}]`,
+			expected: `{"foo": {"bar": [1]}, "baz": {"bar": [1, 2]}}`,
+		},
+		{
+			name:     "replacing the whole document",
+			target:   `{"foo": "bar"}`,
+			patch:    `[{"op": "add", "path": "", "value": [1]}]`,
+			expected: `[1]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ApplyJSONPatch(decode(t, tt.target), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ApplyJSONPatch() error = %v", err)
+			}
+			if expected := decode(t, tt.expected); !reflect.DeepEqual(result, expected) {
+				t.Errorf("ApplyJSONPatch() = %v, want %v", result, expected)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+	}{
+		{
+			name:   "A.9 testing a value: error",
+			target: `{"baz": "qux"}`,
+			patch:  `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+		},
+		{
+			name:   "A.12 adding to a nonexistent target",
+			target: `{"foo": "bar"}`,
+			patch:  `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+		},
+		{
+			name:   "A.15 comparing strings and numbers",
+			target: `{"/": 9, "~1": 10}`,
+			patch:  `[{"op": "test", "path": "/~01", "value": "10"}]`,
+		},
+		{
+			name:   "leading zero index",
+			target: `{"foo": [1, 2, 3]}`,
+			patch:  `[{"op": "remove", "path": "/foo/01"}]`,
+		},
+		{
+			name:   "leading zero index when adding",
+			target: `{"foo": [1, 2, 3]}`,
+			patch:  `[{"op": "add", "path": "/foo/00", "value": 0}]`,
+		},
+		{
+			name:   "negative index",
+			target: `{"foo": [1, 2, 3]}`,
+			patch:  `[{"op": "replace", "path": "/foo/-1", "value": 0}]`,
+		},
+		{
+			name:   "index with a sign",
+			target: `{"foo": [1, 2, 3]}`,
+			patch:  `[{"op": "remove", "path": "/foo/+1"}]`,
+		},
+		{
+			name:   "index out of range",
+			target: `{"foo": [1, 2]}`,
+			patch:  `[{"op": "add", "path": "/foo/3", "value": 3}]`,
+		},
+		{
+			name:   "- outside of add",
+			target: `{"foo": [1, 2]}`,
+			patch:  `[{"op": "remove", "path": "/foo/-"}]`,
+		},
+		{
+			name:   "moving a value into a descendant",
+			target: `{"foo": {"bar": {}}}`,
+			patch:  `[{"op": "move", "from": "/foo", "path": "/foo/bar/baz"}]`,
+		},
+		{
+			name:   "removing a missing member",
+			target: `{"foo": "bar"}`,
+			patch:  `[{"op": "remove", "path": "/baz"}]`,
+		},
+		{
+			name:   "replacing a missing member",
+			target: `{"foo": "bar"}`,
+			patch:  `[{"op": "replace", "path": "/baz", "value": 1}]`,
+		},
+		{
+			name:   "missing value",
+			target: `{"foo": "bar"}`,
+			patch:  `[{"op": "add", "path": "/baz"}]`,
+		},
+		{
+			name:   "unknown operation",
+			target: `{"foo": "bar"}`,
+			patch:  `[{"op": "frobnicate", "path": "/foo"}]`,
+		},
+		{
+			name:   "path without a leading slash",
+			target: `{"foo": "bar"}`,
+			patch:  `[{"op": "remove", "path": "foo"}]`,
+		},
+		{
+			name:   "patch that is not an array",
+			target: `{"foo": "bar"}`,
+			patch:  `{"op": "remove", "path": "/foo"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ApplyJSONPatch(decode(t, tt.target), []byte(tt.patch)); err == nil {
+				t.Error("ApplyJSONPatch() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchLeavesTargetOnFailure(t *testing.T) {
+	target := decode(t, `{"foo": ["bar", "baz"], "qux": {"quux": 1}}`)
+	patch := `[
+		{"op": "add", "path": "/foo/1", "value": "new"},
+		{"op": "remove", "path": "/qux/quux"},
+		{"op": "test", "path": "/foo/0", "value": "nope"}
+	]`
+
+	if _, err := ApplyJSONPatch(target, []byte(patch)); err == nil {
+		t.Fatal("ApplyJSONPatch() error = nil, want a failed test")
+	}
+	if expected := decode(t, `{"foo": ["bar", "baz"], "qux": {"quux": 1}}`); !reflect.DeepEqual(target, expected) {
+		t.Errorf("target = %v after a failed patch, want %v", target, expected)
+	}
+}
@@ -0,0 +1,44 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values decoded into interface{}.
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Content types of the supported patch formats
+const (
+	ContentTypeMergePatch = "application/merge-patch+json"
+	ContentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// ApplyMerge applies a JSON Merge Patch: members of the patch replace those of
+// the target, objects are merged recursively and null removes a member
+func ApplyMerge(target interface{}, mergePatch []byte) (interface{}, error) {
+	var p interface{}
+	if err := json.Unmarshal(mergePatch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	return merge(target, p), nil
+}
+
+func merge(target, p interface{}) interface{} {
+	patchObject, ok := p.(map[string]interface{})
+	if !ok {
+		return p
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = merge(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
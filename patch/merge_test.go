@@ -0,0 +1,49 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The examples of RFC 7396, appendix A
+func TestApplyMergeRFCExamples(t *testing.T) {
+	tests := []struct {
+		target   string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target+" + "+tt.patch, func(t *testing.T) {
+			result, err := ApplyMerge(decode(t, tt.target), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ApplyMerge() error = %v", err)
+			}
+			if expected := decode(t, tt.expected); !reflect.DeepEqual(result, expected) {
+				t.Errorf("ApplyMerge() = %v, want %v", result, expected)
+			}
+		})
+	}
+}
+
+func TestApplyMergeInvalidPatch(t *testing.T) {
+	if _, err := ApplyMerge(decode(t, `{"a":"b"}`), []byte(`{"a":`)); err == nil {
+		t.Error("ApplyMerge() error = nil, want an error")
+	}
+}
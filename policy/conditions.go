@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+)
+
+// operators maps operator names to their implementation; the second argument
+// is the literal value or the referenced attribute
+var operators = map[string]func(actual, expected interface{}, present bool) bool{
+	"eq":         func(a, e interface{}, present bool) bool { return present && equal(a, e) },
+	"ne":         func(a, e interface{}, present bool) bool { return !present || !equal(a, e) },
+	"in":         func(a, e interface{}, present bool) bool { return present && contains(e, a) },
+	"not_in":     func(a, e interface{}, present bool) bool { return !present || !contains(e, a) },
+	"contains":   func(a, e interface{}, present bool) bool { return present && contains(a, e) },
+	"exists":     func(a, e interface{}, present bool) bool { return present && a != nil },
+	"not_exists": func(a, e interface{}, present bool) bool { return !present || a == nil },
+}
+
+func (cond Condition) holds(req Request) bool {
+	actual, present := lookup(req, cond.Attribute)
+	expected := cond.Value
+	if cond.Ref != "" {
+		var ok bool
+		if expected, ok = lookup(req, cond.Ref); !ok {
+			return false
+		}
+	}
+	return operators[cond.Operator](actual, expected, present)
+}
+
+// lookup resolves "subject.x" or "resource.x" within the request
+func lookup(req Request, path string) (interface{}, bool) {
+	var attrs Attributes
+	switch {
+	case strings.HasPrefix(path, "subject."):
+		attrs, path = req.Subject, strings.TrimPrefix(path, "subject.")
+	case strings.HasPrefix(path, "resource."):
+		attrs, path = req.Resource, strings.TrimPrefix(path, "resource.")
+	default:
+		return nil, false
+	}
+	value, ok := attrs[path]
+	return value, ok
+}
+
+// equal compares attribute values loosely so that 3, uint(3) and 3.0 (as
+// decoded from JSON) are the same, and strings compare case-insensitively
+func equal(a, b interface{}) bool {
+	if as, ok := a.(string); ok {
+		bs, ok := b.(string)
+		return ok && strings.EqualFold(as, bs)
+	}
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// contains reports whether the list holds item; a string list may also be a
+// comma separated string
+func contains(list, item interface{}) bool {
+	if s, ok := list.(string); ok {
+		for _, part := range strings.Split(s, ",") {
+			if equal(strings.TrimSpace(part), item) {
+				return true
+			}
+		}
+		return false
+	}
+
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if equal(v.Index(i).Interface(), item) {
+			return true
+		}
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
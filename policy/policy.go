@@ -0,0 +1,238 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Actions on books that are authorized by policies
+const (
+	ActionBookRead   = "book:read"
+	ActionBookCreate = "book:create"
+	ActionBookUpdate = "book:update"
+	ActionBookDelete = "book:delete"
+	ActionBookShare  = "book:share"
+	ActionBookTag    = "book:tag"
+)
+
+// Actions on authors that are authorized by policies; reading authors is
+// open to the members of their organization
+const (
+	ActionAuthorCreate = "author:create"
+	ActionAuthorUpdate = "author:update"
+	ActionAuthorDelete = "author:delete"
+)
+
+// Actions on the category tree that are authorized by policies; reading it is
+// open to the members of its organization
+const (
+	ActionCategoryCreate = "category:create"
+	ActionCategoryUpdate = "category:update"
+	ActionCategoryDelete = "category:delete"
+)
+
+// Effects a policy can have when it matches
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Attributes describe the subject or the resource of a request, e.g.
+// {"id": 3, "role": "user", "org_role": "editor", "categories": ["sci-fi"]}
+type Attributes map[string]interface{}
+
+// Request is what gets authorized: who wants to do what to which resource
+type Request struct {
+	Subject  Attributes `json:"subject"`
+	Action   string     `json:"action"`
+	Resource Attributes `json:"resource"`
+}
+
+// Condition compares an attribute ("subject.x" or "resource.x") either with a
+// literal Value or with another attribute named by Ref
+type Condition struct {
+	Attribute string      `json:"attribute"`
+	Operator  string      `json:"operator"`
+	Value     interface{} `json:"value,omitempty"`
+	Ref       string      `json:"ref,omitempty"`
+}
+
+// Policy allows or denies a set of actions when all of its conditions hold
+type Policy struct {
+	ID          string      `json:"id"`
+	Description string      `json:"description"`
+	Effect      string      `json:"effect"`
+	Actions     []string    `json:"actions"`
+	Conditions  []Condition `json:"conditions"`
+}
+
+// Decision is the outcome of evaluating a request, with the reason for it
+type Decision struct {
+	Allowed  bool     `json:"allowed"`
+	PolicyID string   `json:"policy_id,omitempty"`
+	Reason   string   `json:"reason"`
+	Matched  []string `json:"matched"`
+}
+
+// Engine evaluates requests against a list of policies. A matching deny
+// always wins; otherwise the request is allowed if any policy allows it and
+// denied by default.
+type Engine struct {
+	Policies []Policy `json:"policies"`
+}
+
+var (
+	engine   *Engine
+	engineMu sync.RWMutex
+)
+
+// Load reads and validates a declarative policy file
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var e Engine
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	return New(e.Policies)
+}
+
+// New builds an engine from a list of policies, e.g. a draft to dry-run
+func New(policies []Policy) (*Engine, error) {
+	e := &Engine{Policies: policies}
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Init loads the policy file used by Evaluate
+func Init(path string) error {
+	e, err := Load(path)
+	if err != nil {
+		return err
+	}
+	engineMu.Lock()
+	engine = e
+	engineMu.Unlock()
+	return nil
+}
+
+// Policies returns the policies loaded by Init
+func Policies() []Policy {
+	engineMu.RLock()
+	defer engineMu.RUnlock()
+	if engine == nil {
+		return nil
+	}
+	return engine.Policies
+}
+
+// Evaluate authorizes a request with the policies loaded by Init
+func Evaluate(req Request) Decision {
+	engineMu.RLock()
+	e := engine
+	engineMu.RUnlock()
+
+	if e == nil {
+		return Decision{Reason: "no policies loaded"}
+	}
+	return e.Evaluate(req)
+}
+
+func (e *Engine) validate() error {
+	seen := map[string]bool{}
+	for i, p := range e.Policies {
+		if p.ID == "" {
+			return fmt.Errorf("policy #%d has no id", i+1)
+		}
+		if seen[p.ID] {
+			return fmt.Errorf("duplicate policy id %q", p.ID)
+		}
+		seen[p.ID] = true
+		if p.Effect != EffectAllow && p.Effect != EffectDeny {
+			return fmt.Errorf("policy %q: effect must be allow or deny", p.ID)
+		}
+		if len(p.Actions) == 0 {
+			return fmt.Errorf("policy %q: at least one action is required", p.ID)
+		}
+		for _, cond := range p.Conditions {
+			if _, ok := operators[cond.Operator]; !ok {
+				return fmt.Errorf("policy %q: unknown operator %q", p.ID, cond.Operator)
+			}
+			if !strings.HasPrefix(cond.Attribute, "subject.") && !strings.HasPrefix(cond.Attribute, "resource.") {
+				return fmt.Errorf("policy %q: attribute %q must start with subject. or resource.", p.ID, cond.Attribute)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate authorizes a request
+func (e *Engine) Evaluate(req Request) Decision {
+	decision := Decision{Matched: []string{}}
+	var allowedBy *Policy
+
+	for i := range e.Policies {
+		p := &e.Policies[i]
+		if !p.appliesTo(req.Action) || !p.matches(req) {
+			continue
+		}
+		decision.Matched = append(decision.Matched, p.ID)
+
+		if p.Effect == EffectDeny {
+			decision.Allowed = false
+			decision.PolicyID = p.ID
+			decision.Reason = "denied by " + describe(p)
+			return decision
+		}
+		if allowedBy == nil {
+			allowedBy = p
+		}
+	}
+
+	if allowedBy != nil {
+		decision.Allowed = true
+		decision.PolicyID = allowedBy.ID
+		decision.Reason = "allowed by " + describe(allowedBy)
+		return decision
+	}
+
+	decision.Reason = "no policy allows " + req.Action
+	return decision
+}
+
+func describe(p *Policy) string {
+	if p.Description != "" {
+		return fmt.Sprintf("%s (%s)", p.ID, p.Description)
+	}
+	return p.ID
+}
+
+// appliesTo reports whether the policy covers action; "book:*" and "*" are wildcards
+func (p *Policy) appliesTo(action string) bool {
+	for _, a := range p.Actions {
+		if a == "*" || a == action {
+			return true
+		}
+		if strings.HasSuffix(a, ":*") && strings.HasPrefix(action, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) matches(req Request) bool {
+	for _, cond := range p.Conditions {
+		if !cond.holds(req) {
+			return false
+		}
+	}
+	return true
+}
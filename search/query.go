@@ -0,0 +1,140 @@
+// Package search turns user search input into PostgreSQL full-text queries
+// against the books.search_vector column.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Config is the text search configuration used both for the generated
+// search_vector column and for parsing queries
+const Config = "english"
+
+// Weights of the book fields in search_vector
+const (
+	WeightTitle    = "A"
+	WeightAuthor   = "B"
+	WeightCategory = "C"
+)
+
+// Vector is the expression search_vector is generated from
+const Vector = "setweight(to_tsvector('" + Config + "', coalesce(title, '')), '" + WeightTitle + "') || " +
+	"setweight(to_tsvector('" + Config + "', coalesce(author, '')), '" + WeightAuthor + "') || " +
+	"setweight(to_tsvector('" + Config + "', coalesce(category, '')), '" + WeightCategory + "')"
+
+// Parse converts search input into to_tsquery syntax. It understands
+//
+//	words         all must match (AND)
+//	"some phrase" words must appear next to each other in that order
+//	word*         prefix match
+//	-word         must not match
+//	a OR b        either may match
+//
+// Everything except letters and digits is treated as a separator. weights
+// restricts matches to fields, e.g. WeightTitle; empty matches all fields.
+// The result is empty when the input holds nothing searchable.
+func Parse(input string, weights string) string {
+	// Each group is a list of alternatives; groups are ANDed, so OR binds
+	// tighter than the implicit AND: "a OR b c" is (a | b) & c
+	var groups [][]string
+	or := false
+
+	for _, token := range tokenize(input) {
+		if token == "OR" {
+			or = len(groups) > 0
+			continue
+		}
+
+		negate := strings.HasPrefix(token, "-")
+		token = strings.TrimPrefix(token, "-")
+
+		term := phrase(token, weights)
+		if term == "" {
+			continue
+		}
+		if negate {
+			term = "!" + term
+		}
+
+		if or {
+			groups[len(groups)-1] = append(groups[len(groups)-1], term)
+		} else {
+			groups = append(groups, []string{term})
+		}
+		or = false
+	}
+
+	terms := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if len(group) == 1 {
+			terms = append(terms, group[0])
+		} else {
+			terms = append(terms, "("+strings.Join(group, " | ")+")")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// tokenize splits the input on whitespace, keeping quoted phrases together
+// (including their quotes)
+func tokenize(input string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			current.WriteRune(r)
+			if quoted {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// phrase converts a single token into a tsquery term. Tokens made of several
+// words (quoted phrases, "sci-fi", ...) become a <-> phrase; a trailing *
+// makes the last word a prefix.
+func phrase(token string, weights string) string {
+	token = strings.Trim(token, `"`)
+	prefix := strings.HasSuffix(token, "*")
+
+	words := strings.FieldsFunc(token, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	for i, word := range words {
+		word = strings.ToLower(word)
+		label := weights
+		if prefix && i == len(words)-1 {
+			label = "*" + label
+		}
+		if label != "" {
+			word += ":" + label
+		}
+		words[i] = word
+	}
+
+	if len(words) == 1 {
+		return words[0]
+	}
+	return "(" + strings.Join(words, " <-> ") + ")"
+}
@@ -0,0 +1,99 @@
+// Package storage keeps binary objects such as cover images, on the local
+// filesystem or in an S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for keys that aren't stored
+var ErrNotFound = errors.New("blob not found")
+
+// Info describes a stored blob
+type Info struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore stores blobs under slash-separated keys like
+// "covers/1/2/abc-small.jpg". Put replaces what is stored under a key and
+// Delete of a missing key succeeds.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey rejects keys that could escape the store's directory or bucket
+// prefix
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
+
+var (
+	store   BlobStore
+	storeMu sync.RWMutex
+)
+
+// Init configures the store Default returns from the environment:
+// BLOB_STORE is local (default) or s3. The local store keeps blobs in
+// BLOB_DIR, by default data/blobs under the working directory; the
+// S3 store is configured with S3_ENDPOINT, S3_REGION, S3_BUCKET,
+// S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY and S3_PATH_STYLE.
+func Init() error {
+	var configured BlobStore
+	switch kind := os.Getenv("BLOB_STORE"); kind {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = filepath.Join("data", "blobs")
+		}
+		configured = NewLocal(dir)
+	case "s3":
+		pathStyle, _ := strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+		s3, err := NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       pathStyle,
+		})
+		if err != nil {
+			return err
+		}
+		configured = s3
+	default:
+		return fmt.Errorf("unknown blob store %q", kind)
+	}
+
+	storeMu.Lock()
+	store = configured
+	storeMu.Unlock()
+	return nil
+}
+
+// Default returns the store configured by Init
+func Default() BlobStore {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store
+}
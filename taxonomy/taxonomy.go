@@ -0,0 +1,188 @@
+// Package taxonomy maintains the category tree and the tags of an
+// organization: slugs, category paths and the lookup of the category a book
+// names.
+package taxonomy
+
+import (
+	"authSystem/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// PathSeparator separates the levels of a category path, e.g.
+// "Fiction > Fantasy"
+const PathSeparator = " > "
+
+var (
+	ErrUnknownCategory   = errors.New("unknown category")
+	ErrAmbiguousCategory = errors.New("several categories have this name, use the slug or the path")
+	ErrNoSlug            = errors.New("name must contain letters or digits")
+
+	nonSlug       = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+	pathSeparator = regexp.MustCompile(`\s*(?:>|/)\s*`)
+)
+
+// DescendantsQuery selects the ID of a category and of all categories below
+// it; its single parameter is the category ID
+const DescendantsQuery = `WITH RECURSIVE tree AS (
+	SELECT id FROM categories WHERE id = ?
+	UNION ALL
+	SELECT categories.id FROM categories JOIN tree ON categories.parent_id = tree.id
+) SELECT id FROM tree`
+
+// Slugify turns a name into a slug of lowercase letters and digits joined by
+// dashes: "Science Fiction & Fantasy" becomes "science-fiction-fantasy"
+func Slugify(name string) string {
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// SplitPath splits a category path written with ">" or "/" into names
+func SplitPath(path string) []string {
+	var names []string
+	for _, name := range pathSeparator.Split(strings.TrimSpace(path), -1) {
+		if name = strings.Join(strings.Fields(name), " "); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Path returns the names of a category and its ancestors, root first
+func Path(db *gorm.DB, category models.Category) ([]string, error) {
+	names := []string{category.Name}
+	for category.ParentID != nil {
+		if err := db.First(&category, *category.ParentID).Error; err != nil {
+			return nil, err
+		}
+		names = append([]string{category.Name}, names...)
+	}
+	return names, nil
+}
+
+// Find returns the category of an organization that text names: a slug, a
+// path like "Fiction > Fantasy" or a name that only one category has, all
+// ignoring case
+func Find(db *gorm.DB, organizationID uint, text string) (models.Category, error) {
+	var category models.Category
+	err := db.Where("organization_id = ? AND slug = ?", organizationID, strings.ToLower(strings.TrimSpace(text))).
+		First(&category).Error
+	if err != gorm.ErrRecordNotFound {
+		return category, err
+	}
+
+	names := SplitPath(text)
+	if len(names) == 0 {
+		return category, ErrUnknownCategory
+	}
+
+	// Walk the path from its last name up, so a bare name matches anywhere
+	var candidates []models.Category
+	if err := db.Where("organization_id = ? AND LOWER(name) = LOWER(?)", organizationID, names[len(names)-1]).
+		Find(&candidates).Error; err != nil {
+		return category, err
+	}
+
+	var matches []models.Category
+	for _, candidate := range candidates {
+		path, err := Path(db, candidate)
+		if err != nil {
+			return category, err
+		}
+		if len(path) >= len(names) && strings.EqualFold(strings.Join(path[len(path)-len(names):], PathSeparator), strings.Join(names, PathSeparator)) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return category, ErrUnknownCategory
+	case 1:
+		return matches[0], nil
+	}
+	return category, ErrAmbiguousCategory
+}
+
+// UniqueSlug returns a slug for a new category or tag of an organization
+// that isn't taken yet in table, prefixing the parent's slug or numbering it
+// when needed
+func UniqueSlug(db *gorm.DB, table string, organizationID uint, name, parentSlug string) (string, error) {
+	base := Slugify(name)
+	if base == "" {
+		return "", ErrNoSlug
+	}
+
+	candidates := []string{base}
+	if parentSlug != "" {
+		candidates = append(candidates, parentSlug+"-"+base)
+	}
+	for i := 2; i < 100; i++ {
+		candidates = append(candidates, fmt.Sprintf("%s-%d", base, i))
+	}
+
+	for _, slug := range candidates {
+		var taken int64
+		if err := db.Table(table).Where("organization_id = ? AND slug = ?", organizationID, slug).Count(&taken).Error; err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return slug, nil
+		}
+	}
+	return "", fmt.Errorf("no free slug for %q", name)
+}
+
+// FindOrCreatePath returns the category at the end of a path of names,
+// creating the categories along it that don't exist yet
+func FindOrCreatePath(tx *gorm.DB, organizationID uint, names []string) (models.Category, error) {
+	var category models.Category
+	var parentID *uint
+	parentSlug := ""
+	for _, name := range names {
+		query := tx.Where("organization_id = ? AND LOWER(name) = LOWER(?)", organizationID, name)
+		if parentID == nil {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *parentID)
+		}
+
+		category = models.Category{}
+		err := query.Order("id").First(&category).Error
+		if err == gorm.ErrRecordNotFound {
+			var slug string
+			if slug, err = UniqueSlug(tx, "categories", organizationID, name, parentSlug); err != nil {
+				return category, err
+			}
+			category = models.Category{OrganizationID: organizationID, ParentID: parentID, Name: name, Slug: slug}
+			err = tx.Create(&category).Error
+		}
+		if err != nil {
+			return category, err
+		}
+
+		id := category.ID
+		parentID, parentSlug = &id, category.Slug
+	}
+	return category, nil
+}
+
+// FindOrCreateTag returns the tag of an organization with the given name,
+// ignoring case, creating it when there is none
+func FindOrCreateTag(tx *gorm.DB, organizationID uint, name string) (models.Tag, error) {
+	var tag models.Tag
+	err := tx.Where("organization_id = ? AND (LOWER(name) = LOWER(?) OR slug = ?)", organizationID, name, Slugify(name)).
+		Order("id").First(&tag).Error
+	if err != gorm.ErrRecordNotFound {
+		return tag, err
+	}
+
+	slug, err := UniqueSlug(tx, "tags", organizationID, name, "")
+	if err != nil {
+		return tag, err
+	}
+	tag = models.Tag{OrganizationID: organizationID, Name: name, Slug: slug}
+	return tag, tx.Create(&tag).Error
+}
@@ -0,0 +1,19 @@
+package types
+
+// Principal types
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
+// Principal identifies who is calling the API: a human user or a service account
+type Principal struct {
+	Type string `json:"type"`
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// IsService reports whether the caller is a machine rather than a human
+func (p Principal) IsService() bool {
+	return p.Type == PrincipalService
+}
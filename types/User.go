@@ -2,6 +2,8 @@ package types
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type User struct {
@@ -10,18 +12,79 @@ type User struct {
 	Password  string `json:"password" gorm:"not null"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Role      string `json:"role" gorm:"default:'user'"`
+	DeletedAt gorm.DeletedAt `json:"-"`
+	Role      string         `json:"role" gorm:"default:'user'"`
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
 }
 
 type Book struct {
-	ID       int    `json:"id"`
-	Title    string `json:"title"`
-	Author   string `json:"author"`
-	Category string `json:"category"`
+	ID              int    `json:"id"`
+	OrganizationID  uint   `json:"organization_id"`
+	Title           string `json:"title"`
+	Subtitle        string `json:"subtitle"`
+	Author          string `json:"author"`
+	Category        string `json:"category"`
+	CategoryID      *uint  `json:"category_id"`
+	ISBN            string `json:"isbn" gorm:"column:isbn"`
+	Publisher       string `json:"publisher"`
+	PublicationDate string `json:"publication_date"`
+	Language        string `json:"language"`
+	PageCount       int    `json:"page_count"`
+	Edition         string `json:"edition"`
+	Description     string `json:"description"`
+	CreatedByID     *uint  `json:"created_by_id"`
+	UpdatedByID     *uint  `json:"updated_by_id"`
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+	Version   uint           `json:"version"`
 }
 
+// AddBookRequest holds the editable fields of a book
 type AddBookRequest struct {
-	Title    string `json:"title"`
-	Author   string `json:"author"`
-	Category string `json:"category"`
+	Title           string `json:"title"`
+	Subtitle        string `json:"subtitle"`
+	Author          string `json:"author"`
+	Category        string `json:"category"`
+	ISBN            string `json:"isbn"`
+	Publisher       string `json:"publisher"`
+	PublicationDate string `json:"publication_date"`
+	Language        string `json:"language"`
+	PageCount       int    `json:"page_count"`
+	Edition         string `json:"edition"`
+	Description     string `json:"description"`
+}
+
+// BookRequestFrom returns the editable fields of a book
+func BookRequestFrom(book Book) AddBookRequest {
+	return AddBookRequest{
+		Title:           book.Title,
+		Subtitle:        book.Subtitle,
+		Author:          book.Author,
+		Category:        book.Category,
+		ISBN:            book.ISBN,
+		Publisher:       book.Publisher,
+		PublicationDate: book.PublicationDate,
+		Language:        book.Language,
+		PageCount:       book.PageCount,
+		Edition:         book.Edition,
+		Description:     book.Description,
+	}
+}
+
+// ApplyTo copies the editable fields onto a book
+func (req AddBookRequest) ApplyTo(book *Book) {
+	book.Title = req.Title
+	book.Subtitle = req.Subtitle
+	book.Author = req.Author
+	book.Category = req.Category
+	book.ISBN = req.ISBN
+	book.Publisher = req.Publisher
+	book.PublicationDate = req.PublicationDate
+	book.Language = req.Language
+	book.PageCount = req.PageCount
+	book.Edition = req.Edition
+	book.Description = req.Description
 }